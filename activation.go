@@ -0,0 +1,140 @@
+//go:build unix
+
+package extraio
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// First file descriptor used by socket activation.
+const listenFdsStart = 3
+
+// ActivationFiles returns the files passed with systemd style socket
+// activation (LISTEN_FDS, LISTEN_PID and LISTEN_FDNAMES), named after
+// LISTEN_FDNAMES when present. The variables are unset so they are not
+// inherited by child processes. If LISTEN_PID is set it must match the
+// current process, when unset the files are accepted so a parent process
+// using PassListeners can hand them over without knowing the child's pid.
+func ActivationFiles() ([]*os.File, error) {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")
+		os.Unsetenv("LISTEN_FDS")
+		os.Unsetenv("LISTEN_FDNAMES")
+	}()
+	fdsEnv := os.Getenv("LISTEN_FDS")
+	if fdsEnv == "" {
+		return nil, nil
+	}
+	if pidEnv := os.Getenv("LISTEN_PID"); pidEnv != "" {
+		pid, err := strconv.Atoi(pidEnv)
+		if err != nil {
+			return nil, fmt.Errorf("extraio: invalid LISTEN_PID: %w", err)
+		}
+		if pid != os.Getpid() {
+			return nil, nil
+		}
+	}
+	nfds, err := strconv.Atoi(fdsEnv)
+	if err != nil || nfds < 0 {
+		return nil, fmt.Errorf("extraio: invalid LISTEN_FDS %q", fdsEnv)
+	}
+	var names []string
+	if namesEnv := os.Getenv("LISTEN_FDNAMES"); namesEnv != "" {
+		names = strings.Split(namesEnv, ":")
+	}
+	files := make([]*os.File, 0, nfds)
+	for i := 0; i < nfds; i++ {
+		fd := listenFdsStart + i
+		syscall.CloseOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		files = append(files, os.NewFile(uintptr(fd), name))
+	}
+	return files, nil
+}
+
+// ActivationListeners is ActivationFiles converted to listeners.
+// Each file is closed once converted, as net.FileListener duplicates it.
+func ActivationListeners() ([]net.Listener, error) {
+	files, err := ActivationFiles()
+	if err != nil {
+		return nil, err
+	}
+	listeners := make([]net.Listener, 0, len(files))
+	for i, f := range files {
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			for _, f := range files[i+1:] {
+				f.Close()
+			}
+			return nil, fmt.Errorf("extraio: activation fd %s: %w", f.Name(), err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// ListenerFile returns a duplicate of the file descriptor underlying l,
+// looking through wrappers that implement Unwrap() net.Listener, so
+// wrapped listeners can still be handed to another process.
+func ListenerFile(l net.Listener) (*os.File, error) {
+	for {
+		switch v := l.(type) {
+		case interface{ File() (*os.File, error) }:
+			return v.File()
+		case interface{ Unwrap() net.Listener }:
+			l = v.Unwrap()
+		default:
+			return nil, errors.New("extraio: listener has no file descriptor")
+		}
+	}
+}
+
+// PassListeners arranges for cmd to inherit listeners using the socket
+// activation protocol understood by ActivationListeners, for graceful
+// handover to a new binary. cmd.ExtraFiles must be empty as the
+// descriptors need to start at 3. The returned files may be closed once
+// cmd has started.
+func PassListeners(cmd *exec.Cmd, listeners ...net.Listener) ([]*os.File, error) {
+	if len(cmd.ExtraFiles) != 0 {
+		return nil, errors.New("extraio: PassListeners requires empty cmd.ExtraFiles")
+	}
+	files := make([]*os.File, 0, len(listeners))
+	for _, l := range listeners {
+		f, err := ListenerFile(l)
+		if err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	cmd.ExtraFiles = files
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = make([]string, 0, len(env)+1)
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "LISTEN_") {
+			continue
+		}
+		cmd.Env = append(cmd.Env, kv)
+	}
+	cmd.Env = append(cmd.Env, "LISTEN_FDS="+strconv.Itoa(len(files)))
+	return files, nil
+}
@@ -0,0 +1,81 @@
+package extraio
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+)
+
+// Backoff describes exponentially increasing delays between retries,
+// zero fields take the defaults noted below.
+type Backoff struct {
+	// Default 10ms.
+	Initial time.Duration
+	// Default 1s.
+	Max time.Duration
+	// Default 2.
+	Multiplier float64
+	// Number of retries before giving up, <= 0 means no limit.
+	MaxRetries int
+}
+
+// Delay returns the delay before retry number attempt, counting from 0.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := b.Initial
+	if d <= 0 {
+		d = 10 * time.Millisecond
+	}
+	max := b.Max
+	if max <= 0 {
+		max = time.Second
+	}
+	mult := b.Multiplier
+	if mult <= 1 {
+		mult = 2
+	}
+	for i := 0; i < attempt && d < max; i++ {
+		d = time.Duration(float64(d) * mult)
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// Exhausted reports whether attempt exceeds MaxRetries.
+func (b Backoff) Exhausted(attempt int) bool {
+	return b.MaxRetries > 0 && attempt >= b.MaxRetries
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// IsTemporary reports whether err is worth retrying, that is
+// EINTR, EAGAIN or an error with a Temporary method returning true.
+// Timeouts are not considered temporary.
+func IsTemporary(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) {
+		return true
+	}
+	var t interface{ Temporary() bool }
+	if errors.As(err, &t) {
+		var to interface{ Timeout() bool }
+		if errors.As(err, &to) && to.Timeout() {
+			return false
+		}
+		return t.Temporary()
+	}
+	return false
+}
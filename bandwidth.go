@@ -0,0 +1,188 @@
+package extraio
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// BandwidthGroup enforces an aggregate rate across many streams. Each
+// stream takes its own Limiter from NewLimiter, and when the group is
+// saturated waiting limiters are served round robin, so a stream issuing
+// many requests, or many goroutines behind one limiter, cannot starve
+// the others. It is safe for concurrent use.
+type BandwidthGroup struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+	// limiters with queued waiters, served from next.
+	active []*groupLimiter
+	next   int
+	timer  *time.Timer
+}
+
+type groupLimiter struct {
+	g     *BandwidthGroup
+	queue []*groupWaiter
+}
+
+type groupWaiter struct {
+	n       int
+	ready   chan struct{}
+	granted bool
+}
+
+// NewBandwidthGroup returns a group allowing bytesPerSec in total and up
+// to burst bytes at once, a burst < 1 is taken as 1.
+func NewBandwidthGroup(bytesPerSec float64, burst int) *BandwidthGroup {
+	if burst < 1 {
+		burst = 1
+	}
+	return &BandwidthGroup{
+		rate:   bytesPerSec,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// NewLimiter returns a Limiter drawing on the group's bandwidth, use one
+// per stream, e.g. with NewRateLimitedConn.
+func (g *BandwidthGroup) NewLimiter() Limiter {
+	return &groupLimiter{g: g}
+}
+
+// SetRate changes the group's rate and burst, waiters are rescheduled.
+func (g *BandwidthGroup) SetRate(bytesPerSec float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.refill(time.Now())
+	g.rate = bytesPerSec
+	g.burst = burst
+	g.tokens = min(g.tokens, float64(burst))
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.schedule()
+}
+
+func (g *BandwidthGroup) refill(now time.Time) {
+	g.tokens = min(g.tokens+now.Sub(g.last).Seconds()*g.rate, float64(g.burst))
+	g.last = now
+}
+
+// schedule grants queued waiters round robin while tokens last, then
+// arms a timer for when the next in line can be served.
+func (g *BandwidthGroup) schedule() {
+	g.refill(time.Now())
+	for len(g.active) > 0 {
+		if g.next >= len(g.active) {
+			g.next = 0
+		}
+		l := g.active[g.next]
+		w := l.queue[0]
+		if g.tokens < float64(w.n) {
+			if g.timer == nil && g.rate > 0 {
+				wait := time.Duration((float64(w.n) - g.tokens) / g.rate * float64(time.Second))
+				g.timer = time.AfterFunc(wait, g.tick)
+			}
+			return
+		}
+		g.tokens -= float64(w.n)
+		w.granted = true
+		close(w.ready)
+		l.queue = l.queue[1:]
+		if len(l.queue) == 0 {
+			g.active = slices.Delete(g.active, g.next, g.next+1)
+		} else {
+			g.next++
+		}
+	}
+}
+
+func (g *BandwidthGroup) tick() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.timer = nil
+	g.schedule()
+}
+
+func (l *groupLimiter) Burst() int {
+	l.g.mu.Lock()
+	defer l.g.mu.Unlock()
+	return l.g.burst
+}
+
+func (l *groupLimiter) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	g := l.g
+	g.mu.Lock()
+	if n > g.burst {
+		g.mu.Unlock()
+		return errors.New("extraio: WaitN exceeds limiter burst")
+	}
+	if len(g.active) == 0 {
+		g.refill(time.Now())
+		if g.tokens >= float64(n) {
+			g.tokens -= float64(n)
+			g.mu.Unlock()
+			return nil
+		}
+	}
+	if g.rate <= 0 {
+		g.mu.Unlock()
+		return errors.New("extraio: limiter rate is zero")
+	}
+	w := &groupWaiter{n: n, ready: make(chan struct{})}
+	l.queue = append(l.queue, w)
+	if len(l.queue) == 1 {
+		// Join the round just behind the limiter being served.
+		g.active = slices.Insert(g.active, g.next, l)
+		g.next++
+	}
+	g.schedule()
+	g.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if w.granted {
+		return nil
+	}
+	l.remove(w)
+	return ctx.Err()
+}
+
+// remove drops an abandoned waiter, g.mu must be held.
+func (l *groupLimiter) remove(w *groupWaiter) {
+	g := l.g
+	l.queue = slices.DeleteFunc(l.queue, func(q *groupWaiter) bool { return q == w })
+	if len(l.queue) > 0 {
+		g.schedule()
+		return
+	}
+	i := slices.Index(g.active, l)
+	g.active = slices.Delete(g.active, i, i+1)
+	if i < g.next {
+		g.next--
+	}
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.schedule()
+}
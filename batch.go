@@ -0,0 +1,229 @@
+package extraio
+
+import (
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// consumeBuffers drops the first n bytes of bufs, along with any
+// buffers left empty.
+func consumeBuffers(bufs [][]byte, n int) [][]byte {
+	for len(bufs) > 0 && n >= len(bufs[0]) {
+		n -= len(bufs[0])
+		bufs = bufs[1:]
+	}
+	if len(bufs) > 0 {
+		bufs[0] = bufs[0][n:]
+	}
+	return bufs
+}
+
+// writeBuffers writes all of bufs to w, with writev(2) when w, or the
+// stream under any metered wrappers of w, has a file descriptor. Metered
+// wrappers still count the bytes.
+func writeBuffers(w io.Writer, bufs [][]byte) (int64, error) {
+	nonEmpty := bufs[:0]
+	for _, b := range bufs {
+		if len(b) > 0 {
+			nonEmpty = append(nonEmpty, b)
+		}
+	}
+	bufs = nonEmpty
+	var counts []func(int64, error)
+	inner := w
+	for {
+		ms, ok := inner.(meteredSink)
+		if !ok {
+			break
+		}
+		counts = append(counts, ms.countWrite)
+		inner = ms.innerWriter()
+	}
+	if sc, ok := inner.(syscall.Conn); ok {
+		if n, handled, err := writev(sc, bufs); handled {
+			for _, c := range counts {
+				c(n, err)
+			}
+			return n, err
+		}
+	}
+	nb := net.Buffers(bufs)
+	return nb.WriteTo(w)
+}
+
+// BatchWriter collects small writes and passes them on to W together,
+// with a single writev(2) where W has a file descriptor, so protocols
+// making many small writes make far fewer syscalls. Held writes are sent
+// once MaxBytes are held, once the oldest has waited MaxDelay, once no
+// write has arrived for IdleDelay, or on Flush or Close. A write that does
+// not fit is sent along with the held data without being copied.
+//
+// Errors from sending are returned by the next Write, Flush or Close, and
+// after one the BatchWriter fails every call. It is safe for concurrent use.
+type BatchWriter struct {
+	W        io.Writer
+	MaxBytes int
+	// <= 0 holds writes until MaxBytes or a Flush.
+	MaxDelay time.Duration
+	// If > 0, held writes are also sent after this long without a write,
+	// so a request/response exchange never stalls for all of MaxDelay.
+	IdleDelay time.Duration
+	// Times the delays, SystemClock if nil.
+	Clock Clock
+
+	mu    sync.Mutex
+	held  []byte
+	timer Timer
+	// When the held data is due to be sent, zero if nothing is held.
+	due time.Time
+	// When the oldest held write arrived.
+	first time.Time
+	err   error
+	// Bytes written to W and the most held at once.
+	sent    int64
+	maxHeld int
+}
+
+// NewBatchWriter returns a BatchWriter holding up to maxBytes for up to
+// maxDelay, a maxBytes <= 0 uses 32KiB. Accepts WithIdleFlush and
+// WithClock.
+func NewBatchWriter(w io.Writer, maxBytes int, maxDelay time.Duration, opts ...Option) *BatchWriter {
+	o := applyOptions(opts, optClock|optIdleFlush, "NewBatchWriter")
+	if maxBytes <= 0 {
+		maxBytes = defaultBufSize
+	}
+	return &BatchWriter{
+		W:         w,
+		MaxBytes:  maxBytes,
+		MaxDelay:  maxDelay,
+		IdleDelay: o.idleFlush,
+		Clock:     o.clock,
+	}
+}
+
+func (bw *BatchWriter) clock() Clock {
+	if bw.Clock == nil {
+		return SystemClock
+	}
+	return bw.Clock
+}
+
+func (bw *BatchWriter) Write(p []byte) (int, error) {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	if bw.err != nil {
+		return 0, bw.err
+	}
+	if len(bw.held)+len(p) > bw.MaxBytes {
+		return bw.sendLocked(p)
+	}
+	if bw.held == nil {
+		bw.held = make([]byte, 0, bw.MaxBytes)
+	}
+	bw.held = append(bw.held, p...)
+	bw.maxHeld = maxInt(bw.maxHeld, len(bw.held))
+	if len(bw.held) == bw.MaxBytes {
+		_, err := bw.sendLocked(nil)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		bw.scheduleLocked(len(bw.held) == len(p))
+	}
+	return len(p), nil
+}
+
+// scheduleLocked sets the timer for the earlier of MaxDelay after the
+// oldest held write and IdleDelay after this one.
+func (bw *BatchWriter) scheduleLocked(first bool) {
+	now := bw.clock().Now()
+	if first {
+		bw.first = now
+	}
+	var due time.Time
+	if bw.MaxDelay > 0 {
+		due = bw.first.Add(bw.MaxDelay)
+	}
+	if idle := now.Add(bw.IdleDelay); bw.IdleDelay > 0 && (due.IsZero() || idle.Before(due)) {
+		due = idle
+	}
+	if due.IsZero() || due.Equal(bw.due) {
+		return
+	}
+	bw.due = due
+	if bw.timer == nil {
+		bw.timer = bw.clock().AfterFunc(due.Sub(now), bw.timedFlush)
+	} else {
+		bw.timer.Reset(due.Sub(now))
+	}
+}
+
+// sendLocked writes the held data followed by p, returning the bytes of
+// p written.
+func (bw *BatchWriter) sendLocked(p []byte) (int, error) {
+	if bw.timer != nil {
+		bw.timer.Stop()
+	}
+	bw.due = time.Time{}
+	held := len(bw.held)
+	n, err := writeBuffers(bw.W, [][]byte{bw.held, p})
+	bw.sent += n
+	bw.held = bw.held[:0]
+	if err != nil {
+		bw.err = err
+	}
+	return maxInt(int(n)-held, 0), err
+}
+
+func (bw *BatchWriter) timedFlush() {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	// The timer may have fired just as a write moved the due time on.
+	if bw.due.IsZero() || bw.clock().Now().Before(bw.due) {
+		return
+	}
+	if bw.err == nil && len(bw.held) > 0 {
+		bw.sendLocked(nil)
+	}
+}
+
+// Buffered returns the number of bytes held.
+func (bw *BatchWriter) Buffered() int {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return len(bw.held)
+}
+
+// Stats returns the bytes written to W as WriteCount, and the most that
+// were held at once.
+func (bw *BatchWriter) Stats() Stats {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return Stats{WriteCount: bw.sent, MaxBuffered: int64(bw.maxHeld)}
+}
+
+// Flush sends any held data now.
+func (bw *BatchWriter) Flush() error {
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	if bw.err != nil || len(bw.held) == 0 {
+		return bw.err
+	}
+	_, err := bw.sendLocked(nil)
+	return err
+}
+
+// Close flushes then closes W if it is an io.Closer, always closing even
+// if the flush fails.
+func (bw *BatchWriter) Close() error {
+	err := bw.Flush()
+	if c, ok := bw.W.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package extraio
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when Advance is called, firing due timers.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c      *fakeClock
+	at     time.Time
+	f      func()
+	active bool
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, at: c.now.Add(d), f: f, active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []func()
+	for _, t := range c.timers {
+		if t.active && !t.at.After(c.now) {
+			t.active = false
+			due = append(due, t.f)
+		}
+	}
+	c.mu.Unlock()
+	for _, f := range due {
+		f()
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	was := t.active
+	t.active = false
+	return was
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	was := t.active
+	t.active = true
+	t.at = t.c.now.Add(d)
+	return was
+}
+
+func TestBatchWriterIdleFlush(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var out bytes.Buffer
+	bw := NewBatchWriter(&out, 1024, time.Second, WithIdleFlush(10*time.Millisecond), WithClock(clock))
+	bw.Write([]byte("a"))
+	clock.Advance(6 * time.Millisecond)
+	bw.Write([]byte("b"))
+	clock.Advance(6 * time.Millisecond)
+	if out.Len() != 0 {
+		t.Fatalf("flushed %q before going idle", out.String())
+	}
+	clock.Advance(4 * time.Millisecond)
+	if out.String() != "ab" {
+		t.Fatalf("got %q after going idle, want \"ab\"", out.String())
+	}
+}
+
+func TestBatchWriterMaxDelay(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(0, 0)}
+	var out bytes.Buffer
+	bw := NewBatchWriter(&out, 1024, 100*time.Millisecond, WithIdleFlush(10*time.Millisecond), WithClock(clock))
+	// Writes never idle long enough, MaxDelay must still send them.
+	for i := 0; i < 20; i++ {
+		bw.Write([]byte("x"))
+		clock.Advance(6 * time.Millisecond)
+	}
+	if out.Len() == 0 {
+		t.Fatal("nothing sent after MaxDelay")
+	}
+}
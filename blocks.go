@@ -0,0 +1,190 @@
+package extraio
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+// Block framing used by BlockWriter and BlockReader, like the
+// chunks of Send but without its header or trailer:
+//
+//	block: length(uint32) data sum(data)
+//	end:   length 0
+//
+// All integers are big endian.
+const (
+	defaultBlockSize = 64 * 1024
+	maxBlockSize     = 16 << 20
+)
+
+func crc32c(data []byte) uint32 {
+	return crc32.Checksum(data, castagnoli)
+}
+
+// BlockWriter splits a stream into blocks of BlockSize, each followed by
+// a checksum, so a BlockReader at the other end of a pipeline can tell
+// exactly where data was corrupted. Close must be called to write the
+// final block and the end marker. NewBlockWriter must be used to create a
+// BlockWriter.
+type BlockWriter struct {
+	W io.Writer
+	// May be changed between writes, taking effect from the next block.
+	// Values <= 0 use 64KiB, those over 16MiB are capped.
+	BlockSize int
+	// Defaults to CRC-32C, another 32 bit checksum such as a truncated
+	// xxhash may be used if the reader uses the same one.
+	Sum func(data []byte) uint32
+
+	// length, data, room for the sum.
+	buf []byte
+	err error
+}
+
+// NewBlockWriter returns a BlockWriter with blocks of blockSize, a
+// blockSize <= 0 uses 64KiB.
+func NewBlockWriter(w io.Writer, blockSize int) *BlockWriter {
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+	blockSize = minInt(blockSize, maxBlockSize)
+	return &BlockWriter{
+		W:         w,
+		BlockSize: blockSize,
+		Sum:       crc32c,
+		buf:       make([]byte, 4, 4+blockSize+4),
+	}
+}
+
+func (bw *BlockWriter) Write(p []byte) (int, error) {
+	if bw.err != nil {
+		return 0, bw.err
+	}
+	full := bw.blockEnd()
+	written := 0
+	for len(p) > 0 {
+		if len(bw.buf) < full {
+			n := copy(bw.buf[len(bw.buf):full], p)
+			bw.buf = bw.buf[:len(bw.buf)+n]
+			written += n
+			p = p[n:]
+		}
+		// Also flushes what was buffered before BlockSize shrank.
+		if len(bw.buf) >= full {
+			if err := bw.Flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// blockEnd returns where the current BlockSize puts the end of a
+// block in buf, growing buf if it has no room for it and the sum.
+func (bw *BlockWriter) blockEnd() int {
+	size := bw.BlockSize
+	if size <= 0 {
+		size = defaultBlockSize
+	}
+	end := 4 + minInt(size, maxBlockSize)
+	if cap(bw.buf) < end+4 {
+		buf := make([]byte, maxInt(len(bw.buf), 4), end+4)
+		copy(buf, bw.buf)
+		bw.buf = buf
+	}
+	return end
+}
+
+// Flush writes any buffered data as a short block.
+func (bw *BlockWriter) Flush() error {
+	if bw.err != nil || len(bw.buf) == 4 {
+		return bw.err
+	}
+	data := bw.buf[4:]
+	binary.BigEndian.PutUint32(bw.buf[:4], uint32(len(data)))
+	bw.buf = binary.BigEndian.AppendUint32(bw.buf, bw.Sum(data))
+	if _, err := bw.W.Write(bw.buf); err != nil {
+		bw.err = err
+		return err
+	}
+	bw.buf = bw.buf[:4]
+	return nil
+}
+
+// Close flushes, writes the end marker and closes W if it is an
+// io.Closer, always closing even if the writes fail.
+func (bw *BlockWriter) Close() error {
+	err := bw.Flush()
+	if err == nil {
+		var end [4]byte
+		if _, err = bw.W.Write(end[:]); err != nil {
+			bw.err = err
+		}
+	}
+	if c, ok := bw.W.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// BlockReader reads a stream written by a BlockWriter, verifying each
+// block before returning any of it. A corrupt block is reported as a
+// *ChecksumError with the stream offset of the block. A stream ending
+// without the end marker gives io.ErrUnexpectedEOF.
+type BlockReader struct {
+	R io.Reader
+	// Must match the writer's, defaults to CRC-32C.
+	Sum func(data []byte) uint32
+
+	buf  []byte
+	data []byte
+	off  int64
+	err  error
+}
+
+func NewBlockReader(r io.Reader) *BlockReader {
+	return &BlockReader{R: r, Sum: crc32c}
+}
+
+func (br *BlockReader) Read(p []byte) (int, error) {
+	for len(br.data) == 0 {
+		if br.err != nil {
+			return 0, br.err
+		}
+		br.err = br.next()
+	}
+	n := copy(p, br.data)
+	br.data = br.data[n:]
+	return n, nil
+}
+
+// next reads and verifies the next block into data.
+func (br *BlockReader) next() error {
+	var lenbuf [4]byte
+	if _, err := io.ReadFull(br.R, lenbuf[:]); err != nil {
+		return noEOF(err)
+	}
+	n := binary.BigEndian.Uint32(lenbuf[:])
+	if n == 0 {
+		return io.EOF
+	}
+	if n > maxBlockSize {
+		return ErrBadTransfer
+	}
+	if cap(br.buf) < int(n)+4 {
+		br.buf = make([]byte, n+4)
+	}
+	buf := br.buf[:n+4]
+	if _, err := io.ReadFull(br.R, buf); err != nil {
+		return noEOF(err)
+	}
+	data := buf[:n]
+	if br.Sum(data) != binary.BigEndian.Uint32(buf[n:]) {
+		return &ChecksumError{Offset: br.off}
+	}
+	br.data = data
+	br.off += int64(n)
+	return nil
+}
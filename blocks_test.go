@@ -0,0 +1,47 @@
+package extraio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestBlockWriterBlockSizeChange(t *testing.T) {
+	var out bytes.Buffer
+	bw := NewBlockWriter(&out, 16)
+	data := bytes.Repeat([]byte("0123456789"), 10)
+	bw.Write(data[:40])
+	bw.BlockSize = 32
+	bw.Write(data[40:])
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var sizes []int
+	for b := out.Bytes(); ; {
+		n := int(binary.BigEndian.Uint32(b))
+		if n == 0 {
+			break
+		}
+		sizes = append(sizes, n)
+		b = b[4+n+4:]
+	}
+	want := []int{16, 16, 32, 32, 4}
+	if len(sizes) != len(want) {
+		t.Fatalf("block sizes %v, want %v", sizes, want)
+	}
+	for i := range want {
+		if sizes[i] != want[i] {
+			t.Fatalf("block sizes %v, want %v", sizes, want)
+		}
+	}
+
+	got, err := io.ReadAll(NewBlockReader(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+}
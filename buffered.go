@@ -0,0 +1,67 @@
+package extraio
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// BufferedReadWriteCloser buffers both directions of an io.ReadWriteCloser.
+// Close flushes buffered writes before closing the underlying stream.
+type BufferedReadWriteCloser struct {
+	RWC io.ReadWriteCloser
+	R   *bufio.Reader
+	W   *bufio.Writer
+
+	readGuard  misuseGuard
+	writeGuard misuseGuard
+}
+
+// NewBufferedReadWriteCloser returns rwc buffered with the given sizes,
+// a size <= 0 uses the bufio default.
+func NewBufferedReadWriteCloser(rwc io.ReadWriteCloser, readSize, writeSize int) *BufferedReadWriteCloser {
+	if readSize <= 0 {
+		readSize = 4096
+	}
+	if writeSize <= 0 {
+		writeSize = 4096
+	}
+	return &BufferedReadWriteCloser{
+		RWC: rwc,
+		R:   bufio.NewReaderSize(rwc, readSize),
+		W:   bufio.NewWriterSize(rwc, writeSize),
+	}
+}
+
+func (b *BufferedReadWriteCloser) Read(buf []byte) (int, error) {
+	b.readGuard.enter("BufferedReadWriteCloser read")
+	defer b.readGuard.exit()
+	return b.R.Read(buf)
+}
+
+func (b *BufferedReadWriteCloser) Peek(n int) ([]byte, error) {
+	b.readGuard.enter("BufferedReadWriteCloser read")
+	defer b.readGuard.exit()
+	return b.R.Peek(n)
+}
+
+func (b *BufferedReadWriteCloser) Write(buf []byte) (int, error) {
+	b.writeGuard.enter("BufferedReadWriteCloser write")
+	defer b.writeGuard.exit()
+	return b.W.Write(buf)
+}
+
+func (b *BufferedReadWriteCloser) Flush() error {
+	b.writeGuard.enter("BufferedReadWriteCloser write")
+	defer b.writeGuard.exit()
+	return b.W.Flush()
+}
+
+// Close flushes then closes, always closing even if the flush fails.
+func (b *BufferedReadWriteCloser) Close() error {
+	b.writeGuard.enter("BufferedReadWriteCloser write")
+	defer b.writeGuard.exit()
+	ferr := b.W.Flush()
+	cerr := b.RWC.Close()
+	return errors.Join(ferr, cerr)
+}
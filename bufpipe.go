@@ -0,0 +1,308 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// bufferedPipe is the state shared by the two halves of a BufferedPipe.
+type bufferedPipe struct {
+	mu    sync.Mutex
+	cond  sync.Cond
+	buf   []byte
+	start int
+	n     int
+	// Totals and the high watermark of n.
+	readCount   int64
+	writeCount  int64
+	maxBuffered int
+	// Set once the respective half is closed.
+	rerr error
+	werr error
+	// The reader closed with data unread.
+	discarded bool
+	// The largest the buffer may grow to, <= len(buf) when not tuned.
+	maxSize int
+	created time.Time
+}
+
+// BufferedPipe is like io.Pipe but writes only block while size bytes
+// are already buffered, so the writer can run ahead of the reader.
+// Writes larger than the buffer are delivered in pieces.
+//
+// With WithAutoTune the buffer starts at size and, each time the writer
+// has waited for room, grows to cover the throughput so far times that
+// wait, the bandwidth-delay product of the reader. It never shrinks.
+func BufferedPipe(size int, opts ...Option) (*BufferedPipeReader, *BufferedPipeWriter) {
+	o := applyOptions(opts, optAutoTune, "BufferedPipe")
+	if size <= 0 {
+		size = defaultBufSize
+	}
+	p := &bufferedPipe{
+		buf:     make([]byte, size),
+		maxSize: o.autoTuneMax,
+		created: time.Now(),
+	}
+	p.cond.L = &p.mu
+	return &BufferedPipeReader{p}, &BufferedPipeWriter{p}
+}
+
+// BufferedSocketPair is SocketPair built from two BufferedPipes
+// of size bytes, one per direction. Accepts WithAutoTune.
+func BufferedSocketPair(size int, opts ...Option) (io.ReadWriteCloser, io.ReadWriteCloser) {
+	ar, aw := BufferedPipe(size, opts...)
+	br, bw := BufferedPipe(size, opts...)
+	return &MergedReadWriteCloser{
+		RC: ar,
+		WC: bw,
+	}, &MergedReadWriteCloser{
+		RC: br,
+		WC: aw,
+	}
+}
+
+func (p *bufferedPipe) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if p.rerr != nil {
+			return 0, io.ErrClosedPipe
+		}
+		if p.n > 0 || len(b) == 0 {
+			break
+		}
+		if p.werr != nil {
+			return 0, p.werr
+		}
+		p.cond.Wait()
+	}
+	read := 0
+	for read < len(b) && p.n > 0 {
+		end := minInt(p.start+p.n, len(p.buf))
+		c := copy(b[read:], p.buf[p.start:end])
+		read += c
+		p.n -= c
+		p.start = (p.start + c) % len(p.buf)
+	}
+	p.readCount += int64(read)
+	if p.n == 0 {
+		p.start = 0
+	}
+	p.cond.Broadcast()
+	return read, nil
+}
+
+func (p *bufferedPipe) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	written := 0
+	for written < len(b) {
+		if p.werr != nil {
+			return written, io.ErrClosedPipe
+		}
+		if p.rerr != nil {
+			return written, p.rerr
+		}
+		if p.n == len(p.buf) {
+			start := time.Now()
+			for p.n == len(p.buf) && p.werr == nil && p.rerr == nil {
+				p.cond.Wait()
+			}
+			p.tune(time.Since(start))
+			continue
+		}
+		end := (p.start + p.n) % len(p.buf)
+		limit := len(p.buf)
+		if end < p.start {
+			limit = p.start
+		}
+		c := copy(p.buf[end:limit], b[written:])
+		written += c
+		p.n += c
+		p.writeCount += int64(c)
+		p.maxBuffered = maxInt(p.maxBuffered, p.n)
+		p.cond.Broadcast()
+	}
+	return written, nil
+}
+
+// tune grows the buffer to hold what arrives at the throughput so far
+// while the writer waited for the reader.
+func (p *bufferedPipe) tune(waited time.Duration) {
+	size := len(p.buf)
+	if size >= p.maxSize {
+		return
+	}
+	elapsed := time.Since(p.created).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	bdp := float64(p.readCount) / elapsed * waited.Seconds()
+	for size < p.maxSize && float64(size) < bdp {
+		size *= 2
+	}
+	size = minInt(size, p.maxSize)
+	if size == len(p.buf) {
+		return
+	}
+	buf := make([]byte, size)
+	n := copy(buf, p.buf[p.start:minInt(p.start+p.n, len(p.buf))])
+	copy(buf[n:], p.buf[:p.n-n])
+	p.buf = buf
+	p.start = 0
+}
+
+func (p *bufferedPipe) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.buf)
+}
+
+func (p *bufferedPipe) buffered() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.n
+}
+
+func (p *bufferedPipe) stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{
+		ReadCount:   p.readCount,
+		WriteCount:  p.writeCount,
+		MaxBuffered: int64(p.maxBuffered),
+	}
+}
+
+// BufferedPipeReader is the read half of a BufferedPipe.
+type BufferedPipeReader struct {
+	p *bufferedPipe
+}
+
+// Read blocks until data is buffered or the writer closes, buffered data
+// is still returned after the writer closes.
+func (r *BufferedPipeReader) Read(b []byte) (int, error) {
+	return r.p.read(b)
+}
+
+// Buffered returns the number of bytes waiting to be read.
+func (r *BufferedPipeReader) Buffered() int {
+	return r.p.buffered()
+}
+
+// Size returns the capacity of the buffer, as chosen by WithAutoTune.
+func (r *BufferedPipeReader) Size() int {
+	return r.p.size()
+}
+
+// Stats returns the bytes read and written so far, and the most that
+// were buffered at once. A MaxBuffered close to the pipe's size means
+// the reader is falling behind.
+func (r *BufferedPipeReader) Stats() Stats {
+	return r.p.stats()
+}
+
+func (r *BufferedPipeReader) Close() error {
+	return r.CloseWithError(nil)
+}
+
+// CloseWithError makes writes fail with err, or io.ErrClosedPipe if err is nil.
+// Buffered data is discarded.
+func (r *BufferedPipeReader) CloseWithError(err error) error {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	r.p.mu.Lock()
+	defer r.p.mu.Unlock()
+	if r.p.rerr == nil {
+		r.p.rerr = err
+		r.p.discarded = r.p.n > 0
+		r.p.n = 0
+		r.p.cond.Broadcast()
+	}
+	return nil
+}
+
+// BufferedPipeWriter is the write half of a BufferedPipe.
+type BufferedPipeWriter struct {
+	p *bufferedPipe
+}
+
+// Write blocks only while the buffer is full.
+func (w *BufferedPipeWriter) Write(b []byte) (int, error) {
+	return w.p.write(b)
+}
+
+// Buffered returns the number of bytes written but not yet read.
+func (w *BufferedPipeWriter) Buffered() int {
+	return w.p.buffered()
+}
+
+// Size is the same as the reader's.
+func (w *BufferedPipeWriter) Size() int {
+	return w.p.size()
+}
+
+// Stats is the same as the reader's.
+func (w *BufferedPipeWriter) Stats() Stats {
+	return w.p.stats()
+}
+
+// Drain waits until the reader has consumed everything written so far
+// or closed, or ctx is done.
+func (w *BufferedPipeWriter) Drain(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() {
+		w.p.mu.Lock()
+		w.p.cond.Broadcast()
+		w.p.mu.Unlock()
+	})
+	defer stop()
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	for w.p.n > 0 && w.p.rerr == nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		w.p.cond.Wait()
+	}
+	return nil
+}
+
+// Close makes reads return io.EOF once the buffer is empty.
+func (w *BufferedPipeWriter) Close() error {
+	return w.CloseWithError(nil)
+}
+
+// CloseDrain is Close followed by Drain, so that when it returns nil
+// the reader has consumed everything written. It returns ctx.Err() if
+// ctx is done first, and the reader's error if the reader closed with
+// data unread.
+func (w *BufferedPipeWriter) CloseDrain(ctx context.Context) error {
+	w.Close()
+	if err := w.Drain(ctx); err != nil {
+		return err
+	}
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	if w.p.discarded {
+		return w.p.rerr
+	}
+	return nil
+}
+
+// CloseWithError makes reads return err once the buffer
+// is empty, or io.EOF if err is nil.
+func (w *BufferedPipeWriter) CloseWithError(err error) error {
+	if err == nil {
+		err = io.EOF
+	}
+	w.p.mu.Lock()
+	defer w.p.mu.Unlock()
+	if w.p.werr == nil {
+		w.p.werr = err
+		w.p.cond.Broadcast()
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package extraio
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+// pauseReader reads n bytes from r as fast as it can, then stops for
+// pause before reading the rest.
+func pauseReader(t *testing.T, r io.Reader, n int, pause time.Duration) []byte {
+	t.Helper()
+	first := make([]byte, n)
+	if _, err := io.ReadFull(r, first); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(pause)
+	rest, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(first, rest...)
+}
+
+func TestBufferedPipeAutoTune(t *testing.T) {
+	const size, max = 1024, 256 * 1024
+	data := bytes.Repeat([]byte("0123456789abcdef"), 256*1024/16)
+	for _, tune := range []bool{false, true} {
+		var opts []Option
+		if tune {
+			opts = append(opts, WithAutoTune(max))
+		}
+		pr, pw := BufferedPipe(size, opts...)
+		go func() {
+			pw.Write(data)
+			pw.Close()
+		}()
+		got := pauseReader(t, pr, len(data)/2, 50*time.Millisecond)
+		if !bytes.Equal(got, data) {
+			t.Fatal("data mismatch")
+		}
+		switch n := pr.Size(); {
+		case !tune && n != size:
+			t.Fatalf("size %d without WithAutoTune, want %d", n, size)
+		case tune && (n <= size || n > max):
+			t.Fatalf("tuned size %d, want more than %d up to %d", n, size, max)
+		}
+	}
+}
+
+func TestBufferedPipeCloseDrain(t *testing.T) {
+	pr, pw := BufferedPipe(64)
+	pw.Write([]byte("hello"))
+	done := make(chan error, 1)
+	go func() { done <- pw.CloseDrain(context.Background()) }()
+	select {
+	case err := <-done:
+		t.Fatalf("CloseDrain returned %v before the data was read", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	got, err := io.ReadAll(pr)
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("read %q, %v", got, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader closing with data unread is reported.
+	pr, pw = BufferedPipe(64)
+	pw.Write([]byte("lost"))
+	pr.Close()
+	if err := pw.CloseDrain(context.Background()); err != io.ErrClosedPipe {
+		t.Fatalf("CloseDrain after data discarded: %v, want io.ErrClosedPipe", err)
+	}
+
+	// As is giving up.
+	_, pw = BufferedPipe(64)
+	pw.Write([]byte("stuck"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pw.CloseDrain(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("CloseDrain with no reader: %v, want context.DeadlineExceeded", err)
+	}
+}
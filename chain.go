@@ -0,0 +1,97 @@
+package extraio
+
+import (
+	"io"
+	"net"
+	"reflect"
+)
+
+// ConnLayer wraps a net.Conn, e.g. func(c net.Conn) net.Conn { return NewMeteredConn(c) }.
+type ConnLayer func(net.Conn) net.Conn
+
+// ConnChain is a list of layers, the first layer is applied
+// directly to the base conn and the last ends up outermost.
+type ConnChain []ConnLayer
+
+// Apply wraps c with each layer in order.
+func (ch ConnChain) Apply(c net.Conn) *ConnStack {
+	layers := make([]net.Conn, 0, len(ch)+1)
+	layers = append(layers, c)
+	for _, l := range ch {
+		c = l(c)
+		layers = append(layers, c)
+	}
+	return &ConnStack{Layers: layers}
+}
+
+// ConnStack is the result of ConnChain.Apply,
+// Layers[0] is the base conn and the last entry the outermost wrapper.
+type ConnStack struct {
+	Layers []net.Conn
+}
+
+// Conn returns the outermost conn.
+func (s *ConnStack) Conn() net.Conn {
+	return s.Layers[len(s.Layers)-1]
+}
+
+// As sets target to the outermost layer assignable to it, in the manner of
+// errors.As, e.g. var m *MeteredConn; stack.As(&m).
+func (s *ConnStack) As(target interface{}) bool {
+	for i := len(s.Layers) - 1; i >= 0; i-- {
+		if setAs(s.Layers[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+// Layer wraps an io.ReadWriteCloser.
+type Layer func(io.ReadWriteCloser) io.ReadWriteCloser
+
+// Chain is the io.ReadWriteCloser equivalent of ConnChain.
+type Chain []Layer
+
+// Apply wraps rwc with each layer in order.
+func (ch Chain) Apply(rwc io.ReadWriteCloser) *Stack {
+	layers := make([]io.ReadWriteCloser, 0, len(ch)+1)
+	layers = append(layers, rwc)
+	for _, l := range ch {
+		rwc = l(rwc)
+		layers = append(layers, rwc)
+	}
+	return &Stack{Layers: layers}
+}
+
+// Stack is the io.ReadWriteCloser equivalent of ConnStack.
+type Stack struct {
+	Layers []io.ReadWriteCloser
+}
+
+// ReadWriteCloser returns the outermost layer.
+func (s *Stack) ReadWriteCloser() io.ReadWriteCloser {
+	return s.Layers[len(s.Layers)-1]
+}
+
+// As sets target to the outermost layer assignable to it, see ConnStack.As.
+func (s *Stack) As(target interface{}) bool {
+	for i := len(s.Layers) - 1; i >= 0; i-- {
+		if setAs(s.Layers[i], target) {
+			return true
+		}
+	}
+	return false
+}
+
+func setAs(v interface{}, target interface{}) bool {
+	val := reflect.ValueOf(target)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		panic("extraio: target must be a non-nil pointer")
+	}
+	elem := val.Elem()
+	if v == nil || !reflect.TypeOf(v).AssignableTo(elem.Type()) {
+		return false
+	}
+	elem.Set(reflect.ValueOf(v))
+	return true
+}
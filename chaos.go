@@ -0,0 +1,45 @@
+package extraio
+
+import (
+	"io"
+	"math/rand/v2"
+)
+
+// ChaosReader fragments reads from R into small random pieces, often a
+// single byte and sometimes none at all, to shake out code assuming Read
+// fills its buffer. It never returns two empty reads in a row, so callers
+// treating repeated empty reads as io.ErrNoProgress still work.
+type ChaosReader struct {
+	R io.Reader
+	// Largest piece returned by one Read, default 16.
+	MaxChunk int
+
+	rng       *rand.Rand
+	lastEmpty bool
+}
+
+// Accepts WithSeed.
+func NewChaosReader(r io.Reader, opts ...Option) *ChaosReader {
+	o := applyOptions(opts, optSeed, "NewChaosReader")
+	return &ChaosReader{R: r, rng: o.rng()}
+}
+
+func (cr *ChaosReader) Read(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return cr.R.Read(buf)
+	}
+	if !cr.lastEmpty && cr.rng.IntN(8) == 0 {
+		cr.lastEmpty = true
+		return 0, nil
+	}
+	cr.lastEmpty = false
+	max := cr.MaxChunk
+	if max <= 0 {
+		max = 16
+	}
+	n := 1
+	if cr.rng.IntN(4) != 0 {
+		n = 1 + cr.rng.IntN(max)
+	}
+	return cr.R.Read(buf[:min(n, len(buf))])
+}
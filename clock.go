@@ -0,0 +1,30 @@
+package extraio
+
+import "time"
+
+// Clock is the source of time for wrappers that schedule work, such as
+// BatchWriter's flushes, so tests can drive them with a fake clock.
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f on its own goroutine after d, like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a timer made by a Clock, *time.Timer implements it.
+type Timer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// SystemClock is the Clock used when none is given.
+var SystemClock Clock = realClock{}
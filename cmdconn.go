@@ -0,0 +1,79 @@
+package extraio
+
+import (
+	"net"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// cmdAddr identifies one end of a CmdConn.
+type cmdAddr string
+
+func (cmdAddr) Network() string  { return "cmd" }
+func (a cmdAddr) String() string { return string(a) }
+
+// CmdConn is a net.Conn over a command's stdin and stdout, such as
+// an ssh or proxy command used as a transport. Its remote address is
+// the command line and its local address the command's pid.
+// Deadlines are implemented by a ConnAdapter and Close reaps the process.
+type CmdConn struct {
+	Stream *CmdStream
+	conn   *ConnAdapter
+}
+
+// StartCmdConn starts cmd as in StartCmdReadWriteCloser,
+// accepting the same options.
+func StartCmdConn(cmd *exec.Cmd, opts ...Option) (*CmdConn, error) {
+	cs, err := StartCmdReadWriteCloser(cmd, opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn := NewConnAdapter(cs)
+	conn.Local = cmdAddr("pid " + strconv.Itoa(cmd.Process.Pid))
+	conn.Remote = cmdAddr(cmd.String())
+	return &CmdConn{Stream: cs, conn: conn}, nil
+}
+
+func (cc *CmdConn) Read(buf []byte) (int, error) {
+	return cc.conn.Read(buf)
+}
+
+func (cc *CmdConn) Write(buf []byte) (int, error) {
+	return cc.conn.Write(buf)
+}
+
+// Close reaps the command as CmdStream.Close does, returning its Wait error.
+func (cc *CmdConn) Close() error {
+	return cc.conn.Close()
+}
+
+// CloseWrite closes the command's stdin.
+func (cc *CmdConn) CloseWrite() error {
+	return cc.Stream.CloseWrite()
+}
+
+func (cc *CmdConn) LocalAddr() net.Addr {
+	return cc.conn.LocalAddr()
+}
+
+func (cc *CmdConn) RemoteAddr() net.Addr {
+	return cc.conn.RemoteAddr()
+}
+
+func (cc *CmdConn) SetDeadline(t time.Time) error {
+	return cc.conn.SetDeadline(t)
+}
+
+func (cc *CmdConn) SetReadDeadline(t time.Time) error {
+	return cc.conn.SetReadDeadline(t)
+}
+
+func (cc *CmdConn) SetWriteDeadline(t time.Time) error {
+	return cc.conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the ConnAdapter over Stream.
+func (cc *CmdConn) NetConn() net.Conn {
+	return cc.conn
+}
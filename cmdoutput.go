@@ -0,0 +1,158 @@
+package extraio
+
+import (
+	"bufio"
+	"io"
+	"os/exec"
+	"sync"
+)
+
+// Source identifies which output of a command a chunk came from.
+type Source int
+
+const (
+	Stdout Source = iota + 1
+	Stderr
+)
+
+func (s Source) String() string {
+	switch s {
+	case Stdout:
+		return "stdout"
+	case Stderr:
+		return "stderr"
+	default:
+		return "unknown"
+	}
+}
+
+// OutputChunk is a piece of output from one of a command's streams.
+type OutputChunk struct {
+	Source Source
+	Data   []byte
+}
+
+// CmdOutput interleaves a command's stdout and stderr in the order
+// they are read from the OS pipes, keeping track of the source of each chunk.
+type CmdOutput struct {
+	cmd     *exec.Cmd
+	chunks  chan OutputChunk
+	wg      sync.WaitGroup
+	pending []byte
+
+	mu     sync.Mutex
+	errs   []error
+	waited bool
+}
+
+// StartCmdOutput starts cmd with its stdout and stderr captured.
+// With WithLines each chunk is a single line, including its newline
+// except possibly for a final unterminated line.
+// Accepts WithExtraFiles, WithCloseInherited and WithFDCheck.
+func StartCmdOutput(cmd *exec.Cmd, opts ...Option) (*CmdOutput, error) {
+	o := applyOptions(opts, optLines|optCmdFDs, "StartCmdOutput")
+	if err := prepareCmdFDs(cmd, &o); err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	out := &CmdOutput{
+		cmd:    cmd,
+		chunks: make(chan OutputChunk),
+	}
+	out.wg.Add(2)
+	go out.pump(Stdout, stdout, o.lines)
+	go out.pump(Stderr, stderr, o.lines)
+	go func() {
+		out.wg.Wait()
+		close(out.chunks)
+	}()
+	return out, nil
+}
+
+func (out *CmdOutput) pump(src Source, r io.Reader, lines bool) {
+	defer out.wg.Done()
+	var err error
+	if lines {
+		br := bufio.NewReader(r)
+		for {
+			var line []byte
+			line, err = br.ReadBytes('\n')
+			if len(line) > 0 {
+				out.chunks <- OutputChunk{Source: src, Data: line}
+			}
+			if err != nil {
+				break
+			}
+		}
+	} else {
+		for {
+			buf := make([]byte, 4096)
+			var n int
+			n, err = r.Read(buf)
+			if n > 0 {
+				out.chunks <- OutputChunk{Source: src, Data: buf[:n]}
+			}
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != io.EOF {
+		out.mu.Lock()
+		out.errs = append(out.errs, err)
+		out.mu.Unlock()
+	}
+}
+
+// ReadChunk returns the next chunk of output,
+// or io.EOF once both streams are closed.
+func (out *CmdOutput) ReadChunk() (OutputChunk, error) {
+	c, ok := <-out.chunks
+	if !ok {
+		out.mu.Lock()
+		defer out.mu.Unlock()
+		if len(out.errs) != 0 {
+			return OutputChunk{}, out.errs[0]
+		}
+		return OutputChunk{}, io.EOF
+	}
+	return c, nil
+}
+
+// Read returns the merged output without source information.
+func (out *CmdOutput) Read(buf []byte) (int, error) {
+	for len(out.pending) == 0 {
+		c, err := out.ReadChunk()
+		if err != nil {
+			return 0, err
+		}
+		out.pending = c.Data
+	}
+	n := copy(buf, out.pending)
+	out.pending = out.pending[n:]
+	return n, nil
+}
+
+// Wait discards any unread output and waits for the command to exit.
+func (out *CmdOutput) Wait() error {
+	for range out.chunks {
+	}
+	out.mu.Lock()
+	if out.waited {
+		out.mu.Unlock()
+		return nil
+	}
+	out.waited = true
+	out.mu.Unlock()
+	return out.cmd.Wait()
+}
@@ -0,0 +1,147 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+const defaultGrace = 5 * time.Second
+
+// CmdStream is a running command, reads come from its stdout
+// and writes go to its stdin. Close reaps the process.
+type CmdStream struct {
+	Cmd *exec.Cmd
+	// How long Close waits for the command to exit after closing its
+	// stdin before killing it.
+	Grace time.Duration
+
+	stdin  *os.File
+	stdout *os.File
+
+	closeOnce sync.Once
+	waitErr   error
+
+	stderr     *PrefixSuffixSaver
+	stderrSync *SyncWriter
+	// Unregisters the WithContext callback.
+	stop func() bool
+}
+
+// StartCmdReadWriteCloser starts cmd with its stdin and stdout connected
+// to the returned CmdStream. stderr is discarded unless WithStderr is
+// given. Accepts WithStderr, WithStderrCapture, WithContext, WithGrace,
+// WithExtraFiles, WithCloseInherited and WithFDCheck.
+func StartCmdReadWriteCloser(cmd *exec.Cmd, opts ...Option) (*CmdStream, error) {
+	o := applyOptions(opts, optCmd, "StartCmdReadWriteCloser")
+	if err := prepareCmdFDs(cmd, &o); err != nil {
+		return nil, err
+	}
+	stdinR, stdinW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	stdoutR, stdoutW, err := os.Pipe()
+	if err != nil {
+		stdinR.Close()
+		stdinW.Close()
+		return nil, err
+	}
+	cmd.Stdin = stdinR
+	cmd.Stdout = stdoutW
+	cs := &CmdStream{Cmd: cmd}
+	cmd.Stderr = io.Discard
+	if o.stderr != nil {
+		cmd.Stderr = o.stderr
+	}
+	if o.stderrCapture > 0 {
+		cs.stderr = &PrefixSuffixSaver{N: o.stderrCapture}
+		cs.stderrSync = NewSyncWriter(cs.stderr)
+		cmd.Stderr = cs.stderrSync
+		if o.stderr != nil {
+			cmd.Stderr = io.MultiWriter(o.stderr, cs.stderrSync)
+		}
+	}
+	grace := defaultGrace
+	if o.grace > 0 {
+		grace = o.grace
+	}
+	// Do not let descendants holding stderr open stall Wait forever.
+	if cmd.WaitDelay == 0 {
+		cmd.WaitDelay = grace
+	}
+	err = cmd.Start()
+	stdinR.Close()
+	stdoutW.Close()
+	if err != nil {
+		stdinW.Close()
+		stdoutR.Close()
+		return nil, err
+	}
+	cs.Grace = grace
+	cs.stdin = stdinW
+	cs.stdout = stdoutR
+	if o.ctx != nil {
+		cs.stop = context.AfterFunc(o.ctx, func() { _ = cs.close() })
+	}
+	return cs, nil
+}
+
+func (cs *CmdStream) Read(buf []byte) (int, error) {
+	return cs.stdout.Read(buf)
+}
+
+func (cs *CmdStream) Write(buf []byte) (int, error) {
+	return cs.stdin.Write(buf)
+}
+
+// CloseWrite closes the command's stdin.
+func (cs *CmdStream) CloseWrite() error {
+	return cs.stdin.Close()
+}
+
+// Close closes the command's stdin, waits up to Grace for it to exit,
+// kills it if it has not, and returns the error from Wait.
+// Later calls return the same error.
+func (cs *CmdStream) Close() error {
+	if cs.stop != nil {
+		cs.stop()
+	}
+	return cs.close()
+}
+
+func (cs *CmdStream) close() error {
+	cs.closeOnce.Do(func() {
+		cs.stdin.Close()
+		waitc := make(chan error, 1)
+		go func() {
+			waitc <- cs.Cmd.Wait()
+		}()
+		t := time.NewTimer(cs.Grace)
+		defer t.Stop()
+		select {
+		case cs.waitErr = <-waitc:
+		case <-t.C:
+			_ = cs.Cmd.Process.Kill()
+			cs.waitErr = <-waitc
+		}
+		cs.stdout.Close()
+	})
+	return cs.waitErr
+}
+
+// Stderr returns the start and end of the command's stderr as captured
+// with WithStderrCapture, complete once Close has returned.
+func (cs *CmdStream) Stderr() []byte {
+	if cs.stderr == nil {
+		return nil
+	}
+	var out []byte
+	cs.stderrSync.Do(func() {
+		out = append([]byte(nil), cs.stderr.Bytes()...)
+	})
+	return out
+}
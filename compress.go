@@ -0,0 +1,292 @@
+package extraio
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CompressWriter is a streaming compressor, Flush must write out
+// everything written so far.
+type CompressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// Compressor is a compression format a CompressedConn can negotiate.
+// flate and gzip are built in, building with the extraio_s2 tag adds s2
+// and snappy, and the extraio_zstd tag zstd. Others can be added with
+// RegisterCompressor.
+type Compressor struct {
+	Name string
+	// level is from WithCompression, or flate.DefaultCompression.
+	NewWriter func(w io.Writer, level int) (CompressWriter, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	compressorsMu sync.Mutex
+	compressors   = []Compressor{
+		{
+			Name: "gzip",
+			NewWriter: func(w io.Writer, level int) (CompressWriter, error) {
+				return gzip.NewWriterLevel(w, level)
+			},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return gzip.NewReader(r)
+			},
+		},
+		{
+			Name: "flate",
+			NewWriter: func(w io.Writer, level int) (CompressWriter, error) {
+				return flate.NewWriter(w, level)
+			},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return flate.NewReader(r), nil
+			},
+		},
+	}
+)
+
+// RegisterCompressor adds c, or replaces the compressor of the same name.
+// By default a CompressedConn prefers the most recently registered.
+func RegisterCompressor(c Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	for i := range compressors {
+		if compressors[i].Name == c.Name {
+			compressors[i] = c
+			return
+		}
+	}
+	compressors = append(compressors, c)
+}
+
+func lookupCompressor(name string) (Compressor, bool) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	for _, c := range compressors {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Compressor{}, false
+}
+
+// Hello messages are "XIOC" count(1) then count names, each length(1) name.
+var compressMagic = []byte("XIOC")
+
+const compressMaxCodecs = 32
+
+// CompressedConn compresses each direction of Conn with a format both
+// ends support, negotiated when it is created. Every Write is flushed
+// through the compressor, so interactive protocols never stall waiting
+// for a compressor's buffer to fill.
+//
+// Stats reports the uncompressed bytes and WireStats the compressed
+// bytes, their ratio being the saving. Metered wrappers and Registry
+// report both when layered over a CompressedConn.
+type CompressedConn struct {
+	Conn net.Conn
+	// The formats chosen for each direction, empty if none was common.
+	SendCodec string
+	RecvCodec string
+
+	wire *MeteredConn
+	recv Compressor
+
+	rmu sync.Mutex
+	r   io.Reader
+	rc  io.ReadCloser
+
+	wmu sync.Mutex
+	w   io.Writer
+	cw  CompressWriter
+
+	readCount  atomic.Int64
+	writeCount atomic.Int64
+}
+
+// NewCompressedConn negotiates with a peer doing the same over c, each
+// side compressing what it sends with the first of its formats the other
+// also offers. It accepts WithCodecs and WithCompression, whose level is
+// given to the compressor. If negotiation fails the caller should close c.
+func NewCompressedConn(c net.Conn, opts ...Option) (*CompressedConn, error) {
+	o := applyOptions(opts, optCompression|optCodecs, "NewCompressedConn")
+	level := flate.DefaultCompression
+	if o.compress {
+		level = o.compressLevel
+	}
+	offer := o.codecs
+	if offer == nil {
+		compressorsMu.Lock()
+		for i := len(compressors) - 1; i >= 0; i-- {
+			offer = append(offer, compressors[i].Name)
+		}
+		compressorsMu.Unlock()
+	}
+	hello := append([]byte(nil), compressMagic...)
+	hello = append(hello, byte(minInt(len(offer), compressMaxCodecs)))
+	for _, name := range offer[:minInt(len(offer), compressMaxCodecs)] {
+		if len(name) > 255 {
+			return nil, errors.New("extraio: codec name too long")
+		}
+		hello = append(hello, byte(len(name)))
+		hello = append(hello, name...)
+	}
+
+	// Both peers write first, so write concurrently in
+	// case c is unbuffered.
+	werr := make(chan error, 1)
+	go func() {
+		_, err := c.Write(hello)
+		werr <- err
+	}()
+	peerOffer, err := readCodecHello(c)
+	if err != nil {
+		return nil, err
+	}
+	if err := <-werr; err != nil {
+		return nil, err
+	}
+
+	cc := &CompressedConn{
+		Conn:      c,
+		SendCodec: firstCommon(offer, peerOffer),
+		RecvCodec: firstCommon(peerOffer, offer),
+		wire:      NewMeteredConn(c),
+	}
+	cc.r, cc.w = cc.wire, cc.wire
+	if cc.SendCodec != "" {
+		comp, ok := lookupCompressor(cc.SendCodec)
+		if !ok {
+			return nil, errors.New("extraio: unregistered codec " + cc.SendCodec)
+		}
+		if cc.cw, err = comp.NewWriter(cc.wire, level); err != nil {
+			return nil, err
+		}
+		cc.w = cc.cw
+	}
+	if cc.RecvCodec != "" {
+		var ok bool
+		if cc.recv, ok = lookupCompressor(cc.RecvCodec); !ok {
+			return nil, errors.New("extraio: unregistered codec " + cc.RecvCodec)
+		}
+	}
+	return cc, nil
+}
+
+func readCodecHello(r io.Reader) ([]string, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, noEOF(err)
+	}
+	if !bytes.Equal(hdr[:4], compressMagic) || hdr[4] > compressMaxCodecs {
+		return nil, ErrHandshake
+	}
+	names := make([]string, hdr[4])
+	for i := range names {
+		var n [1]byte
+		if _, err := io.ReadFull(r, n[:]); err != nil {
+			return nil, noEOF(err)
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(r, name); err != nil {
+			return nil, noEOF(err)
+		}
+		names[i] = string(name)
+	}
+	return names, nil
+}
+
+// firstCommon returns the first of prefs in other, or "".
+func firstCommon(prefs, other []string) string {
+	for _, p := range prefs {
+		for _, o := range other {
+			if p == o {
+				return p
+			}
+		}
+	}
+	return ""
+}
+
+func (cc *CompressedConn) Read(buf []byte) (int, error) {
+	cc.rmu.Lock()
+	defer cc.rmu.Unlock()
+	if cc.RecvCodec != "" && cc.rc == nil {
+		// Created on first use as some formats read a header.
+		rc, err := cc.recv.NewReader(cc.wire)
+		if err != nil {
+			return 0, err
+		}
+		cc.rc, cc.r = rc, rc
+	}
+	n, err := cc.r.Read(buf)
+	cc.readCount.Add(int64(n))
+	return n, err
+}
+
+func (cc *CompressedConn) Write(buf []byte) (int, error) {
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	n, err := cc.w.Write(buf)
+	if err == nil && cc.cw != nil {
+		err = cc.cw.Flush()
+	}
+	cc.writeCount.Add(int64(n))
+	return n, err
+}
+
+// Stats returns the uncompressed bytes read and written.
+func (cc *CompressedConn) Stats() Stats {
+	return Stats{ReadCount: cc.readCount.Load(), WriteCount: cc.writeCount.Load()}
+}
+
+// WireStats returns the compressed bytes read and written on Conn,
+// excluding the negotiation.
+func (cc *CompressedConn) WireStats() Stats {
+	return cc.wire.Stats()
+}
+
+// Close ends the compressed stream and closes Conn.
+func (cc *CompressedConn) Close() error {
+	var ferr error
+	if cc.cw != nil {
+		cc.wmu.Lock()
+		ferr = cc.cw.Close()
+		cc.wmu.Unlock()
+	}
+	return errors.Join(ferr, cc.Conn.Close())
+}
+
+func (cc *CompressedConn) LocalAddr() net.Addr {
+	return cc.Conn.LocalAddr()
+}
+
+func (cc *CompressedConn) RemoteAddr() net.Addr {
+	return cc.Conn.RemoteAddr()
+}
+
+func (cc *CompressedConn) SetDeadline(t time.Time) error {
+	return cc.Conn.SetDeadline(t)
+}
+
+func (cc *CompressedConn) SetReadDeadline(t time.Time) error {
+	return cc.Conn.SetReadDeadline(t)
+}
+
+func (cc *CompressedConn) SetWriteDeadline(t time.Time) error {
+	return cc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (cc *CompressedConn) NetConn() net.Conn {
+	return cc.Conn
+}
@@ -0,0 +1,44 @@
+//go:build extraio_s2
+
+package extraio
+
+import (
+	"compress/flate"
+	"io"
+
+	"github.com/klauspost/compress/s2"
+)
+
+// Building with the extraio_s2 tag registers "s2" and "snappy", the
+// latter writing streams the snappy framing format can read.
+func init() {
+	RegisterCompressor(Compressor{
+		Name: "snappy",
+		NewWriter: func(w io.Writer, level int) (CompressWriter, error) {
+			return s2.NewWriter(w, append(s2Options(level), s2.WriterSnappyCompat())...), nil
+		},
+		NewReader: newS2Reader,
+	})
+	RegisterCompressor(Compressor{
+		Name: "s2",
+		NewWriter: func(w io.Writer, level int) (CompressWriter, error) {
+			return s2.NewWriter(w, s2Options(level)...), nil
+		},
+		NewReader: newS2Reader,
+	})
+}
+
+// s2Options maps a flate level onto s2's three.
+func s2Options(level int) []s2.WriterOption {
+	switch {
+	case level == flate.BestCompression:
+		return []s2.WriterOption{s2.WriterBestCompression()}
+	case level > flate.DefaultCompression:
+		return []s2.WriterOption{s2.WriterBetterCompression()}
+	}
+	return nil
+}
+
+func newS2Reader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(s2.NewReader(r)), nil
+}
@@ -0,0 +1,89 @@
+package extraio
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+)
+
+// tcpPair returns both ends of a loopback TCP connection, which unlike
+// net.Pipe buffers writes nobody is reading yet.
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	a, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func compressedPair(t *testing.T, codec string) (*CompressedConn, *CompressedConn) {
+	t.Helper()
+	a, b := tcpPair(t)
+	ch := make(chan *CompressedConn, 1)
+	go func() {
+		cc, err := NewCompressedConn(b, WithCodecs(codec))
+		if err != nil {
+			t.Error(err)
+		}
+		ch <- cc
+	}()
+	ca, err := NewCompressedConn(a, WithCodecs(codec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb := <-ch
+	if cb == nil {
+		t.FailNow()
+	}
+	return ca, cb
+}
+
+func TestCompressedConnCodecs(t *testing.T) {
+	var names []string
+	compressorsMu.Lock()
+	for _, c := range compressors {
+		names = append(names, c.Name)
+	}
+	compressorsMu.Unlock()
+	msg := bytes.Repeat([]byte("compress me "), 10000)
+	for _, name := range names {
+		t.Run(name, func(t *testing.T) {
+			ca, cb := compressedPair(t, name)
+			if ca.SendCodec != name || cb.RecvCodec != name {
+				t.Fatalf("negotiated %q/%q", ca.SendCodec, cb.RecvCodec)
+			}
+			mc := NewMeteredConn(ca)
+			done := make(chan struct{})
+			go func() {
+				// Each write is flushed, so the reader sees it without a Close.
+				mc.Write(msg)
+				close(done)
+			}()
+			got := make([]byte, len(msg))
+			if _, err := io.ReadFull(cb, got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, msg) {
+				t.Fatal("data mismatch")
+			}
+			<-done
+			raw, wire := mc.Stats(), mc.WireStats()
+			if raw.WriteCount != int64(len(msg)) || wire.WriteCount <= 0 || wire.WriteCount >= raw.WriteCount {
+				t.Fatalf("raw %+v wire %+v", raw, wire)
+			}
+			ca.Close()
+			cb.Close()
+		})
+	}
+}
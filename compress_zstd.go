@@ -0,0 +1,30 @@
+//go:build extraio_zstd
+
+package extraio
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Building with the extraio_zstd tag registers "zstd".
+func init() {
+	RegisterCompressor(Compressor{
+		Name: "zstd",
+		NewWriter: func(w io.Writer, level int) (CompressWriter, error) {
+			speed := zstd.SpeedDefault
+			if level >= 0 {
+				speed = zstd.EncoderLevelFromZstd(level)
+			}
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(speed), zstd.WithEncoderConcurrency(1))
+		},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+	})
+}
@@ -0,0 +1,253 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// adapterAddr is the default address of a ConnAdapter.
+type adapterAddr struct{}
+
+func (adapterAddr) Network() string { return "extraio" }
+func (adapterAddr) String() string  { return "adapter" }
+
+type ioResult struct {
+	buf []byte
+	n   int
+	err error
+}
+
+// asyncReader reads on a background goroutine so the wait for a read can
+// be abandoned when dl passes or closed is closed. An abandoned read
+// completes later and its result is returned by the next read.
+type asyncReader struct {
+	r       io.Reader
+	mu      sync.Mutex
+	pending chan ioResult
+	buf     []byte
+	err     error
+}
+
+func (ar *asyncReader) read(buf []byte, dl *deadline, closed <-chan struct{}) (int, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	if isClosedChan(closed) {
+		return 0, net.ErrClosed
+	}
+	if len(ar.buf) > 0 {
+		n := copy(buf, ar.buf)
+		ar.buf = ar.buf[n:]
+		return n, nil
+	}
+	if err := ar.err; err != nil {
+		ar.err = nil
+		return 0, err
+	}
+	if dl.expired() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if ar.pending == nil {
+		ch := make(chan ioResult, 1)
+		rbuf := make([]byte, minInt(len(buf), defaultBufSize))
+		go func() {
+			n, err := ar.r.Read(rbuf)
+			ch <- ioResult{buf: rbuf[:n], err: err}
+		}()
+		ar.pending = ch
+	}
+	select {
+	case res := <-ar.pending:
+		ar.pending = nil
+		n := copy(buf, res.buf)
+		if n < len(res.buf) {
+			ar.buf = res.buf[n:]
+			ar.err = res.err
+			return n, nil
+		}
+		return n, res.err
+	case <-dl.wait():
+		return 0, os.ErrDeadlineExceeded
+	case <-closed:
+		return 0, net.ErrClosed
+	}
+}
+
+// asyncWriter writes on a background goroutine so the wait for a write
+// can be abandoned. An abandoned write may still complete, and its
+// error, if any, is returned by the next write.
+type asyncWriter struct {
+	w       io.Writer
+	mu      sync.Mutex
+	pending chan ioResult
+}
+
+func (aw *asyncWriter) write(buf []byte, dl *deadline, closed <-chan struct{}) (int, error) {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if isClosedChan(closed) {
+		return 0, net.ErrClosed
+	}
+	if dl.expired() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	if aw.pending != nil {
+		// Finish a write that timed out earlier first.
+		select {
+		case res := <-aw.pending:
+			aw.pending = nil
+			if res.err != nil {
+				return 0, res.err
+			}
+		case <-dl.wait():
+			return 0, os.ErrDeadlineExceeded
+		case <-closed:
+			return 0, net.ErrClosed
+		}
+	}
+	// The caller may reuse buf if we time out.
+	data := append([]byte(nil), buf...)
+	ch := make(chan ioResult, 1)
+	go func() {
+		n, err := aw.w.Write(data)
+		ch <- ioResult{n: n, err: err}
+	}()
+	aw.pending = ch
+	select {
+	case res := <-ch:
+		aw.pending = nil
+		return res.n, res.err
+	case <-dl.wait():
+		return 0, os.ErrDeadlineExceeded
+	case <-closed:
+		return 0, net.ErrClosed
+	}
+}
+
+// drain waits for a write abandoned by an earlier call to finish,
+// returning its error, or ctx.Err() if ctx is done first.
+func (aw *asyncWriter) drain(ctx context.Context) error {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	if aw.pending == nil {
+		return nil
+	}
+	select {
+	case res := <-aw.pending:
+		aw.pending = nil
+		return res.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DeadlineReadWriteCloser adds net.Conn style deadlines to any
+// io.ReadWriteCloser, such as the ends of a SocketPair, with blocked
+// operations returning os.ErrDeadlineExceeded once a deadline passes.
+//
+// Reads and writes on RWC happen on background goroutines so deadlines
+// can interrupt the wait for them. A read that times out completes later
+// and its data is returned by the next Read. A write that times out may
+// still be written, and its error, if any, is returned by the next Write.
+type DeadlineReadWriteCloser struct {
+	RWC io.ReadWriteCloser
+
+	readDeadline  deadline
+	writeDeadline deadline
+
+	r asyncReader
+	w asyncWriter
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewDeadlineReadWriteCloser must be used to create a
+// DeadlineReadWriteCloser.
+func NewDeadlineReadWriteCloser(rwc io.ReadWriteCloser) *DeadlineReadWriteCloser {
+	return &DeadlineReadWriteCloser{
+		RWC:    rwc,
+		r:      asyncReader{r: rwc},
+		w:      asyncWriter{w: rwc},
+		closed: make(chan struct{}),
+	}
+}
+
+func (d *DeadlineReadWriteCloser) Read(buf []byte) (int, error) {
+	return d.r.read(buf, &d.readDeadline, d.closed)
+}
+
+func (d *DeadlineReadWriteCloser) Write(buf []byte) (int, error) {
+	return d.w.write(buf, &d.writeDeadline, d.closed)
+}
+
+// Close closes RWC and unblocks pending reads and writes.
+func (d *DeadlineReadWriteCloser) Close() error {
+	err := net.ErrClosed
+	d.closeOnce.Do(func() {
+		close(d.closed)
+		err = d.RWC.Close()
+	})
+	return err
+}
+
+// CloseDrain waits for a write that timed out to reach RWC before
+// closing it, so data accepted by RWC is not cut off by the close. It
+// must not be called while a Write is in progress. If ctx is done first
+// RWC is closed anyway and ctx.Err() returned, a failed write's error is
+// returned after closing.
+func (d *DeadlineReadWriteCloser) CloseDrain(ctx context.Context) error {
+	derr := d.w.drain(ctx)
+	if err := d.Close(); derr == nil {
+		return err
+	}
+	return derr
+}
+
+func (d *DeadlineReadWriteCloser) SetDeadline(t time.Time) error {
+	d.readDeadline.set(t)
+	d.writeDeadline.set(t)
+	return nil
+}
+
+func (d *DeadlineReadWriteCloser) SetReadDeadline(t time.Time) error {
+	d.readDeadline.set(t)
+	return nil
+}
+
+func (d *DeadlineReadWriteCloser) SetWriteDeadline(t time.Time) error {
+	d.writeDeadline.set(t)
+	return nil
+}
+
+// ConnAdapter makes any io.ReadWriteCloser a net.Conn, for example so a
+// command's stdio can be handed to a library expecting a connection.
+// Deadlines are provided by a DeadlineReadWriteCloser.
+type ConnAdapter struct {
+	*DeadlineReadWriteCloser
+	// Returned by LocalAddr and RemoteAddr if not nil.
+	Local  net.Addr
+	Remote net.Addr
+}
+
+// NewConnAdapter must be used to create a ConnAdapter.
+func NewConnAdapter(rwc io.ReadWriteCloser) *ConnAdapter {
+	return &ConnAdapter{DeadlineReadWriteCloser: NewDeadlineReadWriteCloser(rwc)}
+}
+
+func (ca *ConnAdapter) LocalAddr() net.Addr {
+	if ca.Local != nil {
+		return ca.Local
+	}
+	return adapterAddr{}
+}
+
+func (ca *ConnAdapter) RemoteAddr() net.Addr {
+	if ca.Remote != nil {
+		return ca.Remote
+	}
+	return adapterAddr{}
+}
@@ -0,0 +1,76 @@
+package extraio
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// ContextConn carries a context with a conn, so it can be recovered with
+// ConnContext from any wrapper layered over it.
+type ContextConn struct {
+	Conn net.Conn
+	ctx  context.Context
+}
+
+func NewContextConn(c net.Conn, ctx context.Context) *ContextConn {
+	return &ContextConn{Conn: c, ctx: ctx}
+}
+
+func (cc *ContextConn) Context() context.Context {
+	return cc.ctx
+}
+
+// ConnContext returns the context of the outermost layer of c with a
+// Context method, looking through wrappers with a NetConn method, or
+// context.Background if there is none.
+func ConnContext(c net.Conn) context.Context {
+	for c != nil {
+		if cc, ok := c.(interface{ Context() context.Context }); ok {
+			return cc.Context()
+		}
+		u, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		c = u.NetConn()
+	}
+	return context.Background()
+}
+
+func (cc *ContextConn) Read(buf []byte) (int, error) {
+	return cc.Conn.Read(buf)
+}
+
+func (cc *ContextConn) Write(buf []byte) (int, error) {
+	return cc.Conn.Write(buf)
+}
+
+func (cc *ContextConn) Close() error {
+	return cc.Conn.Close()
+}
+
+func (cc *ContextConn) LocalAddr() net.Addr {
+	return cc.Conn.LocalAddr()
+}
+
+func (cc *ContextConn) RemoteAddr() net.Addr {
+	return cc.Conn.RemoteAddr()
+}
+
+func (cc *ContextConn) SetDeadline(t time.Time) error {
+	return cc.Conn.SetDeadline(t)
+}
+
+func (cc *ContextConn) SetReadDeadline(t time.Time) error {
+	return cc.Conn.SetReadDeadline(t)
+}
+
+func (cc *ContextConn) SetWriteDeadline(t time.Time) error {
+	return cc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (cc *ContextConn) NetConn() net.Conn {
+	return cc.Conn
+}
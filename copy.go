@@ -0,0 +1,177 @@
+package extraio
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+var errInvalidWrite = errors.New("extraio: invalid write result")
+
+const (
+	defaultMinCopyBuf = 4 * 1024
+	defaultMaxCopyBuf = 1024 * 1024
+
+	// Consecutive full reads before the buffer grows.
+	copyGrowAfter = 2
+	// Consecutive reads using at most a quarter of the buffer before it shrinks.
+	copyShrinkAfter = 8
+)
+
+// CopyStats describes a finished Copy.
+type CopyStats struct {
+	Written int64
+	Reads   int64
+	// Buffer size in use when the copy finished.
+	BufferSize int
+	Duration   time.Duration
+}
+
+// adaptiveBuf grows while reads fill it and shrinks while they trickle in.
+// Buffers come from sizedPools, so resizing does not allocate once the
+// pools are warm.
+type adaptiveBuf struct {
+	buf    []byte
+	pooled *[]byte
+	min    int
+	max    int
+	full   int
+	small  int
+}
+
+func newAdaptiveBuf(min, max int) adaptiveBuf {
+	if min <= 0 {
+		min = defaultMinCopyBuf
+	}
+	if max <= 0 {
+		max = defaultMaxCopyBuf
+	}
+	if max < min {
+		max = min
+	}
+	ab := adaptiveBuf{min: min, max: max}
+	size := defaultBufSize
+	if size < min {
+		size = min
+	}
+	if size > max {
+		size = max
+	}
+	ab.pooled = getSizedBuf(size)
+	ab.buf = *ab.pooled
+	return ab
+}
+
+func (ab *adaptiveBuf) observe(n int) {
+	size := len(ab.buf)
+	switch {
+	case n == size:
+		ab.small = 0
+		ab.full++
+		if ab.full >= copyGrowAfter && size < ab.max {
+			ab.resize(minInt(size*2, ab.max))
+		}
+	case n <= size/4:
+		ab.full = 0
+		ab.small++
+		if ab.small >= copyShrinkAfter && size > ab.min {
+			ab.resize(maxInt(size/2, ab.min))
+		}
+	default:
+		ab.full = 0
+		ab.small = 0
+	}
+}
+
+func (ab *adaptiveBuf) resize(size int) {
+	ab.release()
+	ab.pooled = getSizedBuf(size)
+	ab.buf = *ab.pooled
+	ab.full = 0
+	ab.small = 0
+}
+
+func (ab *adaptiveBuf) release() {
+	if ab.pooled != nil {
+		putSizedBuf(ab.pooled)
+		ab.pooled = nil
+	}
+}
+
+// Copy copies from src to dst until EOF like io.Copy, but sizes its buffer
+// to the traffic: it doubles while reads fill it and halves while reads
+// trickle in, between the bounds set by WithBufferSize.
+// Unlike io.Copy it does not use ReadFrom or WriteTo.
+// Accepts WithBufferSize, WithProgress and WithHook, which is called
+// after every read from src and write to dst.
+func Copy(dst io.Writer, src io.Reader, opts ...Option) (CopyStats, error) {
+	return copyOptions(dst, src, applyOptions(opts, optBufferSize|optProgress|optHook, "Copy"), -1)
+}
+
+// CopyWithProgress is Copy calling fn with the bytes copied, rate and
+// elapsed time every interval, and once more when the copy ends. With
+// the expected total, or -1 if unknown, the Progress also gives the
+// percentage done and an ETA. Accepts WithBufferSize and WithHook.
+func CopyWithProgress(dst io.Writer, src io.Reader, total int64, interval time.Duration, fn func(Progress), opts ...Option) (int64, error) {
+	o := applyOptions(opts, optBufferSize|optHook, "CopyWithProgress")
+	o.progress = fn
+	o.progressInterval = interval
+	stats, err := copyOptions(dst, src, o, total)
+	return stats.Written, err
+}
+
+func copyOptions(dst io.Writer, src io.Reader, o options, total int64) (CopyStats, error) {
+	ab := newAdaptiveBuf(o.minBuf, o.maxBuf)
+	defer ab.release()
+	progress := newProgressReporter(o.progress, o.progressInterval, total)
+	var stats CopyStats
+	start := time.Now()
+	done := func(err error) (CopyStats, error) {
+		stats.BufferSize = len(ab.buf)
+		stats.Duration = time.Since(start)
+		progress.finish(stats.Written)
+		return stats, err
+	}
+	for {
+		buf := ab.buf
+		nr, rerr := src.Read(buf)
+		stats.Reads++
+		if o.hook != nil {
+			o.hook.OnRead(nr, rerr)
+		}
+		if nr > 0 {
+			nw, werr := dst.Write(buf[:nr])
+			if nw < 0 || nw > nr {
+				nw = 0
+				if werr == nil {
+					werr = errInvalidWrite
+				}
+			}
+			if o.hook != nil {
+				o.hook.OnWrite(nw, werr)
+			}
+			stats.Written += int64(nw)
+			if werr != nil {
+				return done(werr)
+			}
+			if nw != nr {
+				return done(io.ErrShortWrite)
+			}
+			progress.update(stats.Written)
+		}
+		if rerr == io.EOF {
+			return done(nil)
+		}
+		if rerr != nil {
+			return done(rerr)
+		}
+		ab.observe(nr)
+	}
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
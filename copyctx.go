@@ -0,0 +1,56 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ctxReader fails reads once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (cr *ctxReader) Read(buf []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cr.r.Read(buf)
+}
+
+// interruptIO unblocks operations on x, setting a past deadline if it
+// supports them and otherwise closing it.
+func interruptIO(x any, read bool) {
+	past := time.Unix(1, 0)
+	if read {
+		if d, ok := x.(interface{ SetReadDeadline(time.Time) error }); ok && d.SetReadDeadline(past) == nil {
+			return
+		}
+	} else {
+		if d, ok := x.(interface{ SetWriteDeadline(time.Time) error }); ok && d.SetWriteDeadline(past) == nil {
+			return
+		}
+	}
+	if c, ok := x.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// CopyContext is Copy stopping when ctx is done, returning the bytes
+// copied and ctx.Err(). A blocked Read or Write is interrupted by
+// setting a deadline in the past where src or dst supports one, otherwise
+// by closing it if it is an io.Closer, so after a cancellation either may
+// be unusable. Accepts the options of Copy.
+func CopyContext(ctx context.Context, dst io.Writer, src io.Reader, opts ...Option) (int64, error) {
+	stop := context.AfterFunc(ctx, func() {
+		interruptIO(src, true)
+		interruptIO(dst, false)
+	})
+	stats, err := Copy(dst, &ctxReader{ctx: ctx, r: src}, opts...)
+	stop()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return stats.Written, err
+}
@@ -0,0 +1,53 @@
+package extraio
+
+import (
+	"io"
+	"os"
+)
+
+// CopyMethod reports how CopyFile moved the data.
+type CopyMethod int
+
+const (
+	// CopyUserspace means data was read into and written from a buffer.
+	CopyUserspace CopyMethod = iota
+	// CopyKernel means data was copied in kernel, e.g. with copy_file_range.
+	CopyKernel
+	// CopyClone means dst was made a reflink of src, no data was copied.
+	CopyClone
+)
+
+func (m CopyMethod) String() string {
+	switch m {
+	case CopyUserspace:
+		return "userspace"
+	case CopyKernel:
+		return "kernel"
+	case CopyClone:
+		return "clone"
+	default:
+		return "unknown"
+	}
+}
+
+// CopyFile copies src from its current offset to dst at its current offset,
+// returning the number of bytes copied and the mechanism used.
+//
+// When both files are at offset zero and dst is empty, CopyFile first
+// attempts a reflink clone, then an in kernel copy, then falls back
+// to Copy.
+func CopyFile(dst, src *os.File) (int64, CopyMethod, error) {
+	n, method, handled, err := copyFileFast(dst, src)
+	if handled {
+		return n, method, err
+	}
+	n, err = copyUserspace(dst, src)
+	return n, CopyUserspace, err
+}
+
+// copyUserspace is Copy without options, which does not allocate once
+// the buffer pools are warm.
+func copyUserspace(dst io.Writer, src io.Reader) (int64, error) {
+	stats, err := copyOptions(dst, src, options{}, -1)
+	return stats.Written, err
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package extraio
+
+import (
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxCopyFileRange bounds a single copy_file_range request.
+const maxCopyFileRange = 1 << 30
+
+func copyFileFast(dst, src *os.File) (int64, CopyMethod, bool, error) {
+	srcRaw, err := src.SyscallConn()
+	if err != nil {
+		return 0, CopyUserspace, false, nil
+	}
+	dstRaw, err := dst.SyscallConn()
+	if err != nil {
+		return 0, CopyUserspace, false, nil
+	}
+
+	var (
+		n       int64
+		method  CopyMethod
+		handled bool
+		copyErr error
+	)
+	ctlErr := srcRaw.Control(func(sfd uintptr) {
+		ctlErr := dstRaw.Control(func(dfd uintptr) {
+			n, method, handled, copyErr = copyFds(int(dfd), int(sfd))
+		})
+		if ctlErr != nil {
+			copyErr = ctlErr
+		}
+	})
+	if ctlErr != nil {
+		return 0, CopyUserspace, false, nil
+	}
+	return n, method, handled, copyErr
+}
+
+func copyFds(dfd, sfd int) (int64, CopyMethod, bool, error) {
+	if n, ok := cloneFd(dfd, sfd); ok {
+		return n, CopyClone, true, nil
+	}
+
+	var written int64
+	for {
+		n, err := unix.CopyFileRange(sfd, nil, dfd, nil, maxCopyFileRange, 0)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			if written == 0 {
+				// Unsupported for this pair of files, let the caller fall back.
+				return 0, CopyUserspace, false, nil
+			}
+			return written, CopyKernel, true, os.NewSyscallError("copy_file_range", err)
+		}
+		if n == 0 {
+			if written == 0 {
+				// Some special files report 0 rather than an error, so
+				// an immediate EOF is double checked in userspace.
+				return 0, CopyUserspace, false, nil
+			}
+			return written, CopyKernel, true, nil
+		}
+		written += int64(n)
+	}
+}
+
+// cloneFd attempts a FICLONE of sfd into dfd, only done when this
+// is equivalent to a copy, that is both offsets are zero and dfd is empty.
+func cloneFd(dfd, sfd int) (int64, bool) {
+	if off, err := unix.Seek(sfd, 0, io.SeekCurrent); err != nil || off != 0 {
+		return 0, false
+	}
+	if off, err := unix.Seek(dfd, 0, io.SeekCurrent); err != nil || off != 0 {
+		return 0, false
+	}
+	var sst, dst unix.Stat_t
+	if unix.Fstat(sfd, &sst) != nil || unix.Fstat(dfd, &dst) != nil {
+		return 0, false
+	}
+	if sst.Mode&unix.S_IFMT != unix.S_IFREG || dst.Mode&unix.S_IFMT != unix.S_IFREG || dst.Size != 0 {
+		return 0, false
+	}
+	if unix.IoctlFileClone(dfd, sfd) != nil {
+		return 0, false
+	}
+	// Leave both offsets where a normal copy would have.
+	if _, err := unix.Seek(sfd, sst.Size, io.SeekStart); err != nil {
+		return 0, false
+	}
+	if _, err := unix.Seek(dfd, sst.Size, io.SeekStart); err != nil {
+		return 0, false
+	}
+	return sst.Size, true
+}
@@ -0,0 +1,106 @@
+package extraio
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+)
+
+// deadline is a resettable deadline in the manner of net.Pipe's,
+// the channel from wait is closed once the deadline passes.
+// The zero value has no deadline.
+type deadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+// set arms the deadline for t, a zero t clears it.
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel == nil {
+		d.cancel = make(chan struct{})
+	}
+	if d.timer != nil && !d.timer.Stop() {
+		// The timer fired, wait for it to close cancel.
+		<-d.cancel
+	}
+	d.timer = nil
+
+	closed := isClosedChan(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() {
+			close(cancel)
+		})
+		return
+	}
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// arm sets the deadline to dur from now, or clears it if dur <= 0.
+func (d *deadline) arm(dur time.Duration) {
+	if dur <= 0 {
+		d.set(time.Time{})
+		return
+	}
+	d.set(time.Now().Add(dur))
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.cancel == nil {
+		d.cancel = make(chan struct{})
+	}
+	return d.cancel
+}
+
+func (d *deadline) expired() bool {
+	return isClosedChan(d.wait())
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// context returns a child of parent that is canceled with cause
+// os.ErrDeadlineExceeded when the deadline passes, for handing a
+// deadline to context based APIs.
+func (d *deadline) context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+	d.mu.Lock()
+	armed := d.timer != nil
+	d.mu.Unlock()
+	done := d.wait()
+	if isClosedChan(done) {
+		cancel(os.ErrDeadlineExceeded)
+	} else if armed {
+		go func() {
+			select {
+			case <-done:
+				cancel(os.ErrDeadlineExceeded)
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return ctx, func() { cancel(context.Canceled) }
+}
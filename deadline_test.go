@@ -0,0 +1,74 @@
+package extraio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDeadlineSet(t *testing.T) {
+	var d deadline
+	if d.expired() {
+		t.Fatal("zero deadline expired")
+	}
+	d.set(time.Now().Add(-time.Second))
+	if !d.expired() {
+		t.Fatal("past deadline not expired")
+	}
+	d.set(time.Time{})
+	if d.expired() {
+		t.Fatal("cleared deadline still expired")
+	}
+	d.set(time.Now().Add(10 * time.Millisecond))
+	if d.expired() {
+		t.Fatal("future deadline expired early")
+	}
+	select {
+	case <-d.wait():
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadline never passed")
+	}
+	// Extending a passed deadline makes it pending again.
+	d.set(time.Now().Add(time.Hour))
+	if d.expired() {
+		t.Fatal("extended deadline still expired")
+	}
+	d.set(time.Time{})
+}
+
+func TestDeadlineContext(t *testing.T) {
+	var d deadline
+	d.arm(10 * time.Millisecond)
+	ctx, cancel := d.context(context.Background())
+	defer cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context not cancelled at the deadline")
+	}
+	if cause := context.Cause(ctx); cause != os.ErrDeadlineExceeded {
+		t.Fatalf("cause %v, want os.ErrDeadlineExceeded", cause)
+	}
+}
+
+func TestDeadlineReadWriteCloserRead(t *testing.T) {
+	a, b := SocketPair()
+	d := NewDeadlineReadWriteCloser(a)
+	defer d.Close()
+	defer b.Close()
+
+	d.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	buf := make([]byte, 5)
+	if _, err := d.Read(buf); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("read past deadline: %v, want os.ErrDeadlineExceeded", err)
+	}
+	// The abandoned read completes and the next Read returns its data.
+	d.SetReadDeadline(time.Time{})
+	go b.Write([]byte("hello"))
+	if _, err := io.ReadFull(d, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+}
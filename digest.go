@@ -0,0 +1,90 @@
+package extraio
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// DigestMismatchError is returned by a VerifiedReader at EOF when the
+// data read does not have the expected digest.
+type DigestMismatchError struct {
+	Want []byte
+	Got  []byte
+}
+
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("extraio: digest mismatch, want %x got %x", e.Want, e.Got)
+}
+
+// VerifiedReader hashes everything read from R with Hash and, in place of
+// io.EOF, returns a *DigestMismatchError if the digest is not Want. Any
+// hash.Hash may be used, such as sha256.New(), sha512.New() or a BLAKE2
+// hash. Data is verified as it streams past, so callers that must not
+// act on unverified data should stage it until EOF.
+type VerifiedReader struct {
+	R    io.Reader
+	Hash hash.Hash
+	Want []byte
+
+	// The result returned at and after EOF.
+	done error
+}
+
+// NewVerifiedReader returns a VerifiedReader checking that r has the
+// digest want under h, which should be freshly created.
+func NewVerifiedReader(r io.Reader, h hash.Hash, want []byte) *VerifiedReader {
+	return &VerifiedReader{R: r, Hash: h, Want: want}
+}
+
+func (vr *VerifiedReader) Read(buf []byte) (int, error) {
+	if vr.done != nil {
+		return 0, vr.done
+	}
+	n, err := vr.R.Read(buf)
+	vr.Hash.Write(buf[:n])
+	if err == io.EOF {
+		vr.done = io.EOF
+		if got := vr.Hash.Sum(nil); !bytes.Equal(got, vr.Want) {
+			vr.done = &DigestMismatchError{Want: vr.Want, Got: got}
+		}
+		err = vr.done
+	}
+	return n, err
+}
+
+// HashingWriter writes to W while feeding everything written to each of
+// Hashes, so a digest is computed in the same pass as the write. Wrap W
+// in a MeteredWriter to get the size as well.
+type HashingWriter struct {
+	W      io.Writer
+	Hashes []hash.Hash
+}
+
+func NewHashingWriter(w io.Writer, hashes ...hash.Hash) *HashingWriter {
+	return &HashingWriter{W: w, Hashes: hashes}
+}
+
+// Write hashes only the bytes W accepted.
+func (hw *HashingWriter) Write(buf []byte) (int, error) {
+	n, err := hw.W.Write(buf)
+	for _, h := range hw.Hashes {
+		h.Write(buf[:n])
+	}
+	return n, err
+}
+
+// Sum returns the digest of the first hash.
+func (hw *HashingWriter) Sum() []byte {
+	return hw.Hashes[0].Sum(nil)
+}
+
+// Sums returns the digests of all the hashes, in order.
+func (hw *HashingWriter) Sums() [][]byte {
+	sums := make([][]byte, len(hw.Hashes))
+	for i, h := range hw.Hashes {
+		sums[i] = h.Sum(nil)
+	}
+	return sums
+}
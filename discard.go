@@ -0,0 +1,32 @@
+package extraio
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// CountingDiscard is like io.Discard but counts the bytes written to it.
+// io.Copy into it uses Copy via ReadFrom.
+// It is safe for concurrent use.
+type CountingDiscard struct {
+	n int64
+}
+
+func (d *CountingDiscard) Write(p []byte) (int, error) {
+	atomic.AddInt64(&d.n, int64(len(p)))
+	return len(p), nil
+}
+
+func (d *CountingDiscard) WriteString(s string) (int, error) {
+	atomic.AddInt64(&d.n, int64(len(s)))
+	return len(s), nil
+}
+
+func (d *CountingDiscard) ReadFrom(r io.Reader) (int64, error) {
+	return copyUserspace(d, r)
+}
+
+// Count returns the number of bytes discarded so far.
+func (d *CountingDiscard) Count() int64 {
+	return atomic.LoadInt64(&d.n)
+}
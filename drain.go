@@ -0,0 +1,122 @@
+package extraio
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// DrainableListener tracks the conns it accepts so a server can stop
+// accepting and wait for them to finish with Drain.
+type DrainableListener struct {
+	Listener net.Listener
+
+	mu       sync.Mutex
+	conns    map[*drainConn]struct{}
+	draining bool
+	// closed once draining and no conns remain.
+	empty chan struct{}
+}
+
+func NewDrainableListener(l net.Listener) *DrainableListener {
+	return &DrainableListener{
+		Listener: l,
+		conns:    make(map[*drainConn]struct{}),
+		empty:    make(chan struct{}),
+	}
+}
+
+func (dl *DrainableListener) Accept() (net.Conn, error) {
+	c, err := dl.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	dc := &drainConn{Conn: c, dl: dl}
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if dl.draining {
+		c.Close()
+		return nil, &net.OpError{Op: "accept", Net: dl.Addr().Network(), Addr: dl.Addr(), Err: net.ErrClosed}
+	}
+	dl.conns[dc] = struct{}{}
+	return dc, nil
+}
+
+func (dl *DrainableListener) Close() error {
+	return dl.Listener.Close()
+}
+
+func (dl *DrainableListener) Addr() net.Addr {
+	return dl.Listener.Addr()
+}
+
+func (dl *DrainableListener) Unwrap() net.Listener {
+	return dl.Listener
+}
+
+// Active returns the number of accepted conns not yet closed.
+func (dl *DrainableListener) Active() int {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	return len(dl.conns)
+}
+
+// Drain closes the listener and waits for every accepted conn to be
+// closed. If ctx is done first the remaining conns are closed
+// and ctx.Err() is returned.
+func (dl *DrainableListener) Drain(ctx context.Context) error {
+	dl.mu.Lock()
+	if !dl.draining {
+		dl.draining = true
+		if len(dl.conns) == 0 {
+			close(dl.empty)
+		}
+	}
+	dl.mu.Unlock()
+
+	err := dl.Listener.Close()
+
+	select {
+	case <-dl.empty:
+		return err
+	case <-ctx.Done():
+	}
+
+	dl.mu.Lock()
+	remaining := make([]*drainConn, 0, len(dl.conns))
+	for c := range dl.conns {
+		remaining = append(remaining, c)
+	}
+	dl.mu.Unlock()
+	for _, c := range remaining {
+		c.Close()
+	}
+	return ctx.Err()
+}
+
+func (dl *DrainableListener) remove(c *drainConn) {
+	dl.mu.Lock()
+	defer dl.mu.Unlock()
+	if _, ok := dl.conns[c]; !ok {
+		return
+	}
+	delete(dl.conns, c)
+	if dl.draining && len(dl.conns) == 0 {
+		close(dl.empty)
+	}
+}
+
+type drainConn struct {
+	net.Conn
+	dl *DrainableListener
+}
+
+func (c *drainConn) Close() error {
+	err := c.Conn.Close()
+	c.dl.remove(c)
+	return err
+}
+
+func (c *drainConn) NetConn() net.Conn {
+	return c.Conn
+}
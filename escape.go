@@ -0,0 +1,97 @@
+package extraio
+
+import "io"
+
+// escapeXor is applied to escaped bytes, as in PPP and SLIP like framings,
+// so the escaped form of a reserved byte is not itself that byte.
+const escapeXor = 0x20
+
+// EscapeWriter byte stuffs writes to W, each reserved byte and the escape
+// byte itself is replaced by the escape byte followed by the original
+// byte xor 0x20. Reserved sets should not contain two bytes differing only
+// by 0x20, or the escaped form of one will contain the other.
+type EscapeWriter struct {
+	W        io.Writer
+	Escape   byte
+	reserved [256]bool
+	buf      []byte
+}
+
+func NewEscapeWriter(w io.Writer, escape byte, reserved []byte) *EscapeWriter {
+	ew := &EscapeWriter{W: w, Escape: escape}
+	for _, b := range reserved {
+		ew.reserved[b] = true
+	}
+	ew.reserved[escape] = true
+	return ew
+}
+
+// Write returns the number of bytes of p written in full, escaped form.
+func (ew *EscapeWriter) Write(p []byte) (int, error) {
+	out := ew.buf[:0]
+	for _, b := range p {
+		if ew.reserved[b] {
+			out = append(out, ew.Escape, b^escapeXor)
+		} else {
+			out = append(out, b)
+		}
+	}
+	ew.buf = out
+	nw, err := ew.W.Write(out)
+	if nw == len(out) {
+		return len(p), err
+	}
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	n := 0
+	for _, b := range p {
+		size := 1
+		if ew.reserved[b] {
+			size = 2
+		}
+		if nw < size {
+			break
+		}
+		nw -= size
+		n++
+	}
+	return n, err
+}
+
+// UnescapeReader undoes the escaping of an EscapeWriter using the same escape byte.
+type UnescapeReader struct {
+	R       io.Reader
+	Escape  byte
+	pending bool
+}
+
+func NewUnescapeReader(r io.Reader, escape byte) *UnescapeReader {
+	return &UnescapeReader{R: r, Escape: escape}
+}
+
+func (ur *UnescapeReader) Read(buf []byte) (int, error) {
+	for {
+		n, err := ur.R.Read(buf)
+		out := 0
+		for _, b := range buf[:n] {
+			switch {
+			case ur.pending:
+				buf[out] = b ^ escapeXor
+				out++
+				ur.pending = false
+			case b == ur.Escape:
+				ur.pending = true
+			default:
+				buf[out] = b
+				out++
+			}
+		}
+		if err == io.EOF && ur.pending {
+			err = io.ErrUnexpectedEOF
+		}
+		if out > 0 || err != nil || len(buf) == 0 {
+			return out, err
+		}
+	}
+}
@@ -2,12 +2,17 @@ package extraio
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"io"
 	"io/ioutil"
 	"net"
+	"os"
 	"os/exec"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -24,22 +29,56 @@ func (m *MergedReadWriteCloser) Write(buf []byte) (int, error) {
 	return m.WC.Write(buf)
 }
 
+// Close closes both sides, returning the errors of both joined.
 func (m *MergedReadWriteCloser) Close() error {
-	_ = m.RC.Close()
-	_ = m.WC.Close()
-	return nil
+	rerr := m.RC.Close()
+	werr := m.WC.Close()
+	return errors.Join(rerr, werr)
 }
 
-func SocketPair() (io.ReadWriteCloser, io.ReadWriteCloser) {
+// CloseRead closes only the read side.
+func (m *MergedReadWriteCloser) CloseRead() error {
+	return m.RC.Close()
+}
+
+// CloseWrite closes only the write side, e.g. a command's stdin,
+// so the peer sees EOF while reading continues.
+func (m *MergedReadWriteCloser) CloseWrite() error {
+	return m.WC.Close()
+}
+
+// ReadHalf returns the read side alone, wrapped so it cannot
+// be type asserted back into something writable.
+func (m *MergedReadWriteCloser) ReadHalf() io.ReadCloser {
+	return struct{ io.ReadCloser }{m.RC}
+}
+
+// WriteHalf returns the write side alone, wrapped so it cannot
+// be type asserted back into something readable.
+func (m *MergedReadWriteCloser) WriteHalf() io.WriteCloser {
+	return struct{ io.WriteCloser }{m.WC}
+}
+
+// SocketPair returns two connected in memory streams. By default each Write
+// arrives in the peer's reads unsplit, WithSegmentSize and WithCoalesce
+// make delivery look more like a real TCP connection.
+func SocketPair(opts ...Option) (io.ReadWriteCloser, io.ReadWriteCloser) {
+	o := applyOptions(opts, optSegmentSize|optCoalesce, "SocketPair")
 	a, b := io.Pipe()
 	x, y := io.Pipe()
 
+	var bw, yw io.WriteCloser = b, y
+	if o.segmentSize > 0 || o.coalesce > 0 {
+		bw = newSegmentWriter(b, o.segmentSize, o.coalesce)
+		yw = newSegmentWriter(y, o.segmentSize, o.coalesce)
+	}
+
 	return &MergedReadWriteCloser{
 			RC: a,
-			WC: y,
+			WC: yw,
 		}, &MergedReadWriteCloser{
 			RC: x,
-			WC: b,
+			WC: bw,
 		}
 }
 
@@ -47,16 +86,33 @@ func SocketPair() (io.ReadWriteCloser, io.ReadWriteCloser) {
 
 // PrefixSuffixSaver is an io.Writer which retains the first N bytes
 // and the last N bytes written to it. The Bytes() methods reconstructs
-// it with a pretty error message.
+// it with a pretty error message. It is not safe for concurrent use,
+// wrap it in a SyncWriter to share it between writers.
 type PrefixSuffixSaver struct {
-	N         int // max size of prefix or suffix
+	N int // max size of prefix or suffix
+	// Omission, if not nil, returns the message Bytes puts in place of
+	// the skipped bytes instead of "... omitting N bytes ...".
+	Omission  func(skipped int64) string
 	prefix    []byte
 	suffix    []byte // ring buffer once len(suffix) == N
 	suffixOff int    // offset to write into suffix
 	skipped   int64
+	guard     misuseGuard
+}
+
+// NewPrefixSuffixSaver returns a PrefixSuffixSaver for n with its buffers
+// allocated up front, so reusing it with Reset never allocates.
+func NewPrefixSuffixSaver(n int) *PrefixSuffixSaver {
+	return &PrefixSuffixSaver{
+		N:      n,
+		prefix: make([]byte, 0, n),
+		suffix: make([]byte, 0, n),
+	}
 }
 
 func (w *PrefixSuffixSaver) Write(p []byte) (n int, err error) {
+	w.guard.enter("PrefixSuffixSaver use")
+	defer w.guard.exit()
 	lenp := len(p)
 	p = w.fill(&w.prefix, p)
 
@@ -92,23 +148,57 @@ func (w *PrefixSuffixSaver) fill(dst *[]byte, p []byte) (pRemain []byte) {
 }
 
 func (w *PrefixSuffixSaver) Bytes() []byte {
+	w.guard.enter("PrefixSuffixSaver use")
+	defer w.guard.exit()
 	if w.suffix == nil {
 		return w.prefix
 	}
 	if w.skipped == 0 {
-		return append(w.prefix, w.suffix...)
+		// Clip the prefix so appending copies rather than writing into
+		// capacity later writes will fill.
+		return append(w.prefix[:len(w.prefix):len(w.prefix)], w.suffix...)
 	}
+	msg := w.omission()
 	var buf bytes.Buffer
-	buf.Grow(len(w.prefix) + len(w.suffix) + 50)
+	buf.Grow(len(w.prefix) + len(w.suffix) + len(msg))
 	buf.Write(w.prefix)
-	buf.WriteString("\n... omitting ")
-	buf.WriteString(strconv.FormatInt(w.skipped, 10))
-	buf.WriteString(" bytes ...\n")
+	buf.WriteString(msg)
 	buf.Write(w.suffix[w.suffixOff:])
 	buf.Write(w.suffix[:w.suffixOff])
 	return buf.Bytes()
 }
 
+// Reset empties the saver for reuse, keeping its buffers and settings.
+// Slices returned by Bytes before the reset may be overwritten.
+func (w *PrefixSuffixSaver) Reset() {
+	w.guard.enter("PrefixSuffixSaver use")
+	defer w.guard.exit()
+	w.prefix = w.prefix[:0]
+	w.suffix = w.suffix[:0]
+	w.suffixOff = 0
+	w.skipped = 0
+}
+
+func (w *PrefixSuffixSaver) omission() string {
+	if w.Omission != nil {
+		return w.Omission(w.skipped)
+	}
+	return "\n... omitting " + strconv.FormatInt(w.skipped, 10) + " bytes ...\n"
+}
+
+// Parts returns copies of the retained prefix and suffix and the number
+// of bytes skipped between them, with no message added, for binary data
+// or structured error reporting.
+func (w *PrefixSuffixSaver) Parts() (prefix, suffix []byte, skipped int64) {
+	w.guard.enter("PrefixSuffixSaver use")
+	defer w.guard.exit()
+	prefix = append([]byte(nil), w.prefix...)
+	suffix = make([]byte, 0, len(w.suffix))
+	suffix = append(suffix, w.suffix[w.suffixOff:]...)
+	suffix = append(suffix, w.suffix[:w.suffixOff]...)
+	return prefix, suffix, w.skipped
+}
+
 func minInt(a, b int) int {
 	if a < b {
 		return a
@@ -116,53 +206,196 @@ func minInt(a, b int) int {
 	return b
 }
 
-// Sets cmd.Stderr to io.Discard
+// Sets cmd.Stderr to io.Discard (see WithStderr)
 // sets cmd.Stdout and cmd.Stdin to pipes connected
 // to the returned read write closer.
-func CmdReadWriteCloser(cmd *exec.Cmd) io.ReadWriteCloser {
+// Accepts WithStderr, WithContext, WithExtraFiles, WithCloseInherited,
+// whose descriptors are marked close on exec immediately, and WithFDCheck.
+// If preparing the descriptors fails the error is put in cmd.Err, so
+// starting cmd returns it. When the WithContext context is done the pipes
+// are closed and the command, once started, is killed.
+func CmdReadWriteCloser(cmd *exec.Cmd, opts ...Option) io.ReadWriteCloser {
+	o := applyOptions(opts, optStderr|optContext|optCmdFDs, "CmdReadWriteCloser")
 	a, b := io.Pipe()
 	x, y := io.Pipe()
 
 	cmd.Stderr = ioutil.Discard
+	if o.stderr != nil {
+		cmd.Stderr = o.stderr
+	}
 	cmd.Stdout = b
 	cmd.Stdin = x
+	if err := prepareCmdFDs(cmd, &o); err != nil && cmd.Err == nil {
+		cmd.Err = err
+	}
 
 	rwc := &MergedReadWriteCloser{
 		RC: a,
 		WC: y,
 	}
+	if o.ctx == nil {
+		return rwc
+	}
+	stdin := &cmdStdin{r: x, cmd: cmd}
+	cmd.Stdin = stdin
+	return &cmdPipes{
+		MergedReadWriteCloser: rwc,
+		stop: context.AfterFunc(o.ctx, func() {
+			_ = rwc.Close()
+			stdin.kill()
+		}),
+	}
+}
+
+// cmdPipes is a CmdReadWriteCloser tied to a context.
+type cmdPipes struct {
+	*MergedReadWriteCloser
+	stop func() bool
+}
 
-	return rwc
+func (p *cmdPipes) Close() error {
+	p.stop()
+	return p.MergedReadWriteCloser.Close()
+}
+
+// cmdStdin feeds a command's stdin and finds its process, which it can
+// only read safely from the goroutine exec.Cmd.Start runs it on.
+type cmdStdin struct {
+	r   io.Reader
+	cmd *exec.Cmd
+
+	mu     sync.Mutex
+	found  bool
+	proc   *os.Process
+	killed bool
+}
+
+func (s *cmdStdin) Read(buf []byte) (int, error) {
+	s.mu.Lock()
+	if !s.found {
+		s.found = true
+		s.proc = s.cmd.Process
+		if s.killed && s.proc != nil {
+			_ = s.proc.Kill()
+		}
+	}
+	s.mu.Unlock()
+	return s.r.Read(buf)
+}
+
+// kill kills the process now, or as soon as it is found.
+func (s *cmdStdin) kill() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.killed = true
+	if s.proc != nil {
+		_ = s.proc.Kill()
+	}
 }
 
 type MeteredConn struct {
 	Conn net.Conn
-	// if accessed concurrently, Read with sync/atomic
+	// if accessed concurrently, read with BytesRead or Stats
 	ReadCount int64
-	// if accessed concurrently, Read with sync/atomic
+	// keep the counters on separate cache lines, reads and
+	// writes usually happen on different goroutines.
+	_ [56]byte
+	// if accessed concurrently, read with BytesWritten or Stats
 	WriteCount int64
+	// if not nil, called after every operation
+	Hook ObserverHook
+	// also credited with every byte counted
+	Meters []*Meter
+
+	rate rateTracker
 }
 
-func NewMeteredConn(c net.Conn) *MeteredConn {
+// Accepts WithHook and WithMeters.
+func NewMeteredConn(c net.Conn, opts ...Option) *MeteredConn {
+	o := applyOptions(opts, optHook|optMeters, "NewMeteredConn")
 	return &MeteredConn{
-		Conn: c,
+		Conn:   c,
+		Hook:   o.hook,
+		Meters: o.meters,
+	}
+}
+
+// WireStats returns the bytes beneath Conn, from the first layer under it
+// implementing WireStatsProvider such as a CompressedConn, or Stats if
+// there is none.
+func (mConn *MeteredConn) WireStats() Stats {
+	if w, ok := wireStats(mConn.Conn); ok {
+		return w
+	}
+	return mConn.Stats()
+}
+
+func (mConn *MeteredConn) Stats() Stats {
+	return Stats{
+		ReadCount:  atomic.LoadInt64(&mConn.ReadCount),
+		WriteCount: atomic.LoadInt64(&mConn.WriteCount),
 	}
 }
 
+// Reset returns the counters and sets them to zero.
+func (mConn *MeteredConn) Reset() Stats {
+	mConn.rate.reset()
+	return Stats{
+		ReadCount:  atomic.SwapInt64(&mConn.ReadCount, 0),
+		WriteCount: atomic.SwapInt64(&mConn.WriteCount, 0),
+	}
+}
+
+// BytesRead returns ReadCount, safe to call concurrently with Read.
+func (mConn *MeteredConn) BytesRead() int64 {
+	return atomic.LoadInt64(&mConn.ReadCount)
+}
+
+// BytesWritten returns WriteCount, safe to call concurrently with Write.
+func (mConn *MeteredConn) BytesWritten() int64 {
+	return atomic.LoadInt64(&mConn.WriteCount)
+}
+
 func (mConn *MeteredConn) Read(buf []byte) (int, error) {
 	n, err := mConn.Conn.Read(buf)
-	atomic.AddInt64(&mConn.ReadCount, int64(n))
+	mConn.countRead(int64(n), err)
 	return n, err
 }
 
+func (mConn *MeteredConn) countRead(n int64, err error) {
+	mConn.rate.observe(mConn.Stats())
+	atomic.AddInt64(&mConn.ReadCount, n)
+	for _, m := range mConn.Meters {
+		m.AddRead(n)
+	}
+	if mConn.Hook != nil {
+		mConn.Hook.OnRead(int(n), err)
+	}
+}
+
 func (mConn *MeteredConn) Write(buf []byte) (int, error) {
 	n, err := mConn.Conn.Write(buf)
-	atomic.AddInt64(&mConn.WriteCount, int64(n))
+	mConn.countWrite(int64(n), err)
 	return n, err
 }
 
+func (mConn *MeteredConn) countWrite(n int64, err error) {
+	mConn.rate.observe(mConn.Stats())
+	atomic.AddInt64(&mConn.WriteCount, n)
+	for _, m := range mConn.Meters {
+		m.AddWrite(n)
+	}
+	if mConn.Hook != nil {
+		mConn.Hook.OnWrite(int(n), err)
+	}
+}
+
 func (mConn *MeteredConn) Close() error {
-	return mConn.Conn.Close()
+	err := mConn.Conn.Close()
+	if mConn.Hook != nil {
+		mConn.Hook.OnClose(err)
+	}
+	return err
 }
 
 func (mConn *MeteredConn) LocalAddr() net.Addr {
@@ -185,24 +418,246 @@ func (mConn *MeteredConn) SetWriteDeadline(t time.Time) error {
 	return mConn.Conn.SetWriteDeadline(t)
 }
 
+// NetConn returns the wrapped conn.
+func (mConn *MeteredConn) NetConn() net.Conn {
+	return mConn.Conn
+}
+
+// SyscallConn passes through to the wrapped conn, returning
+// errors.ErrUnsupported if it does not implement syscall.Conn.
+// Reads and writes through the raw conn are not counted.
+func (mConn *MeteredConn) SyscallConn() (syscall.RawConn, error) {
+	if sc, ok := mConn.Conn.(syscall.Conn); ok {
+		return sc.SyscallConn()
+	}
+	return nil, errors.ErrUnsupported
+}
+
 type MeteredWriter struct {
 	W          io.Writer
 	WriteCount int64
+	// if not nil, called after every write
+	Hook ObserverHook
+	// also credited with every byte counted
+	Meters []*Meter
+
+	rate rateTracker
+}
+
+// Accepts WithHook and WithMeters.
+func NewMeteredWriter(w io.Writer, opts ...Option) *MeteredWriter {
+	o := applyOptions(opts, optHook|optMeters, "NewMeteredWriter")
+	return &MeteredWriter{
+		W:      w,
+		Hook:   o.hook,
+		Meters: o.meters,
+	}
 }
 
 func (mw *MeteredWriter) Write(buf []byte) (int, error) {
 	n, err := mw.W.Write(buf)
-	atomic.AddInt64(&mw.WriteCount, int64(n))
+	mw.countWrite(int64(n), err)
 	return n, err
 }
 
+func (mw *MeteredWriter) countWrite(n int64, err error) {
+	mw.rate.observe(mw.Stats())
+	atomic.AddInt64(&mw.WriteCount, n)
+	for _, m := range mw.Meters {
+		m.AddWrite(n)
+	}
+	if mw.Hook != nil {
+		mw.Hook.OnWrite(int(n), err)
+	}
+}
+
+// WireStats returns the bytes beneath W, from the first layer under it
+// implementing WireStatsProvider such as a CompressedConn, or Stats if
+// there is none.
+func (mw *MeteredWriter) WireStats() Stats {
+	if w, ok := wireStats(mw.W); ok {
+		return w
+	}
+	return mw.Stats()
+}
+
+func (mw *MeteredWriter) Stats() Stats {
+	return Stats{WriteCount: atomic.LoadInt64(&mw.WriteCount)}
+}
+
+// Reset returns the counters and sets them to zero.
+func (mw *MeteredWriter) Reset() Stats {
+	mw.rate.reset()
+	return Stats{WriteCount: atomic.SwapInt64(&mw.WriteCount, 0)}
+}
+
+// BytesWritten returns WriteCount, safe to call concurrently with Write.
+func (mw *MeteredWriter) BytesWritten() int64 {
+	return atomic.LoadInt64(&mw.WriteCount)
+}
+
 type MeteredReader struct {
 	R         io.Reader
 	ReadCount int64
+	// if not nil, called after every read
+	Hook ObserverHook
+	// also credited with every byte counted
+	Meters []*Meter
+
+	rate rateTracker
+}
+
+// Accepts WithHook and WithMeters.
+func NewMeteredReader(r io.Reader, opts ...Option) *MeteredReader {
+	o := applyOptions(opts, optHook|optMeters, "NewMeteredReader")
+	return &MeteredReader{
+		R:      r,
+		Hook:   o.hook,
+		Meters: o.meters,
+	}
 }
 
 func (mw *MeteredReader) Read(buf []byte) (int, error) {
 	n, err := mw.R.Read(buf)
-	atomic.AddInt64(&mw.ReadCount, int64(n))
+	mw.countRead(int64(n), err)
+	return n, err
+}
+
+func (mw *MeteredReader) countRead(n int64, err error) {
+	mw.rate.observe(mw.Stats())
+	atomic.AddInt64(&mw.ReadCount, n)
+	for _, m := range mw.Meters {
+		m.AddRead(n)
+	}
+	if mw.Hook != nil {
+		mw.Hook.OnRead(int(n), err)
+	}
+}
+
+// WireStats returns the bytes beneath R, from the first layer under it
+// implementing WireStatsProvider such as a CompressedConn, or Stats if
+// there is none.
+func (mw *MeteredReader) WireStats() Stats {
+	if w, ok := wireStats(mw.R); ok {
+		return w
+	}
+	return mw.Stats()
+}
+
+func (mw *MeteredReader) Stats() Stats {
+	return Stats{ReadCount: atomic.LoadInt64(&mw.ReadCount)}
+}
+
+// Reset returns the counters and sets them to zero.
+func (mw *MeteredReader) Reset() Stats {
+	mw.rate.reset()
+	return Stats{ReadCount: atomic.SwapInt64(&mw.ReadCount, 0)}
+}
+
+// BytesRead returns ReadCount, safe to call concurrently with Read.
+func (mw *MeteredReader) BytesRead() int64 {
+	return atomic.LoadInt64(&mw.ReadCount)
+}
+
+type MeteredReadWriteCloser struct {
+	RWC io.ReadWriteCloser
+	// if accessed concurrently, read with BytesRead or Stats
+	ReadCount int64
+	_         [56]byte
+	// if accessed concurrently, read with BytesWritten or Stats
+	WriteCount int64
+	// if not nil, called after every operation
+	Hook ObserverHook
+	// also credited with every byte counted
+	Meters []*Meter
+
+	rate rateTracker
+}
+
+// Accepts WithHook and WithMeters.
+func NewMeteredReadWriteCloser(rwc io.ReadWriteCloser, opts ...Option) *MeteredReadWriteCloser {
+	o := applyOptions(opts, optHook|optMeters, "NewMeteredReadWriteCloser")
+	return &MeteredReadWriteCloser{
+		RWC:    rwc,
+		Hook:   o.hook,
+		Meters: o.meters,
+	}
+}
+
+func (m *MeteredReadWriteCloser) Read(buf []byte) (int, error) {
+	n, err := m.RWC.Read(buf)
+	m.countRead(int64(n), err)
 	return n, err
 }
+
+func (m *MeteredReadWriteCloser) countRead(n int64, err error) {
+	m.rate.observe(m.Stats())
+	atomic.AddInt64(&m.ReadCount, n)
+	for _, mt := range m.Meters {
+		mt.AddRead(n)
+	}
+	if m.Hook != nil {
+		m.Hook.OnRead(int(n), err)
+	}
+}
+
+func (m *MeteredReadWriteCloser) Write(buf []byte) (int, error) {
+	n, err := m.RWC.Write(buf)
+	m.countWrite(int64(n), err)
+	return n, err
+}
+
+func (m *MeteredReadWriteCloser) countWrite(n int64, err error) {
+	m.rate.observe(m.Stats())
+	atomic.AddInt64(&m.WriteCount, n)
+	for _, mt := range m.Meters {
+		mt.AddWrite(n)
+	}
+	if m.Hook != nil {
+		m.Hook.OnWrite(int(n), err)
+	}
+}
+
+func (m *MeteredReadWriteCloser) Close() error {
+	err := m.RWC.Close()
+	if m.Hook != nil {
+		m.Hook.OnClose(err)
+	}
+	return err
+}
+
+// WireStats returns the bytes beneath RWC, from the first layer under it
+// implementing WireStatsProvider such as a CompressedConn, or Stats if
+// there is none.
+func (m *MeteredReadWriteCloser) WireStats() Stats {
+	if w, ok := wireStats(m.RWC); ok {
+		return w
+	}
+	return m.Stats()
+}
+
+func (m *MeteredReadWriteCloser) Stats() Stats {
+	return Stats{
+		ReadCount:  atomic.LoadInt64(&m.ReadCount),
+		WriteCount: atomic.LoadInt64(&m.WriteCount),
+	}
+}
+
+// Reset returns the counters and sets them to zero.
+func (m *MeteredReadWriteCloser) Reset() Stats {
+	m.rate.reset()
+	return Stats{
+		ReadCount:  atomic.SwapInt64(&m.ReadCount, 0),
+		WriteCount: atomic.SwapInt64(&m.WriteCount, 0),
+	}
+}
+
+// BytesRead returns ReadCount, safe to call concurrently with Read.
+func (m *MeteredReadWriteCloser) BytesRead() int64 {
+	return atomic.LoadInt64(&m.ReadCount)
+}
+
+// BytesWritten returns WriteCount, safe to call concurrently with Write.
+func (m *MeteredReadWriteCloser) BytesWritten() int64 {
+	return atomic.LoadInt64(&m.WriteCount)
+}
@@ -0,0 +1,55 @@
+package extraio
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestCmdReadWriteCloserContextKills(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.Command("sleep", "60")
+	rwc := CmdReadWriteCloser(cmd, WithContext(ctx))
+	defer rwc.Close()
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("command not killed when the context was cancelled")
+	}
+}
+
+func TestCmdReadWriteCloserCloseStopsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rwc := CmdReadWriteCloser(exec.Command("true"), WithContext(ctx))
+	rwc.Close()
+	if rwc.(*cmdPipes).stop() {
+		t.Fatal("context callback still registered after Close")
+	}
+}
+
+func TestCmdStreamStderrToBoth(t *testing.T) {
+	var sink bytes.Buffer
+	cs, err := StartCmdReadWriteCloser(exec.Command("sh", "-c", "echo oops >&2"),
+		WithStderr(&sink), WithStderrCapture(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(cs.Stderr()); got != "oops\n" {
+		t.Fatalf("captured %q", got)
+	}
+	if got := sink.String(); got != "oops\n" {
+		t.Fatalf("WithStderr writer got %q", got)
+	}
+}
@@ -0,0 +1,229 @@
+package extraio
+
+import (
+	"io"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+)
+
+// Faults configures the misbehaviour of FaultyReader, FaultyWriter and
+// FaultyConn, the zero value injects nothing. Probabilities are in [0, 1]
+// and drawn per operation from a generator set with WithSeed, so a failing
+// run can be repeated exactly.
+type Faults struct {
+	// If not nil, reads return ReadErr once ReadErrAfter bytes
+	// have been read, the read reaching it is cut short.
+	ReadErr      error
+	ReadErrAfter int64
+	// If not nil, writes return WriteErr once WriteErrAfter bytes
+	// have been written, the write reaching it is cut short.
+	WriteErr      error
+	WriteErrAfter int64
+
+	// Probability a read is passed a random shorter buffer.
+	ShortRead float64
+	// Probability a write stops at a random shorter length and
+	// returns io.ErrShortWrite.
+	ShortWrite float64
+
+	// Probability an operation first sleeps for Delay.
+	DelayProb float64
+	Delay     time.Duration
+
+	// Probability an operation finds the stream disconnected, and the
+	// total bytes read and written after which it always does, 0 is never.
+	// A disconnected FaultyConn closes its Conn, a FaultyReader returns
+	// io.ErrUnexpectedEOF and a FaultyWriter io.ErrClosedPipe.
+	Disconnect      float64
+	DisconnectAfter int64
+}
+
+// faultState applies Faults to one stream.
+type faultState struct {
+	f Faults
+	// disconnect is called once when the stream disconnects, returning
+	// the error later operations fail with, or nil to let them through
+	// to a stream it closed.
+	disconnect func() error
+
+	mu            sync.Mutex
+	rng           *rand.Rand
+	read          int64
+	written       int64
+	disconnected  bool
+	disconnectErr error
+}
+
+func newFaultState(f Faults, disconnect func() error, opts []Option, who string) *faultState {
+	o := applyOptions(opts, optSeed, who)
+	return &faultState{f: f, disconnect: disconnect, rng: o.rng()}
+}
+
+func (fs *faultState) chance(p float64) bool {
+	return p > 0 && fs.rng.Float64() < p
+}
+
+// before decides the faults of an operation on up to n bytes, returning
+// how many bytes it may transfer, or an error to fail with instead.
+func (fs *faultState) before(op Op, n int) (int, error) {
+	fs.mu.Lock()
+	delay := fs.chance(fs.f.DelayProb)
+	if !fs.disconnected {
+		total := fs.read + fs.written
+		if fs.chance(fs.f.Disconnect) || (fs.f.DisconnectAfter > 0 && total >= fs.f.DisconnectAfter) {
+			fs.disconnected = true
+			fs.disconnectErr = fs.disconnect()
+		}
+	}
+	if fs.disconnectErr != nil {
+		err := fs.disconnectErr
+		fs.mu.Unlock()
+		return 0, err
+	}
+	limit := n
+	injected, after, done := fs.f.ReadErr, fs.f.ReadErrAfter, fs.read
+	short := fs.f.ShortRead
+	if op == OpWrite {
+		injected, after, done = fs.f.WriteErr, fs.f.WriteErrAfter, fs.written
+		short = fs.f.ShortWrite
+	}
+	if injected != nil {
+		remaining := after - done
+		if remaining <= 0 {
+			fs.mu.Unlock()
+			return 0, injected
+		}
+		if int64(limit) > remaining {
+			limit = int(remaining)
+		}
+	}
+	if limit > 1 && fs.chance(short) {
+		limit = 1 + fs.rng.IntN(limit-1)
+	}
+	fs.mu.Unlock()
+
+	if delay {
+		time.Sleep(fs.f.Delay)
+	}
+	return limit, nil
+}
+
+func (fs *faultState) doRead(r io.Reader, buf []byte) (int, error) {
+	limit, err := fs.before(OpRead, len(buf))
+	if err != nil {
+		return 0, err
+	}
+	n, err := r.Read(buf[:limit])
+	fs.mu.Lock()
+	fs.read += int64(n)
+	fs.mu.Unlock()
+	return n, err
+}
+
+func (fs *faultState) doWrite(w io.Writer, buf []byte) (int, error) {
+	limit, err := fs.before(OpWrite, len(buf))
+	if err != nil {
+		return 0, err
+	}
+	n, err := w.Write(buf[:limit])
+	fs.mu.Lock()
+	fs.written += int64(n)
+	reachedErr := fs.f.WriteErr != nil && fs.written >= fs.f.WriteErrAfter
+	fs.mu.Unlock()
+	if err == nil && n < len(buf) {
+		if reachedErr {
+			err = fs.f.WriteErr
+		} else {
+			err = io.ErrShortWrite
+		}
+	}
+	return n, err
+}
+
+// FaultyReader injects Faults into reads from R, for exercising error
+// handling that is hard to reach with real streams.
+type FaultyReader struct {
+	R  io.Reader
+	fs *faultState
+}
+
+// Accepts WithSeed.
+func NewFaultyReader(r io.Reader, f Faults, opts ...Option) *FaultyReader {
+	disconnect := func() error { return io.ErrUnexpectedEOF }
+	return &FaultyReader{R: r, fs: newFaultState(f, disconnect, opts, "NewFaultyReader")}
+}
+
+func (fr *FaultyReader) Read(buf []byte) (int, error) {
+	return fr.fs.doRead(fr.R, buf)
+}
+
+// FaultyWriter injects Faults into writes to W.
+type FaultyWriter struct {
+	W  io.Writer
+	fs *faultState
+}
+
+// Accepts WithSeed.
+func NewFaultyWriter(w io.Writer, f Faults, opts ...Option) *FaultyWriter {
+	disconnect := func() error { return io.ErrClosedPipe }
+	return &FaultyWriter{W: w, fs: newFaultState(f, disconnect, opts, "NewFaultyWriter")}
+}
+
+func (fw *FaultyWriter) Write(buf []byte) (int, error) {
+	return fw.fs.doWrite(fw.W, buf)
+}
+
+// FaultyConn injects Faults into both directions of Conn, a disconnect
+// closes Conn so both ends see the failure as they would a reset.
+type FaultyConn struct {
+	Conn net.Conn
+	fs   *faultState
+}
+
+// Accepts WithSeed.
+func NewFaultyConn(c net.Conn, f Faults, opts ...Option) *FaultyConn {
+	disconnect := func() error {
+		c.Close()
+		return nil
+	}
+	return &FaultyConn{Conn: c, fs: newFaultState(f, disconnect, opts, "NewFaultyConn")}
+}
+
+func (fc *FaultyConn) Read(buf []byte) (int, error) {
+	return fc.fs.doRead(fc.Conn, buf)
+}
+
+func (fc *FaultyConn) Write(buf []byte) (int, error) {
+	return fc.fs.doWrite(fc.Conn, buf)
+}
+
+func (fc *FaultyConn) Close() error {
+	return fc.Conn.Close()
+}
+
+func (fc *FaultyConn) LocalAddr() net.Addr {
+	return fc.Conn.LocalAddr()
+}
+
+func (fc *FaultyConn) RemoteAddr() net.Addr {
+	return fc.Conn.RemoteAddr()
+}
+
+func (fc *FaultyConn) SetDeadline(t time.Time) error {
+	return fc.Conn.SetDeadline(t)
+}
+
+func (fc *FaultyConn) SetReadDeadline(t time.Time) error {
+	return fc.Conn.SetReadDeadline(t)
+}
+
+func (fc *FaultyConn) SetWriteDeadline(t time.Time) error {
+	return fc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (fc *FaultyConn) NetConn() net.Conn {
+	return fc.Conn
+}
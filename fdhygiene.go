@@ -0,0 +1,95 @@
+package extraio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+const fdDir = "/dev/fd"
+
+// FDLeakError lists descriptors that a child process would inherit
+// without having been asked for.
+type FDLeakError struct {
+	FDs []int
+	// Targets of the descriptors where known, by descriptor.
+	Paths map[int]string
+}
+
+func (e *FDLeakError) Error() string {
+	var b strings.Builder
+	b.WriteString("extraio: descriptors would leak to child:")
+	for _, fd := range e.FDs {
+		b.WriteString(" ")
+		b.WriteString(strconv.Itoa(fd))
+		if p, ok := e.Paths[fd]; ok {
+			fmt.Fprintf(&b, " (%s)", p)
+		}
+	}
+	return b.String()
+}
+
+// InheritableFDs returns the descriptors above stderr that are not marked
+// close on exec, that is the ones every child process inherits.
+// It is supported on Linux and macOS, elsewhere it returns errors.ErrUnsupported.
+func InheritableFDs() ([]int, error) {
+	return inheritableFDs()
+}
+
+// CloseInheritedFDs marks every descriptor above stderr close on exec,
+// so children only get stdio and cmd.ExtraFiles. It does nothing on
+// platforms InheritableFDs does not support.
+func CloseInheritedFDs() error {
+	return closeInheritedFDs()
+}
+
+// prepareCmdFDs applies the fd options to cmd before it is started.
+func prepareCmdFDs(cmd *exec.Cmd, o *options) error {
+	if o.extraFiles != nil {
+		cmd.ExtraFiles = o.extraFiles
+	}
+	if o.closeInherited {
+		if err := closeInheritedFDs(); err != nil {
+			return err
+		}
+	}
+	if o.fdCheck {
+		fds, err := inheritableFDs()
+		if errors.Is(err, errors.ErrUnsupported) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// The command's extra files are passed on deliberately.
+		leaked := fds[:0]
+		for _, fd := range fds {
+			if !isExtraFile(cmd, fd) {
+				leaked = append(leaked, fd)
+			}
+		}
+		if len(leaked) == 0 {
+			return nil
+		}
+		leak := &FDLeakError{FDs: leaked, Paths: make(map[int]string)}
+		for _, fd := range leaked {
+			if p, err := os.Readlink(fdDir + "/" + strconv.Itoa(fd)); err == nil {
+				leak.Paths[fd] = p
+			}
+		}
+		return leak
+	}
+	return nil
+}
+
+func isExtraFile(cmd *exec.Cmd, fd int) bool {
+	for _, f := range cmd.ExtraFiles {
+		if f != nil && int(f.Fd()) == fd {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin
+
+package extraio
+
+import "errors"
+
+func inheritableFDs() ([]int, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func closeInheritedFDs() error {
+	return nil
+}
@@ -0,0 +1,62 @@
+//go:build linux || darwin
+
+package extraio
+
+import (
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+func listFDs() ([]int, error) {
+	f, err := os.Open(fdDir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	self := int(f.Fd())
+	var fds []int
+	for _, name := range names {
+		fd, err := strconv.Atoi(name)
+		if err != nil || fd <= 2 || fd == self {
+			continue
+		}
+		fds = append(fds, fd)
+	}
+	return fds, nil
+}
+
+func inheritableFDs() ([]int, error) {
+	fds, err := listFDs()
+	if err != nil {
+		return nil, err
+	}
+	var inheritable []int
+	for _, fd := range fds {
+		flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFD, 0)
+		if err != nil {
+			// Closed since it was listed.
+			continue
+		}
+		if flags&unix.FD_CLOEXEC == 0 {
+			inheritable = append(inheritable, fd)
+		}
+	}
+	return inheritable, nil
+}
+
+func closeInheritedFDs() error {
+	fds, err := inheritableFDs()
+	if err != nil {
+		return err
+	}
+	for _, fd := range fds {
+		unix.CloseOnExec(fd)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+//go:build linux || darwin
+
+package extraio
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+// inheritableFile returns a descriptor not marked close on exec.
+func inheritableFile(t *testing.T) *os.File {
+	t.Helper()
+	fd, err := unix.Dup(int(os.Stdin.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := os.NewFile(uintptr(fd), "dup")
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestFDCheckAllowsExtraFiles(t *testing.T) {
+	extra := inheritableFile(t)
+	cmd := exec.Command("true")
+	if err := prepareCmdFDs(cmd, &options{fdCheck: true, extraFiles: []*os.File{extra}}); err != nil {
+		t.Fatalf("extra file reported: %v", err)
+	}
+}
+
+func TestFDCheckReportsLeaks(t *testing.T) {
+	leaked := inheritableFile(t)
+	cmd := exec.Command("true")
+	err := prepareCmdFDs(cmd, &options{fdCheck: true})
+	var leak *FDLeakError
+	if !errors.As(err, &leak) {
+		t.Fatalf("got %v, want *FDLeakError", err)
+	}
+	found := false
+	for _, fd := range leak.FDs {
+		found = found || fd == int(leaked.Fd())
+	}
+	if !found {
+		t.Fatalf("%d not in %v", leaked.Fd(), leak.FDs)
+	}
+}
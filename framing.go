@@ -0,0 +1,163 @@
+package extraio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"sync"
+)
+
+// DefaultMaxMessageSize is the largest message framed by default.
+const DefaultMaxMessageSize = 16 << 20
+
+var ErrMessageTooLarge = errors.New("extraio: message exceeds maximum size")
+
+// byteReader reads single bytes from r without reading ahead, so nothing
+// past a frame is consumed.
+type byteReader struct {
+	r io.Reader
+	b [1]byte
+}
+
+func (br *byteReader) ReadByte() (byte, error) {
+	_, err := io.ReadFull(br.r, br.b[:])
+	return br.b[0], err
+}
+
+// FrameReader reads messages prefixed with their length, as written by a
+// FrameWriter. By default the length is a uvarint, with Fixed32 it is a
+// big endian uint32.
+type FrameReader struct {
+	R       io.Reader
+	Fixed32 bool
+	MaxSize int
+
+	br byteReader
+}
+
+// NewFrameReader returns a FrameReader on r, it accepts WithFixedLength
+// and WithMaxMessageSize.
+func NewFrameReader(r io.Reader, opts ...Option) *FrameReader {
+	o := applyOptions(opts, optFrames, "NewFrameReader")
+	fr := &FrameReader{R: r, Fixed32: o.fixedLength, MaxSize: o.maxMessage}
+	if fr.MaxSize <= 0 {
+		fr.MaxSize = DefaultMaxMessageSize
+	}
+	return fr
+}
+
+func (fr *FrameReader) readLength() (uint64, error) {
+	if fr.Fixed32 {
+		var hdr [4]byte
+		if _, err := io.ReadFull(fr.R, hdr[:]); err != nil {
+			return 0, err
+		}
+		return uint64(binary.BigEndian.Uint32(hdr[:])), nil
+	}
+	fr.br.r = fr.R
+	return binary.ReadUvarint(&fr.br)
+}
+
+// ReadMessage returns the next message, or io.EOF if the stream ends
+// between messages. A message over MaxSize is skipped and reported with
+// ErrMessageTooLarge, the next call reads the one after it.
+func (fr *FrameReader) ReadMessage() ([]byte, error) {
+	n, err := fr.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(fr.MaxSize) {
+		if n <= math.MaxInt64 {
+			if _, err := io.CopyN(io.Discard, fr.R, int64(n)); err != nil {
+				return nil, noEOF(err)
+			}
+		}
+		return nil, ErrMessageTooLarge
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(fr.R, msg); err != nil {
+		return nil, noEOF(err)
+	}
+	return msg, nil
+}
+
+// FrameWriter writes messages prefixed with their length, to be read by a
+// FrameReader configured the same way. It is safe for concurrent use,
+// messages are never interleaved.
+type FrameWriter struct {
+	W       io.Writer
+	Fixed32 bool
+	MaxSize int
+
+	mu sync.Mutex
+}
+
+// NewFrameWriter returns a FrameWriter on w, it accepts WithFixedLength
+// and WithMaxMessageSize.
+func NewFrameWriter(w io.Writer, opts ...Option) *FrameWriter {
+	o := applyOptions(opts, optFrames, "NewFrameWriter")
+	fw := &FrameWriter{W: w, Fixed32: o.fixedLength, MaxSize: o.maxMessage}
+	if fw.MaxSize <= 0 {
+		fw.MaxSize = DefaultMaxMessageSize
+	}
+	return fw
+}
+
+// WriteMessage writes msg as one message, with a single writev(2) where
+// W has a file descriptor.
+func (fw *FrameWriter) WriteMessage(msg []byte) error {
+	if len(msg) > fw.MaxSize || (fw.Fixed32 && uint64(len(msg)) > math.MaxUint32) {
+		return ErrMessageTooLarge
+	}
+	var hdr [binary.MaxVarintLen64]byte
+	var prefix []byte
+	if fw.Fixed32 {
+		prefix = binary.BigEndian.AppendUint32(hdr[:0], uint32(len(msg)))
+	} else {
+		prefix = binary.AppendUvarint(hdr[:0], uint64(len(msg)))
+	}
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	_, err := writeBuffers(fw.W, [][]byte{prefix, msg})
+	return err
+}
+
+// Write writes p as one message, so a FrameWriter can be handed to code
+// expecting an io.Writer that makes one Write per message.
+func (fw *FrameWriter) Write(p []byte) (int, error) {
+	if err := fw.WriteMessage(p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// MessageConn exchanges length prefixed messages over RWC, both ends must
+// use the same framing options.
+type MessageConn struct {
+	RWC    io.ReadWriteCloser
+	Reader *FrameReader
+	Writer *FrameWriter
+}
+
+// NewMessageConn returns a MessageConn on rwc, it accepts WithFixedLength
+// and WithMaxMessageSize.
+func NewMessageConn(rwc io.ReadWriteCloser, opts ...Option) *MessageConn {
+	return &MessageConn{
+		RWC:    rwc,
+		Reader: NewFrameReader(rwc, opts...),
+		Writer: NewFrameWriter(rwc, opts...),
+	}
+}
+
+func (mc *MessageConn) ReadMessage() ([]byte, error) {
+	return mc.Reader.ReadMessage()
+}
+
+func (mc *MessageConn) WriteMessage(msg []byte) error {
+	return mc.Writer.WriteMessage(msg)
+}
+
+func (mc *MessageConn) Close() error {
+	return mc.RWC.Close()
+}
@@ -0,0 +1,183 @@
+package extraio
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// SlowConsumerPolicy decides what GroupCopy does with a destination
+// whose backlog is full.
+type SlowConsumerPolicy int
+
+const (
+	// Block waits for the destination, so the whole group moves at the pace of the slowest.
+	Block SlowConsumerPolicy = iota
+	// Drop discards data the destination has no room for.
+	Drop
+	// Disconnect abandons the destination with ErrSlowConsumer, closing it if it is an io.Closer.
+	Disconnect
+)
+
+var ErrSlowConsumer = errors.New("extraio: slow consumer disconnected")
+
+const defaultGroupBacklog = 1 << 20
+
+// GroupDest is a destination for GroupCopy.
+type GroupDest struct {
+	W io.Writer
+	// Bytes that may be queued for W, default 1MiB.
+	Backlog int
+	Policy  SlowConsumerPolicy
+}
+
+// GroupResult is the outcome of GroupCopy for one destination.
+type GroupResult struct {
+	Written int64
+	Dropped int64
+	Err     error
+}
+
+type groupDest struct {
+	GroupDest
+	backlog int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  [][]byte
+	queued int
+	done   bool
+	failed bool
+	result GroupResult
+}
+
+// GroupCopy reads src once and writes everything read to each destination
+// concurrently, each with its own backlog and slow consumer policy.
+// It returns the number of bytes read from src, a result per destination
+// and the read error, which is nil at EOF. Copying stops early if every
+// destination fails.
+func GroupCopy(src io.Reader, dsts []GroupDest) (int64, []GroupResult, error) {
+	gds := make([]*groupDest, len(dsts))
+	var wg sync.WaitGroup
+	for i, d := range dsts {
+		gd := &groupDest{GroupDest: d, backlog: d.Backlog}
+		if gd.backlog <= 0 {
+			gd.backlog = defaultGroupBacklog
+		}
+		gd.cond = sync.NewCond(&gd.mu)
+		gds[i] = gd
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gd.run()
+		}()
+	}
+
+	var total int64
+	var readErr error
+	for {
+		buf := make([]byte, defaultBufSize)
+		n, err := src.Read(buf)
+		if n > 0 {
+			total += int64(n)
+			alive := false
+			for _, gd := range gds {
+				if gd.push(buf[:n]) {
+					alive = true
+				}
+			}
+			if !alive && len(gds) > 0 {
+				break
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				readErr = err
+			}
+			break
+		}
+	}
+
+	for _, gd := range gds {
+		gd.mu.Lock()
+		gd.done = true
+		gd.cond.Broadcast()
+		gd.mu.Unlock()
+	}
+	wg.Wait()
+
+	results := make([]GroupResult, len(gds))
+	for i, gd := range gds {
+		results[i] = gd.result
+	}
+	return total, results, readErr
+}
+
+// push queues chunk, reporting whether the destination is still alive.
+func (gd *groupDest) push(chunk []byte) bool {
+	gd.mu.Lock()
+	defer gd.mu.Unlock()
+	for !gd.failed && gd.queued > 0 && gd.queued+len(chunk) > gd.backlog {
+		switch gd.Policy {
+		case Drop:
+			gd.result.Dropped += int64(len(chunk))
+			return true
+		case Disconnect:
+			gd.fail(ErrSlowConsumer)
+			if c, ok := gd.W.(io.Closer); ok {
+				_ = c.Close()
+			}
+		default:
+			gd.cond.Wait()
+		}
+	}
+	if gd.failed {
+		return false
+	}
+	gd.queue = append(gd.queue, chunk)
+	gd.queued += len(chunk)
+	gd.cond.Broadcast()
+	return true
+}
+
+func (gd *groupDest) fail(err error) {
+	gd.failed = true
+	gd.result.Err = err
+	gd.queue = nil
+	gd.queued = 0
+	gd.cond.Broadcast()
+}
+
+func (gd *groupDest) run() {
+	gd.mu.Lock()
+	defer gd.mu.Unlock()
+	for {
+		for len(gd.queue) == 0 && !gd.done && !gd.failed {
+			gd.cond.Wait()
+		}
+		if gd.failed || len(gd.queue) == 0 {
+			return
+		}
+		chunk := gd.queue[0]
+		gd.queue[0] = nil
+		gd.queue = gd.queue[1:]
+
+		gd.mu.Unlock()
+		n, err := gd.W.Write(chunk)
+		gd.mu.Lock()
+
+		gd.result.Written += int64(n)
+		if err == nil && n != len(chunk) {
+			err = io.ErrShortWrite
+		}
+		if gd.failed {
+			return
+		}
+		if err != nil {
+			gd.fail(err)
+			return
+		}
+		gd.queued -= len(chunk)
+		gd.cond.Broadcast()
+	}
+}
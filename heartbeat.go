@@ -0,0 +1,260 @@
+package extraio
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Heartbeat frames are type(1) length(uint32), big endian, followed by
+// length bytes of data for data frames. Heartbeats have no payload.
+const (
+	heartbeatHeaderLen = 5
+	heartbeatMaxFrame  = 64 * 1024
+	heartbeatData      = 'd'
+	heartbeatPing      = 'h'
+)
+
+var (
+	ErrHeartbeatTimeout  = errors.New("extraio: no heartbeat from peer")
+	ErrBadHeartbeatFrame = errors.New("extraio: malformed heartbeat frame")
+)
+
+// HeartbeatConn sends a heartbeat on Conn whenever nothing has been
+// written for Interval, and fails the conn with ErrHeartbeatTimeout if the
+// peer sends nothing for Timeout, for transports such as pipes and
+// command stdio that have no TCP keepalive. Both ends must be
+// HeartbeatConns, data is framed so heartbeats can be stripped out.
+//
+// Conn is read on a background goroutine so heartbeats arrive while the
+// conn is otherwise idle. Time spent waiting for Read to take data does
+// not count towards Timeout. Writes also happen in the background, as
+// with a DeadlineReadWriteCloser, so a deadline never cuts a frame short.
+type HeartbeatConn struct {
+	Conn     net.Conn
+	Interval time.Duration
+	Timeout  time.Duration
+
+	// Serializes frames.
+	fmu sync.Mutex
+	w   asyncWriter
+	// UnixNano times of the last frame written and received.
+	lastWrite atomic.Int64
+	lastRecv  atomic.Int64
+	// The reader is waiting on Conn rather than on Read.
+	receiving atomic.Bool
+	timedOut  atomic.Bool
+
+	rmu  sync.Mutex
+	data chan []byte
+	buf  []byte
+	// Set before data is closed.
+	readErr error
+
+	readDeadline  deadline
+	writeDeadline deadline
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewHeartbeatConn must be used to create a HeartbeatConn, a timeout <= 0
+// is three intervals.
+func NewHeartbeatConn(c net.Conn, interval, timeout time.Duration) *HeartbeatConn {
+	if timeout <= 0 {
+		timeout = 3 * interval
+	}
+	hc := &HeartbeatConn{
+		Conn:     c,
+		Interval: interval,
+		Timeout:  timeout,
+		data:     make(chan []byte),
+		closed:   make(chan struct{}),
+	}
+	hc.w = asyncWriter{w: heartbeatWriter{hc}}
+	now := time.Now().UnixNano()
+	hc.lastWrite.Store(now)
+	hc.lastRecv.Store(now)
+	go hc.readLoop()
+	go hc.beat()
+	return hc
+}
+
+func (hc *HeartbeatConn) readLoop() {
+	defer close(hc.data)
+	var hdr [heartbeatHeaderLen]byte
+	for {
+		hc.lastRecv.Store(time.Now().UnixNano())
+		hc.receiving.Store(true)
+		if _, err := io.ReadFull(hc.Conn, hdr[:]); err != nil {
+			hc.readErr = err
+			return
+		}
+		n := binary.BigEndian.Uint32(hdr[1:])
+		switch {
+		case hdr[0] == heartbeatPing && n == 0:
+			continue
+		case hdr[0] != heartbeatData || n == 0 || n > heartbeatMaxFrame:
+			hc.readErr = ErrBadHeartbeatFrame
+			hc.Conn.Close()
+			return
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(hc.Conn, payload); err != nil {
+			hc.readErr = noEOF(err)
+			return
+		}
+		hc.receiving.Store(false)
+		select {
+		case hc.data <- payload:
+		case <-hc.closed:
+			return
+		}
+	}
+}
+
+// beat sends heartbeats and checks for the peer's until closed.
+func (hc *HeartbeatConn) beat() {
+	t := time.NewTicker(hc.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case <-hc.closed:
+			return
+		}
+		if hc.receiving.Load() && time.Since(time.Unix(0, hc.lastRecv.Load())) > hc.Timeout {
+			hc.timedOut.Store(true)
+			hc.Conn.Close()
+			return
+		}
+		// A write in progress will do as a heartbeat.
+		if time.Since(time.Unix(0, hc.lastWrite.Load())) >= hc.Interval && hc.fmu.TryLock() {
+			hc.writeFrameLocked(heartbeatPing, nil)
+			hc.fmu.Unlock()
+		}
+	}
+}
+
+func (hc *HeartbeatConn) writeFrameLocked(typ byte, payload []byte) error {
+	var hdr [heartbeatHeaderLen]byte
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(payload)))
+	_, err := writeBuffers(hc.Conn, [][]byte{hdr[:], payload})
+	hc.lastWrite.Store(time.Now().UnixNano())
+	return err
+}
+
+// TimedOut reports whether the conn failed for want of heartbeats.
+func (hc *HeartbeatConn) TimedOut() bool {
+	return hc.timedOut.Load()
+}
+
+// err replaces errors caused by closing Conn after a timeout.
+func (hc *HeartbeatConn) err(err error) error {
+	if hc.timedOut.Load() {
+		return ErrHeartbeatTimeout
+	}
+	return err
+}
+
+func (hc *HeartbeatConn) Read(buf []byte) (int, error) {
+	hc.rmu.Lock()
+	defer hc.rmu.Unlock()
+	if len(hc.buf) > 0 {
+		n := copy(buf, hc.buf)
+		hc.buf = hc.buf[n:]
+		return n, nil
+	}
+	if isClosedChan(hc.closed) {
+		return 0, net.ErrClosed
+	}
+	if hc.readDeadline.expired() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	select {
+	case p, ok := <-hc.data:
+		if !ok {
+			return 0, hc.err(hc.readErr)
+		}
+		n := copy(buf, p)
+		hc.buf = p[n:]
+		return n, nil
+	case <-hc.readDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	case <-hc.closed:
+		return 0, net.ErrClosed
+	}
+}
+
+func (hc *HeartbeatConn) Write(buf []byte) (int, error) {
+	n, err := hc.w.write(buf, &hc.writeDeadline, hc.closed)
+	if err != nil {
+		err = hc.err(err)
+	}
+	return n, err
+}
+
+// heartbeatWriter writes data frames to its conn's Conn.
+type heartbeatWriter struct {
+	hc *HeartbeatConn
+}
+
+func (w heartbeatWriter) Write(buf []byte) (int, error) {
+	w.hc.fmu.Lock()
+	defer w.hc.fmu.Unlock()
+	written := 0
+	for len(buf) > 0 {
+		chunk := buf[:minInt(len(buf), heartbeatMaxFrame)]
+		if err := w.hc.writeFrameLocked(heartbeatData, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		buf = buf[len(chunk):]
+	}
+	return written, nil
+}
+
+// Close stops the heartbeats and closes Conn.
+func (hc *HeartbeatConn) Close() error {
+	err := net.ErrClosed
+	hc.closeOnce.Do(func() {
+		close(hc.closed)
+		err = hc.Conn.Close()
+	})
+	return err
+}
+
+func (hc *HeartbeatConn) LocalAddr() net.Addr {
+	return hc.Conn.LocalAddr()
+}
+
+func (hc *HeartbeatConn) RemoteAddr() net.Addr {
+	return hc.Conn.RemoteAddr()
+}
+
+func (hc *HeartbeatConn) SetDeadline(t time.Time) error {
+	hc.readDeadline.set(t)
+	hc.writeDeadline.set(t)
+	return nil
+}
+
+func (hc *HeartbeatConn) SetReadDeadline(t time.Time) error {
+	hc.readDeadline.set(t)
+	return nil
+}
+
+func (hc *HeartbeatConn) SetWriteDeadline(t time.Time) error {
+	hc.writeDeadline.set(t)
+	return nil
+}
+
+// NetConn returns the wrapped conn.
+func (hc *HeartbeatConn) NetConn() net.Conn {
+	return hc.Conn
+}
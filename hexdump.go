@@ -0,0 +1,81 @@
+package extraio
+
+import (
+	"encoding/hex"
+	"io"
+	"sync"
+)
+
+// HexDumpWriter writes a hex dump, in the format of hex.Dump, of everything
+// written to it, with offsets counted across all writes. Once Max bytes
+// have been dumped it writes a truncation marker and discards the rest.
+// It is safe for concurrent use.
+type HexDumpWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	dumper    io.WriteCloser
+	max       int64
+	off       int64
+	truncated bool
+	closed    bool
+}
+
+// NewHexDumpWriter returns a HexDumpWriter writing to w, max <= 0 means no limit.
+func NewHexDumpWriter(w io.Writer, max int64) *HexDumpWriter {
+	return &HexDumpWriter{
+		w:      w,
+		dumper: hex.Dumper(w),
+		max:    max,
+	}
+}
+
+func (h *HexDumpWriter) Write(p []byte) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	lenp := len(p)
+	if h.closed || h.truncated {
+		h.off += int64(lenp)
+		return lenp, nil
+	}
+	if h.max > 0 {
+		if remain := h.max - h.off; int64(len(p)) > remain {
+			p = p[:remain]
+		}
+	}
+	_, err := h.dumper.Write(p)
+	h.off += int64(len(p))
+	if err != nil {
+		return len(p), err
+	}
+	if len(p) != lenp {
+		h.off += int64(lenp - len(p))
+		h.truncated = true
+		err = h.dumper.Close()
+		if err == nil {
+			_, err = io.WriteString(h.w, "... truncated ...\n")
+		}
+	}
+	return lenp, err
+}
+
+// Offset returns the number of bytes written so far, including truncated bytes.
+func (h *HexDumpWriter) Offset() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.off
+}
+
+// Close flushes the final partial line, it does not close the underlying writer.
+func (h *HexDumpWriter) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.closed = true
+	if h.truncated {
+		return nil
+	}
+	return h.dumper.Close()
+}
@@ -0,0 +1,85 @@
+package extraio
+
+// ObserverHook receives the outcome of each operation on a wrapped stream.
+// Wrappers accepting a hook call it after the operation completes.
+type ObserverHook interface {
+	OnRead(n int, err error)
+	OnWrite(n int, err error)
+	OnClose(err error)
+}
+
+// HookFuncs adapts plain functions to an ObserverHook, nil fields are skipped.
+type HookFuncs struct {
+	Read  func(n int, err error)
+	Write func(n int, err error)
+	Close func(err error)
+}
+
+func (h *HookFuncs) OnRead(n int, err error) {
+	if h.Read != nil {
+		h.Read(n, err)
+	}
+}
+
+func (h *HookFuncs) OnWrite(n int, err error) {
+	if h.Write != nil {
+		h.Write(n, err)
+	}
+}
+
+func (h *HookFuncs) OnClose(err error) {
+	if h.Close != nil {
+		h.Close(err)
+	}
+}
+
+type multiHook []ObserverHook
+
+// MultiHook returns a hook calling each of hooks in order.
+func MultiHook(hooks ...ObserverHook) ObserverHook {
+	return multiHook(hooks)
+}
+
+func (m multiHook) OnRead(n int, err error) {
+	for _, h := range m {
+		h.OnRead(n, err)
+	}
+}
+
+func (m multiHook) OnWrite(n int, err error) {
+	for _, h := range m {
+		h.OnWrite(n, err)
+	}
+}
+
+func (m multiHook) OnClose(err error) {
+	for _, h := range m {
+		h.OnClose(err)
+	}
+}
+
+type sampledHook struct {
+	s *Sampler
+	h ObserverHook
+}
+
+// SampleHook forwards reads and writes chosen by s to h, closes are always forwarded.
+func SampleHook(s *Sampler, h ObserverHook) ObserverHook {
+	return &sampledHook{s: s, h: h}
+}
+
+func (sh *sampledHook) OnRead(n int, err error) {
+	if sh.s.Sample() {
+		sh.h.OnRead(n, err)
+	}
+}
+
+func (sh *sampledHook) OnWrite(n int, err error) {
+	if sh.s.Sample() {
+		sh.h.OnWrite(n, err)
+	}
+}
+
+func (sh *sampledHook) OnClose(err error) {
+	sh.h.OnClose(err)
+}
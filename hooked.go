@@ -0,0 +1,119 @@
+package extraio
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+// DataHooks are called with the bytes transferred by each operation on a
+// HookedConn or HookedReadWriteCloser, nil fields are skipped. The slices
+// alias the caller's buffer and are only valid during the call, copy them
+// to keep them.
+type DataHooks struct {
+	// Called with buf[:n] and the error of each Read.
+	Read func(p []byte, err error)
+	// Called with buf[:n] and the error of each Write.
+	Write func(p []byte, err error)
+	Close func(err error)
+}
+
+func (h *DataHooks) onRead(p []byte, err error) {
+	if h.Read != nil {
+		h.Read(p, err)
+	}
+}
+
+func (h *DataHooks) onWrite(p []byte, err error) {
+	if h.Write != nil {
+		h.Write(p, err)
+	}
+}
+
+func (h *DataHooks) onClose(err error) {
+	if h.Close != nil {
+		h.Close(err)
+	}
+}
+
+// HookedConn calls Hooks with the data of every Read and Write and
+// the result of Close, for example to assert what went over the wire.
+type HookedConn struct {
+	Conn  net.Conn
+	Hooks DataHooks
+}
+
+func NewHookedConn(c net.Conn, hooks DataHooks) *HookedConn {
+	return &HookedConn{Conn: c, Hooks: hooks}
+}
+
+func (hc *HookedConn) Read(buf []byte) (int, error) {
+	n, err := hc.Conn.Read(buf)
+	hc.Hooks.onRead(buf[:n], err)
+	return n, err
+}
+
+func (hc *HookedConn) Write(buf []byte) (int, error) {
+	n, err := hc.Conn.Write(buf)
+	hc.Hooks.onWrite(buf[:n], err)
+	return n, err
+}
+
+func (hc *HookedConn) Close() error {
+	err := hc.Conn.Close()
+	hc.Hooks.onClose(err)
+	return err
+}
+
+func (hc *HookedConn) LocalAddr() net.Addr {
+	return hc.Conn.LocalAddr()
+}
+
+func (hc *HookedConn) RemoteAddr() net.Addr {
+	return hc.Conn.RemoteAddr()
+}
+
+func (hc *HookedConn) SetDeadline(t time.Time) error {
+	return hc.Conn.SetDeadline(t)
+}
+
+func (hc *HookedConn) SetReadDeadline(t time.Time) error {
+	return hc.Conn.SetReadDeadline(t)
+}
+
+func (hc *HookedConn) SetWriteDeadline(t time.Time) error {
+	return hc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (hc *HookedConn) NetConn() net.Conn {
+	return hc.Conn
+}
+
+// HookedReadWriteCloser is HookedConn for an io.ReadWriteCloser.
+type HookedReadWriteCloser struct {
+	RWC   io.ReadWriteCloser
+	Hooks DataHooks
+}
+
+func NewHookedReadWriteCloser(rwc io.ReadWriteCloser, hooks DataHooks) *HookedReadWriteCloser {
+	return &HookedReadWriteCloser{RWC: rwc, Hooks: hooks}
+}
+
+func (h *HookedReadWriteCloser) Read(buf []byte) (int, error) {
+	n, err := h.RWC.Read(buf)
+	h.Hooks.onRead(buf[:n], err)
+	return n, err
+}
+
+func (h *HookedReadWriteCloser) Write(buf []byte) (int, error) {
+	n, err := h.RWC.Write(buf)
+	h.Hooks.onWrite(buf[:n], err)
+	return n, err
+}
+
+func (h *HookedReadWriteCloser) Close() error {
+	err := h.RWC.Close()
+	h.Hooks.onClose(err)
+	return err
+}
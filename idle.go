@@ -0,0 +1,109 @@
+package extraio
+
+import (
+	"math"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// IdleTimeoutConn closes Conn, or calls OnIdle instead, once no bytes
+// have been read or written for Idle. The timer starts when the conn is
+// wrapped and restarts with every transfer.
+type IdleTimeoutConn struct {
+	Conn net.Conn
+	Idle time.Duration
+	// If not nil, called instead of closing Conn.
+	OnIdle func()
+
+	// UnixNano time of the last transfer.
+	last    atomic.Int64
+	expired atomic.Bool
+	closed  atomic.Bool
+	timer   *time.Timer
+}
+
+// NewIdleTimeoutConn must be used to create an IdleTimeoutConn, onIdle
+// may be nil to close the conn.
+func NewIdleTimeoutConn(c net.Conn, idle time.Duration, onIdle func()) *IdleTimeoutConn {
+	ic := &IdleTimeoutConn{Conn: c, Idle: idle, OnIdle: onIdle}
+	ic.last.Store(time.Now().UnixNano())
+	// Armed after assignment so check always sees the timer.
+	ic.timer = time.AfterFunc(time.Duration(math.MaxInt64), ic.check)
+	ic.timer.Reset(idle)
+	return ic
+}
+
+// check runs when the timer fires, rearming it for the remainder of the
+// period if there was activity meanwhile, so transfers need not touch it.
+func (ic *IdleTimeoutConn) check() {
+	if ic.closed.Load() {
+		return
+	}
+	remaining := ic.Idle - time.Since(time.Unix(0, ic.last.Load()))
+	if remaining > 0 {
+		ic.timer.Reset(remaining)
+		return
+	}
+	ic.expired.Store(true)
+	if ic.OnIdle != nil {
+		ic.OnIdle()
+		return
+	}
+	ic.Conn.Close()
+}
+
+// Expired reports whether the idle timeout has fired.
+func (ic *IdleTimeoutConn) Expired() bool {
+	return ic.expired.Load()
+}
+
+func (ic *IdleTimeoutConn) touch(n int) {
+	if n > 0 {
+		ic.last.Store(time.Now().UnixNano())
+	}
+}
+
+func (ic *IdleTimeoutConn) Read(buf []byte) (int, error) {
+	n, err := ic.Conn.Read(buf)
+	ic.touch(n)
+	return n, err
+}
+
+func (ic *IdleTimeoutConn) Write(buf []byte) (int, error) {
+	n, err := ic.Conn.Write(buf)
+	ic.touch(n)
+	return n, err
+}
+
+// Close stops the idle timer and closes Conn.
+func (ic *IdleTimeoutConn) Close() error {
+	ic.closed.Store(true)
+	ic.timer.Stop()
+	return ic.Conn.Close()
+}
+
+func (ic *IdleTimeoutConn) LocalAddr() net.Addr {
+	return ic.Conn.LocalAddr()
+}
+
+func (ic *IdleTimeoutConn) RemoteAddr() net.Addr {
+	return ic.Conn.RemoteAddr()
+}
+
+func (ic *IdleTimeoutConn) SetDeadline(t time.Time) error {
+	return ic.Conn.SetDeadline(t)
+}
+
+func (ic *IdleTimeoutConn) SetReadDeadline(t time.Time) error {
+	return ic.Conn.SetReadDeadline(t)
+}
+
+func (ic *IdleTimeoutConn) SetWriteDeadline(t time.Time) error {
+	return ic.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (ic *IdleTimeoutConn) NetConn() net.Conn {
+	return ic.Conn
+}
@@ -0,0 +1,138 @@
+package extraio
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Attr is a key/value attribute attached to recorded measurements,
+// e.g. {"net.peer.addr", "10.0.0.1:443"}.
+type Attr struct {
+	Key   string
+	Value string
+}
+
+// Instrumentation receives the measurements of an InstrumentedConn.
+// It mirrors the shape of OpenTelemetry's metric instruments and tracer,
+// so an adapter is a few lines of code without extraio depending on otel.
+type Instrumentation interface {
+	// StartSpan is called once when the conn is wrapped, ctx is the
+	// conn's ConnContext. The returned context is reported by the
+	// conn's Context method.
+	StartSpan(ctx context.Context, name string, attrs []Attr) (context.Context, Span)
+	// RecordOp is called after every Read, Write and Close with the
+	// byte count, latency and error, io.EOF included.
+	RecordOp(ctx context.Context, op Op, n int, d time.Duration, err error, attrs []Attr)
+}
+
+// Span is the lifetime of an instrumented conn, ended when it is closed.
+type Span interface {
+	End(stats Stats, err error)
+}
+
+// InstrumentedConn reports every operation on Conn to an Instrumentation,
+// within a span covering the conn's lifetime.
+type InstrumentedConn struct {
+	Conn  net.Conn
+	Inst  Instrumentation
+	Attrs []Attr
+
+	ctx        context.Context
+	span       Span
+	readCount  atomic.Int64
+	writeCount atomic.Int64
+	endOnce    sync.Once
+}
+
+// NewInstrumentedConn starts the conn's span, named "extraio.conn" or the
+// WithName name. Attributes for the peer address and network are added
+// ahead of any given with WithAttrs. Accepts WithName and WithAttrs.
+func NewInstrumentedConn(c net.Conn, inst Instrumentation, opts ...Option) *InstrumentedConn {
+	o := applyOptions(opts, optName|optAttrs, "NewInstrumentedConn")
+	name := o.name
+	if name == "" {
+		name = "extraio.conn"
+	}
+	var attrs []Attr
+	if addr := c.RemoteAddr(); addr != nil {
+		attrs = append(attrs,
+			Attr{"net.peer.addr", addr.String()},
+			Attr{"net.transport", addr.Network()})
+	}
+	attrs = append(attrs, o.attrs...)
+	ic := &InstrumentedConn{
+		Conn:  c,
+		Inst:  inst,
+		Attrs: attrs,
+	}
+	ic.ctx, ic.span = inst.StartSpan(ConnContext(c), name, attrs)
+	return ic
+}
+
+// Context returns the context holding the conn's span, so it is found
+// by ConnContext through any wrappers layered on top.
+func (ic *InstrumentedConn) Context() context.Context {
+	return ic.ctx
+}
+
+func (ic *InstrumentedConn) Stats() Stats {
+	return Stats{
+		ReadCount:  ic.readCount.Load(),
+		WriteCount: ic.writeCount.Load(),
+	}
+}
+
+func (ic *InstrumentedConn) Read(buf []byte) (int, error) {
+	start := time.Now()
+	n, err := ic.Conn.Read(buf)
+	ic.readCount.Add(int64(n))
+	ic.Inst.RecordOp(ic.ctx, OpRead, n, time.Since(start), err, ic.Attrs)
+	return n, err
+}
+
+func (ic *InstrumentedConn) Write(buf []byte) (int, error) {
+	start := time.Now()
+	n, err := ic.Conn.Write(buf)
+	ic.writeCount.Add(int64(n))
+	ic.Inst.RecordOp(ic.ctx, OpWrite, n, time.Since(start), err, ic.Attrs)
+	return n, err
+}
+
+// Close closes the conn and ends its span, only the first Close ends it.
+func (ic *InstrumentedConn) Close() error {
+	start := time.Now()
+	err := ic.Conn.Close()
+	ic.Inst.RecordOp(ic.ctx, OpClose, 0, time.Since(start), err, ic.Attrs)
+	ic.endOnce.Do(func() {
+		ic.span.End(ic.Stats(), err)
+	})
+	return err
+}
+
+func (ic *InstrumentedConn) LocalAddr() net.Addr {
+	return ic.Conn.LocalAddr()
+}
+
+func (ic *InstrumentedConn) RemoteAddr() net.Addr {
+	return ic.Conn.RemoteAddr()
+}
+
+func (ic *InstrumentedConn) SetDeadline(t time.Time) error {
+	return ic.Conn.SetDeadline(t)
+}
+
+func (ic *InstrumentedConn) SetReadDeadline(t time.Time) error {
+	return ic.Conn.SetReadDeadline(t)
+}
+
+func (ic *InstrumentedConn) SetWriteDeadline(t time.Time) error {
+	return ic.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (ic *InstrumentedConn) NetConn() net.Conn {
+	return ic.Conn
+}
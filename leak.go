@@ -0,0 +1,151 @@
+package extraio
+
+import (
+	"net"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// LeakReport describes a stream that was still open after a LeakDetector's TTL.
+type LeakReport struct {
+	Name    string
+	Created time.Time
+	Age     time.Duration
+	// Stack of the goroutine that created the stream.
+	Stack []byte
+}
+
+type leakEntry struct {
+	name     string
+	created  time.Time
+	stack    []byte
+	reported bool
+}
+
+// LeakDetector records the creation stack of tracked streams and reports
+// those not closed within TTL. Capturing stacks is expensive, so this is
+// intended as a debug mode for long running daemons.
+type LeakDetector struct {
+	TTL time.Duration
+	// Called at most once per leaked stream.
+	Report func(LeakReport)
+
+	mu      sync.Mutex
+	entries map[*leakEntry]struct{}
+	stop    chan struct{}
+}
+
+func NewLeakDetector(ttl time.Duration, report func(LeakReport)) *LeakDetector {
+	return &LeakDetector{
+		TTL:    ttl,
+		Report: report,
+	}
+}
+
+// Track records the calling stack under name and returns a function
+// that must be called when the stream is closed.
+func (d *LeakDetector) Track(name string) func() {
+	e := &leakEntry{
+		name:    name,
+		created: time.Now(),
+		stack:   debug.Stack(),
+	}
+	d.mu.Lock()
+	if d.entries == nil {
+		d.entries = make(map[*leakEntry]struct{})
+	}
+	d.entries[e] = struct{}{}
+	d.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			d.mu.Lock()
+			delete(d.entries, e)
+			d.mu.Unlock()
+		})
+	}
+}
+
+// TrackConn tracks c until its Close method is called.
+func (d *LeakDetector) TrackConn(name string, c net.Conn) net.Conn {
+	return &leakTrackedConn{
+		Conn: c,
+		done: d.Track(name),
+	}
+}
+
+// Check reports every tracked stream older than TTL not already reported.
+func (d *LeakDetector) Check() {
+	now := time.Now()
+	var leaks []LeakReport
+	d.mu.Lock()
+	for e := range d.entries {
+		if e.reported || now.Sub(e.created) < d.TTL {
+			continue
+		}
+		e.reported = true
+		leaks = append(leaks, LeakReport{
+			Name:    e.name,
+			Created: e.created,
+			Age:     now.Sub(e.created),
+			Stack:   e.stack,
+		})
+	}
+	d.mu.Unlock()
+	for _, l := range leaks {
+		d.Report(l)
+	}
+}
+
+// Start runs Check periodically in a watchdog goroutine until Stop is called.
+func (d *LeakDetector) Start() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		return
+	}
+	stop := make(chan struct{})
+	d.stop = stop
+	interval := d.TTL / 4
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.Check()
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+func (d *LeakDetector) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stop != nil {
+		close(d.stop)
+		d.stop = nil
+	}
+}
+
+type leakTrackedConn struct {
+	net.Conn
+	done func()
+}
+
+func (c *leakTrackedConn) Close() error {
+	c.done()
+	return c.Conn.Close()
+}
+
+// NetConn returns the wrapped conn.
+func (c *leakTrackedConn) NetConn() net.Conn {
+	return c.Conn
+}
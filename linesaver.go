@@ -0,0 +1,167 @@
+package extraio
+
+import (
+	"bytes"
+	"strconv"
+)
+
+const defaultMaxLineLen = 4096
+
+// LinePrefixSuffixSaver is an io.Writer like PrefixSuffixSaver that
+// retains the first N and last N lines written to it rather than bytes,
+// so captured command output is never cut mid line. Each retained line
+// keeps at most MaxLineLen bytes, longer ones end in "...", so memory
+// stays bounded whatever is written.
+type LinePrefixSuffixSaver struct {
+	N int
+	// Defaults to 4096.
+	MaxLineLen int
+	// Omission, if not nil, returns the message Bytes puts in place of
+	// the skipped lines instead of "... omitting N lines ...".
+	Omission func(skipped int64) string
+
+	prefix      []byte
+	prefixLines int
+	suffix      [][]byte // ring buffer once len(suffix) == N
+	suffixOff   int
+	// The line being written, truncated to MaxLineLen.
+	line      []byte
+	truncated bool
+	skipped   int64
+	guard     misuseGuard
+}
+
+// NewLinePrefixSuffixSaver returns a LinePrefixSuffixSaver for n lines of
+// up to maxLineLen bytes with its buffers allocated up front, so reusing it
+// with Reset never allocates. A maxLineLen <= 0 uses 4096.
+func NewLinePrefixSuffixSaver(n, maxLineLen int) *LinePrefixSuffixSaver {
+	w := &LinePrefixSuffixSaver{N: n, MaxLineLen: maxLineLen}
+	// Room for a truncated line's "..." and the newline.
+	lineCap := w.maxLineLen() + 4
+	w.prefix = make([]byte, 0, n*lineCap)
+	w.suffix = make([][]byte, n)
+	for i := range w.suffix {
+		w.suffix[i] = make([]byte, 0, lineCap)
+	}
+	w.suffix = w.suffix[:0]
+	w.line = make([]byte, 0, lineCap)
+	return w
+}
+
+func (w *LinePrefixSuffixSaver) maxLineLen() int {
+	if w.MaxLineLen <= 0 {
+		return defaultMaxLineLen
+	}
+	return w.MaxLineLen
+}
+
+func (w *LinePrefixSuffixSaver) Write(p []byte) (n int, err error) {
+	w.guard.enter("LinePrefixSuffixSaver use")
+	defer w.guard.exit()
+	lenp := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		seg := p
+		if i >= 0 {
+			seg = p[:i]
+		}
+		if room := w.maxLineLen() - len(w.line); len(seg) > room {
+			seg = seg[:maxInt(room, 0)]
+			w.truncated = true
+		}
+		w.line = append(w.line, seg...)
+		if i < 0 {
+			break
+		}
+		w.endLine()
+		p = p[i+1:]
+	}
+	return lenp, nil
+}
+
+// endLine moves the current line into the prefix or suffix.
+func (w *LinePrefixSuffixSaver) endLine() {
+	if w.truncated {
+		w.line = append(w.line, "..."...)
+		w.truncated = false
+	}
+	w.line = append(w.line, '\n')
+	switch {
+	case w.prefixLines < w.N:
+		w.prefix = append(w.prefix, w.line...)
+		w.prefixLines++
+	case len(w.suffix) < w.N:
+		// Reuse buffers kept by Reset.
+		i := len(w.suffix)
+		if i < cap(w.suffix) {
+			w.suffix = w.suffix[:i+1]
+		} else {
+			w.suffix = append(w.suffix, nil)
+		}
+		w.suffix[i] = append(w.suffix[i][:0], w.line...)
+	case w.N > 0:
+		w.suffix[w.suffixOff] = append(w.suffix[w.suffixOff][:0], w.line...)
+		w.suffixOff = (w.suffixOff + 1) % w.N
+		w.skipped++
+	default:
+		w.skipped++
+	}
+	w.line = w.line[:0]
+}
+
+// Bytes returns the retained lines, with a message saying how many
+// lines were omitted between the first and last N if any were. An
+// unterminated last line is included as written so far.
+func (w *LinePrefixSuffixSaver) Bytes() []byte {
+	w.guard.enter("LinePrefixSuffixSaver use")
+	defer w.guard.exit()
+	var buf bytes.Buffer
+	buf.Write(w.prefix)
+	if w.skipped > 0 {
+		buf.WriteString(w.omission())
+	}
+	w.writeSuffix(&buf)
+	return buf.Bytes()
+}
+
+// Reset empties the saver for reuse, keeping its buffers and settings.
+func (w *LinePrefixSuffixSaver) Reset() {
+	w.guard.enter("LinePrefixSuffixSaver use")
+	defer w.guard.exit()
+	w.prefix = w.prefix[:0]
+	w.prefixLines = 0
+	w.suffix = w.suffix[:0]
+	w.suffixOff = 0
+	w.line = w.line[:0]
+	w.truncated = false
+	w.skipped = 0
+}
+
+func (w *LinePrefixSuffixSaver) omission() string {
+	if w.Omission != nil {
+		return w.Omission(w.skipped)
+	}
+	return "... omitting " + strconv.FormatInt(w.skipped, 10) + " lines ...\n"
+}
+
+// writeSuffix writes the last lines in order, then the unterminated line.
+func (w *LinePrefixSuffixSaver) writeSuffix(buf *bytes.Buffer) {
+	for i := range w.suffix {
+		buf.Write(w.suffix[(w.suffixOff+i)%len(w.suffix)])
+	}
+	buf.Write(w.line)
+	if w.truncated {
+		buf.WriteString("...")
+	}
+}
+
+// Parts returns copies of the retained first and last lines and the
+// number of lines skipped between them, with no message added. An
+// unterminated last line is part of the suffix.
+func (w *LinePrefixSuffixSaver) Parts() (prefix, suffix []byte, skipped int64) {
+	w.guard.enter("LinePrefixSuffixSaver use")
+	defer w.guard.exit()
+	var buf bytes.Buffer
+	w.writeSuffix(&buf)
+	return append([]byte(nil), w.prefix...), buf.Bytes(), w.skipped
+}
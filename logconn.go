@@ -0,0 +1,157 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// Logger is the subset of *slog.Logger used by LoggedConn.
+type Logger interface {
+	Enabled(ctx context.Context, level slog.Level) bool
+	Log(ctx context.Context, level slog.Level, msg string, args ...any)
+}
+
+// LoggedConn emits one structured event per Read, Write and Close
+// with the op, byte count, duration and error.
+type LoggedConn struct {
+	Conn   net.Conn
+	Logger Logger
+	// Added to each event as "stream" if not empty.
+	Name string
+	// Level for successful reads and writes.
+	IOLevel slog.Level
+	// Level for Close.
+	CloseLevel slog.Level
+	// Level for any failed operation, io.EOF is not a failure.
+	ErrorLevel slog.Level
+	// if not nil, called after every operation
+	Hook ObserverHook
+}
+
+// Accepts WithName and WithHook.
+func NewLoggedConn(c net.Conn, l Logger, opts ...Option) *LoggedConn {
+	o := applyOptions(opts, optName|optHook, "NewLoggedConn")
+	return &LoggedConn{
+		Conn:       c,
+		Logger:     l,
+		Name:       o.name,
+		Hook:       o.hook,
+		IOLevel:    slog.LevelDebug,
+		CloseLevel: slog.LevelInfo,
+		ErrorLevel: slog.LevelWarn,
+	}
+}
+
+// enabled reports if any event for op could be logged, so the
+// time.Now calls can be skipped when nothing would be emitted.
+func (lc *LoggedConn) enabled(op Op) bool {
+	ctx := context.Background()
+	level := lc.IOLevel
+	if op == OpClose {
+		level = lc.CloseLevel
+	}
+	return lc.Logger.Enabled(ctx, level) || lc.Logger.Enabled(ctx, lc.ErrorLevel)
+}
+
+func (lc *LoggedConn) log(op Op, n int, d time.Duration, err error) {
+	level := lc.IOLevel
+	if op == OpClose {
+		level = lc.CloseLevel
+	}
+	if err != nil && err != io.EOF {
+		level = lc.ErrorLevel
+	}
+	ctx := context.Background()
+	if !lc.Logger.Enabled(ctx, level) {
+		return
+	}
+	args := make([]any, 0, 10)
+	if lc.Name != "" {
+		args = append(args, "stream", lc.Name)
+	}
+	args = append(args, "op", op.String())
+	if op != OpClose {
+		args = append(args, "bytes", n)
+	}
+	args = append(args, "duration", d)
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	lc.Logger.Log(ctx, level, "extraio "+op.String(), args...)
+}
+
+func (lc *LoggedConn) Read(buf []byte) (int, error) {
+	var start time.Time
+	logging := lc.enabled(OpRead)
+	if logging {
+		start = time.Now()
+	}
+	n, err := lc.Conn.Read(buf)
+	if logging {
+		lc.log(OpRead, n, time.Since(start), err)
+	}
+	if lc.Hook != nil {
+		lc.Hook.OnRead(n, err)
+	}
+	return n, err
+}
+
+func (lc *LoggedConn) Write(buf []byte) (int, error) {
+	var start time.Time
+	logging := lc.enabled(OpWrite)
+	if logging {
+		start = time.Now()
+	}
+	n, err := lc.Conn.Write(buf)
+	if logging {
+		lc.log(OpWrite, n, time.Since(start), err)
+	}
+	if lc.Hook != nil {
+		lc.Hook.OnWrite(n, err)
+	}
+	return n, err
+}
+
+func (lc *LoggedConn) Close() error {
+	var start time.Time
+	logging := lc.enabled(OpClose)
+	if logging {
+		start = time.Now()
+	}
+	err := lc.Conn.Close()
+	if logging {
+		lc.log(OpClose, 0, time.Since(start), err)
+	}
+	if lc.Hook != nil {
+		lc.Hook.OnClose(err)
+	}
+	return err
+}
+
+func (lc *LoggedConn) LocalAddr() net.Addr {
+	return lc.Conn.LocalAddr()
+}
+
+func (lc *LoggedConn) RemoteAddr() net.Addr {
+	return lc.Conn.RemoteAddr()
+}
+
+func (lc *LoggedConn) SetDeadline(t time.Time) error {
+	return lc.Conn.SetDeadline(t)
+}
+
+func (lc *LoggedConn) SetReadDeadline(t time.Time) error {
+	return lc.Conn.SetReadDeadline(t)
+}
+
+func (lc *LoggedConn) SetWriteDeadline(t time.Time) error {
+	return lc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (lc *LoggedConn) NetConn() net.Conn {
+	return lc.Conn
+}
@@ -0,0 +1,27 @@
+package extraio
+
+import "sync/atomic"
+
+// Meter accumulates byte counts, usually shared between many streams,
+// for example every connection belonging to one tenant.
+// It is safe for concurrent use.
+type Meter struct {
+	readCount  int64
+	_          [56]byte
+	writeCount int64
+}
+
+func (m *Meter) AddRead(n int64) {
+	atomic.AddInt64(&m.readCount, n)
+}
+
+func (m *Meter) AddWrite(n int64) {
+	atomic.AddInt64(&m.writeCount, n)
+}
+
+func (m *Meter) Stats() Stats {
+	return Stats{
+		ReadCount:  atomic.LoadInt64(&m.readCount),
+		WriteCount: atomic.LoadInt64(&m.writeCount),
+	}
+}
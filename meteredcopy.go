@@ -0,0 +1,91 @@
+package extraio
+
+import "io"
+
+// meteredSource and meteredSink let the ReadFrom and WriteTo methods of
+// metered wrappers see through metered wrappers on the other side of a
+// copy, so fast paths like sendfile and splice still apply with
+// both ends counting the bytes.
+type meteredSource interface {
+	innerReader() io.Reader
+	countRead(n int64, err error)
+}
+
+type meteredSink interface {
+	innerWriter() io.Writer
+	countWrite(n int64, err error)
+}
+
+// writerOnly hides a ReadFrom method to avoid recursion.
+type writerOnly struct {
+	io.Writer
+}
+
+// readerOnly hides a WriteTo method to avoid recursion.
+type readerOnly struct {
+	io.Reader
+}
+
+// meteredReadFrom copies r into dst, a metered wrapper, in kernel as
+// Splice does when the streams beneath allow, so the counters of both
+// ends advance with each chunk, and through a buffer otherwise.
+func meteredReadFrom(dst io.Writer, r io.Reader) (int64, error) {
+	if n, handled, err := kernelCopy(dst, r); handled {
+		return n, err
+	}
+	buf := getBuf()
+	defer putBuf(buf)
+	return io.CopyBuffer(writerOnly{dst}, r, *buf)
+}
+
+// meteredWriteTo copies src, a metered wrapper, into w as
+// meteredReadFrom does.
+func meteredWriteTo(src io.Reader, w io.Writer) (int64, error) {
+	if n, handled, err := kernelCopy(w, src); handled {
+		return n, err
+	}
+	buf := getBuf()
+	defer putBuf(buf)
+	return io.CopyBuffer(w, readerOnly{src}, *buf)
+}
+
+// ReadFrom keeps io.Copy's sendfile and splice fast paths where the
+// wrapped conn and r allow them, see Splice.
+func (mConn *MeteredConn) ReadFrom(r io.Reader) (int64, error) {
+	return meteredReadFrom(mConn, r)
+}
+
+// WriteTo keeps the splice fast path as ReadFrom does.
+func (mConn *MeteredConn) WriteTo(w io.Writer) (int64, error) {
+	return meteredWriteTo(mConn, w)
+}
+
+func (mConn *MeteredConn) innerReader() io.Reader { return mConn.Conn }
+func (mConn *MeteredConn) innerWriter() io.Writer { return mConn.Conn }
+
+// ReadFrom keeps the sendfile and splice fast paths, see MeteredConn.ReadFrom.
+func (mw *MeteredWriter) ReadFrom(r io.Reader) (int64, error) {
+	return meteredReadFrom(mw, r)
+}
+
+func (mw *MeteredWriter) innerWriter() io.Writer { return mw.W }
+
+// WriteTo keeps the splice fast path, see MeteredConn.ReadFrom.
+func (mw *MeteredReader) WriteTo(w io.Writer) (int64, error) {
+	return meteredWriteTo(mw, w)
+}
+
+func (mw *MeteredReader) innerReader() io.Reader { return mw.R }
+
+// ReadFrom keeps the sendfile and splice fast paths, see MeteredConn.ReadFrom.
+func (m *MeteredReadWriteCloser) ReadFrom(r io.Reader) (int64, error) {
+	return meteredReadFrom(m, r)
+}
+
+// WriteTo keeps the splice fast path, see MeteredConn.ReadFrom.
+func (m *MeteredReadWriteCloser) WriteTo(w io.Writer) (int64, error) {
+	return meteredWriteTo(m, w)
+}
+
+func (m *MeteredReadWriteCloser) innerReader() io.Reader { return m.RWC }
+func (m *MeteredReadWriteCloser) innerWriter() io.Writer { return m.RWC }
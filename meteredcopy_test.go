@@ -0,0 +1,50 @@
+package extraio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMeteredReadFromCountsAsItCopies(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	f, err := os.Create(filepath.Join(t.TempDir(), "out"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	mw := NewMeteredWriter(f)
+	done := make(chan error, 1)
+	go func() {
+		_, err := mw.ReadFrom(pr)
+		done <- err
+	}()
+
+	chunk := bytes.Repeat([]byte("x"), 4096)
+	if _, err := pw.Write(chunk); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for mw.BytesWritten() != int64(len(chunk)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("counted %d bytes while copying, want %d", mw.BytesWritten(), len(chunk))
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	pw.Write(chunk)
+	pw.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := mw.BytesWritten(); n != 2*int64(len(chunk)) {
+		t.Fatalf("counted %d bytes, want %d", n, 2*len(chunk))
+	}
+}
@@ -0,0 +1,113 @@
+package extraio
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+)
+
+// MeteredListener wraps every accepted conn in a MeteredConn
+// crediting Meter, so it holds the totals of all its conns.
+type MeteredListener struct {
+	Listener net.Listener
+	Meter    *Meter
+
+	opts     []Option
+	accepted int64
+}
+
+// Accepts the options of NewMeteredConn, applied to each conn.
+func NewMeteredListener(l net.Listener, opts ...Option) *MeteredListener {
+	applyOptions(opts, optHook|optMeters, "NewMeteredListener")
+	return &MeteredListener{
+		Listener: l,
+		Meter:    &Meter{},
+		opts:     opts,
+	}
+}
+
+func (ml *MeteredListener) Accept() (net.Conn, error) {
+	c, err := ml.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&ml.accepted, 1)
+	mc := NewMeteredConn(c, ml.opts...)
+	mc.Meters = append(mc.Meters, ml.Meter)
+	return mc, nil
+}
+
+func (ml *MeteredListener) Close() error {
+	return ml.Listener.Close()
+}
+
+func (ml *MeteredListener) Addr() net.Addr {
+	return ml.Listener.Addr()
+}
+
+func (ml *MeteredListener) Unwrap() net.Listener {
+	return ml.Listener
+}
+
+// Stats returns the totals across all accepted conns.
+func (ml *MeteredListener) Stats() Stats {
+	return ml.Meter.Stats()
+}
+
+// Accepted returns the number of conns accepted so far.
+func (ml *MeteredListener) Accepted() int64 {
+	return atomic.LoadInt64(&ml.accepted)
+}
+
+// ContextDialer is implemented by *net.Dialer among others.
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// MeteredDialer is the dialing equivalent of MeteredListener.
+type MeteredDialer struct {
+	Dialer ContextDialer
+	Meter  *Meter
+
+	opts   []Option
+	dialed int64
+}
+
+// A nil d uses a zero net.Dialer.
+// Accepts the options of NewMeteredConn, applied to each conn.
+func NewMeteredDialer(d ContextDialer, opts ...Option) *MeteredDialer {
+	if d == nil {
+		d = &net.Dialer{}
+	}
+	applyOptions(opts, optHook|optMeters, "NewMeteredDialer")
+	return &MeteredDialer{
+		Dialer: d,
+		Meter:  &Meter{},
+		opts:   opts,
+	}
+}
+
+func (md *MeteredDialer) Dial(network, address string) (net.Conn, error) {
+	return md.DialContext(context.Background(), network, address)
+}
+
+func (md *MeteredDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	c, err := md.Dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&md.dialed, 1)
+	mc := NewMeteredConn(c, md.opts...)
+	mc.Meters = append(mc.Meters, md.Meter)
+	return mc, nil
+}
+
+// Stats returns the totals across all dialed conns.
+func (md *MeteredDialer) Stats() Stats {
+	return md.Meter.Stats()
+}
+
+// Dialed returns the number of conns dialed so far.
+func (md *MeteredDialer) Dialed() int64 {
+	return atomic.LoadInt64(&md.dialed)
+}
@@ -0,0 +1,85 @@
+// Package metrics exports the streams and meters of an extraio.Registry
+// with expvar or in the Prometheus text format, keeping those imports out
+// of extraio itself. Building with the extraio_prometheus tag adds a
+// Collector for the Prometheus client library.
+package metrics
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/andrewchambers/extraio"
+)
+
+// Var returns an expvar.Var reporting r's streams and meters as JSON,
+// evaluated each time it is read.
+func Var(r *extraio.Registry) expvar.Var {
+	return expvar.Func(func() any {
+		return struct {
+			Streams []extraio.StreamInfo
+			Meters  map[string]extraio.Stats
+		}{r.Streams(), r.Meters()}
+	})
+}
+
+// Publish publishes r with expvar under name, so it appears on
+// /debug/vars. Like expvar.Publish it panics if name is already in use.
+func Publish(name string, r *extraio.Registry) {
+	expvar.Publish(name, Var(r))
+}
+
+// WritePrometheus writes r's counters to w in the Prometheus text
+// exposition format.
+//
+// The metrics are extraio_streams, extraio_stream_{read,write}_bytes_total
+// labelled by stream and extraio_meter_{read,write}_bytes_total labelled
+// by meter. The stream counters are r.Totals, so streams sharing a name
+// are summed together and removed streams still count.
+func WritePrometheus(w io.Writer, r *extraio.Registry) error {
+	streams := len(r.Streams())
+	totals := r.Totals()
+	meters := r.Meters()
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# HELP extraio_streams Number of registered streams.\n")
+	fmt.Fprintf(bw, "# TYPE extraio_streams gauge\n")
+	fmt.Fprintf(bw, "extraio_streams %d\n", streams)
+	writeCounters(bw, "extraio_stream_read_bytes_total", "Bytes read by streams registered under each name.", "stream", totals, func(s extraio.Stats) int64 { return s.ReadCount })
+	writeCounters(bw, "extraio_stream_write_bytes_total", "Bytes written by streams registered under each name.", "stream", totals, func(s extraio.Stats) int64 { return s.WriteCount })
+	writeCounters(bw, "extraio_meter_read_bytes_total", "Bytes read by streams attached to each meter.", "meter", meters, func(s extraio.Stats) int64 { return s.ReadCount })
+	writeCounters(bw, "extraio_meter_write_bytes_total", "Bytes written by streams attached to each meter.", "meter", meters, func(s extraio.Stats) int64 { return s.WriteCount })
+	return bw.Flush()
+}
+
+func writeCounters(w io.Writer, metric, help, label string, stats map[string]extraio.Stats, value func(extraio.Stats) int64) {
+	if len(stats) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(stats))
+	for k := range stats {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fmt.Fprintf(w, "# HELP %s %s\n", metric, help)
+	fmt.Fprintf(w, "# TYPE %s counter\n", metric)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", metric, label, labelEscaper.Replace(k), value(stats[k]))
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Handler returns an http.Handler serving WritePrometheus, suitable for
+// mounting at /metrics or scraping alongside another exporter without
+// depending on the Prometheus client library.
+func Handler(r *extraio.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, r)
+	})
+}
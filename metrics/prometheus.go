@@ -0,0 +1,54 @@
+//go:build extraio_prometheus
+
+package metrics
+
+import (
+	"github.com/andrewchambers/extraio"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector for the same metrics as
+// WritePrometheus, for programs already using the Prometheus client
+// library. It is only built with the extraio_prometheus tag, so the
+// client library is not a dependency otherwise.
+type Collector struct {
+	r *extraio.Registry
+}
+
+var (
+	streamsDesc = prometheus.NewDesc("extraio_streams",
+		"Number of registered streams.", nil, nil)
+	streamReadDesc = prometheus.NewDesc("extraio_stream_read_bytes_total",
+		"Bytes read by streams registered under each name.", []string{"stream"}, nil)
+	streamWriteDesc = prometheus.NewDesc("extraio_stream_write_bytes_total",
+		"Bytes written by streams registered under each name.", []string{"stream"}, nil)
+	meterReadDesc = prometheus.NewDesc("extraio_meter_read_bytes_total",
+		"Bytes read by streams attached to each meter.", []string{"meter"}, nil)
+	meterWriteDesc = prometheus.NewDesc("extraio_meter_write_bytes_total",
+		"Bytes written by streams attached to each meter.", []string{"meter"}, nil)
+)
+
+// NewCollector returns a Collector reading r each time it is scraped.
+func NewCollector(r *extraio.Registry) *Collector {
+	return &Collector{r: r}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- streamsDesc
+	ch <- streamReadDesc
+	ch <- streamWriteDesc
+	ch <- meterReadDesc
+	ch <- meterWriteDesc
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(streamsDesc, prometheus.GaugeValue, float64(len(c.r.Streams())))
+	for name, s := range c.r.Totals() {
+		ch <- prometheus.MustNewConstMetric(streamReadDesc, prometheus.CounterValue, float64(s.ReadCount), name)
+		ch <- prometheus.MustNewConstMetric(streamWriteDesc, prometheus.CounterValue, float64(s.WriteCount), name)
+	}
+	for label, s := range c.r.Meters() {
+		ch <- prometheus.MustNewConstMetric(meterReadDesc, prometheus.CounterValue, float64(s.ReadCount), label)
+		ch <- prometheus.MustNewConstMetric(meterWriteDesc, prometheus.CounterValue, float64(s.WriteCount), label)
+	}
+}
@@ -0,0 +1,56 @@
+//go:build extraio_prometheus
+
+package metrics
+
+import (
+	"io"
+	"testing"
+
+	"github.com/andrewchambers/extraio"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollector(t *testing.T) {
+	r := &extraio.Registry{}
+	mw := extraio.NewMeteredWriter(io.Discard, extraio.WithMeters(r.Meter("upload")))
+	r.Register("backup", mw)
+	mw.Write(make([]byte, 100))
+	remove := r.Register("backup", extraio.NewMeteredReader(nil))
+	remove()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(NewCollector(r))
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]float64)
+	for _, f := range families {
+		for _, m := range f.GetMetric() {
+			key := f.GetName()
+			for _, l := range m.GetLabel() {
+				key += "/" + l.GetValue()
+			}
+			if c := m.GetCounter(); c != nil {
+				got[key] = c.GetValue()
+			} else {
+				got[key] = m.GetGauge().GetValue()
+			}
+		}
+	}
+	want := map[string]float64{
+		"extraio_streams":                         1,
+		"extraio_stream_read_bytes_total/backup":  0,
+		"extraio_stream_write_bytes_total/backup": 100,
+		"extraio_meter_read_bytes_total/upload":   0,
+		"extraio_meter_write_bytes_total/upload":  100,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package extraio
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+var misuseDetection atomic.Bool
+
+// SetMisuseDetection turns on checks that panic when types documented as
+// not safe for concurrent use are used from two goroutines at once, such as
+// PrefixSuffixSaver, BufferedReadWriteCloser and TempFile. The panic
+// includes the stacks of both goroutines. It is meant for debugging and
+// records a stack trace on every checked call.
+func SetMisuseDetection(enabled bool) {
+	misuseDetection.Store(enabled)
+}
+
+// misuseGuard detects overlapping calls, the zero value is ready to use.
+type misuseGuard struct {
+	busy  atomic.Bool
+	stack atomic.Pointer[[]byte]
+}
+
+func (g *misuseGuard) enter(what string) {
+	if !misuseDetection.Load() {
+		return
+	}
+	if !g.busy.CompareAndSwap(false, true) {
+		other := []byte("unavailable\n")
+		if s := g.stack.Load(); s != nil {
+			other = *s
+		}
+		panic(fmt.Sprintf("extraio: concurrent %s\n\nthis goroutine:\n%s\nother goroutine:\n%s", what, debug.Stack(), other))
+	}
+	s := debug.Stack()
+	g.stack.Store(&s)
+}
+
+func (g *misuseGuard) exit() {
+	if g.busy.Load() {
+		g.stack.Store(nil)
+		g.busy.Store(false)
+	}
+}
@@ -0,0 +1,524 @@
+package extraio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// Mux frames are type(1) stream id(uint32) length(uint32), big endian,
+// followed by length bytes for data frames. For window frames length is
+// the number of bytes granted, other frames have no payload.
+//
+// The top bit of a stream id on the wire is set if the sender opened the
+// stream, so both ends can open streams without coordinating ids. Locally
+// the top bit of a stream's id is set if the peer opened it, so ids of
+// incoming frames need no translation.
+const (
+	muxHeaderLen = 9
+	muxPeerBit   = 1 << 31
+	// Bytes a stream may receive before its reader makes room.
+	muxWindowSize = 256 * 1024
+	muxMaxFrame   = 32 * 1024
+	// Streams opened by the peer and not yet accepted, beyond which new
+	// ones are closed straight away.
+	muxMaxBacklog = 256
+
+	muxOpen   = 'o'
+	muxData   = 'd'
+	muxWindow = 'w'
+	// The sender will write no more.
+	muxFin = 'f'
+	// The sender will write no more and is no longer reading.
+	muxClose = 'c'
+)
+
+var (
+	ErrMuxClosed   = errors.New("extraio: mux closed")
+	ErrBadMuxFrame = errors.New("extraio: malformed mux frame")
+)
+
+// Mux carries independent streams over one io.ReadWriteCloser, such as a
+// CmdReadWriteCloser or one end of a SocketPair. Either end may Open a
+// stream, which the other end receives from Accept.
+//
+// Each stream has its own flow control window, so a stream whose reader
+// falls behind does not hold up the others. Once 256 streams are waiting
+// for Accept, streams the peer opens are closed at once, its reads of
+// them return io.EOF and its writes io.ErrClosedPipe. NewMux must be used to create
+// a Mux, it is safe for concurrent use.
+//
+// Each stream has a Stats method like MeteredConn's, and the Mux's Stats
+// are the totals of all its streams, past and present.
+type Mux struct {
+	RWC io.ReadWriteCloser
+	// also credited with the payload bytes of every stream
+	Meters []*Meter
+
+	// Payload bytes read and written by all streams.
+	readCount  atomic.Int64
+	writeCount atomic.Int64
+	// Frames and bytes, headers included, on RWC.
+	framesRead    atomic.Int64
+	framesWritten atomic.Int64
+	wire          Meter
+
+	// Serializes frames.
+	wmu sync.Mutex
+
+	mu       sync.Mutex
+	streams  map[uint32]*MuxStream
+	nextID   uint32
+	backlog  []*MuxStream
+	accepted chan struct{}
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	// Set before closed is closed.
+	err error
+}
+
+// NewMux starts a Mux on rwc, which it reads from until closed. The other
+// end of rwc must also be a Mux. Accepts WithMeters.
+func NewMux(rwc io.ReadWriteCloser, opts ...Option) *Mux {
+	o := applyOptions(opts, optMeters, "NewMux")
+	m := &Mux{
+		RWC:      rwc,
+		Meters:   o.meters,
+		streams:  make(map[uint32]*MuxStream),
+		accepted: make(chan struct{}, 1),
+		closed:   make(chan struct{}),
+	}
+	go m.readLoop()
+	return m
+}
+
+// fail stops the mux with err, closing RWC and waking every stream. Only
+// the first call has any effect, it returns the error from closing RWC.
+func (m *Mux) fail(err error) error {
+	var cerr error
+	m.closeOnce.Do(func() {
+		m.err = err
+		close(m.closed)
+		cerr = m.RWC.Close()
+		m.mu.Lock()
+		streams := make([]*MuxStream, 0, len(m.streams))
+		for _, s := range m.streams {
+			streams = append(streams, s)
+		}
+		m.mu.Unlock()
+		for _, s := range streams {
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		}
+	})
+	return cerr
+}
+
+// Close closes RWC, failing every stream and pending Accept with
+// ErrMuxClosed.
+func (m *Mux) Close() error {
+	return m.fail(ErrMuxClosed)
+}
+
+// Stats returns the payload bytes read and written by all streams.
+func (m *Mux) Stats() Stats {
+	return Stats{ReadCount: m.readCount.Load(), WriteCount: m.writeCount.Load()}
+}
+
+// WireStats returns the bytes read and written on RWC, frame headers
+// and flow control included.
+func (m *Mux) WireStats() Stats {
+	return m.wire.Stats()
+}
+
+// Frames returns the number of frames read and written on RWC.
+func (m *Mux) Frames() (read, written int64) {
+	return m.framesRead.Load(), m.framesWritten.Load()
+}
+
+func (m *Mux) countRead(n int) {
+	m.readCount.Add(int64(n))
+	for _, mt := range m.Meters {
+		mt.AddRead(int64(n))
+	}
+}
+
+func (m *Mux) countWrite(n int) {
+	m.writeCount.Add(int64(n))
+	for _, mt := range m.Meters {
+		mt.AddWrite(int64(n))
+	}
+}
+
+// Open starts a new stream, which the other end receives from Accept.
+func (m *Mux) Open() (*MuxStream, error) {
+	m.mu.Lock()
+	if isClosedChan(m.closed) {
+		m.mu.Unlock()
+		return nil, m.err
+	}
+	if m.nextID == muxPeerBit-1 {
+		m.mu.Unlock()
+		return nil, errors.New("extraio: mux stream ids exhausted")
+	}
+	m.nextID++
+	s := newMuxStream(m, m.nextID)
+	m.streams[s.id] = s
+	m.mu.Unlock()
+	if err := m.writeFrame(muxOpen, s.id, 0, nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Accept waits for the other end to Open a stream.
+func (m *Mux) Accept() (*MuxStream, error) {
+	for {
+		m.mu.Lock()
+		if len(m.backlog) > 0 {
+			s := m.backlog[0]
+			m.backlog = m.backlog[1:]
+			m.mu.Unlock()
+			return s, nil
+		}
+		m.mu.Unlock()
+		select {
+		case <-m.accepted:
+		case <-m.closed:
+			return nil, m.err
+		}
+	}
+}
+
+func (m *Mux) stream(id uint32) *MuxStream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.streams[id]
+}
+
+func (m *Mux) remove(id uint32) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.streams, id)
+}
+
+// writeFrame sends a frame for stream id, with payload for data frames
+// and n otherwise. Any error fails the mux.
+func (m *Mux) writeFrame(typ byte, id uint32, n uint32, payload []byte) error {
+	if payload != nil {
+		n = uint32(len(payload))
+	}
+	var hdr [muxHeaderLen]byte
+	hdr[0] = typ
+	binary.BigEndian.PutUint32(hdr[1:], id^muxPeerBit)
+	binary.BigEndian.PutUint32(hdr[5:], n)
+	m.wmu.Lock()
+	defer m.wmu.Unlock()
+	if isClosedChan(m.closed) {
+		return m.err
+	}
+	if _, err := writeBuffers(m.RWC, [][]byte{hdr[:], payload}); err != nil {
+		m.fail(err)
+		return err
+	}
+	m.framesWritten.Add(1)
+	m.wire.AddWrite(int64(muxHeaderLen + len(payload)))
+	return nil
+}
+
+func (m *Mux) readLoop() {
+	var hdr [muxHeaderLen]byte
+	for {
+		if _, err := io.ReadFull(m.RWC, hdr[:]); err != nil {
+			if err == io.EOF {
+				err = ErrMuxClosed
+			}
+			m.fail(err)
+			return
+		}
+		m.framesRead.Add(1)
+		m.wire.AddRead(muxHeaderLen)
+		typ := hdr[0]
+		id := binary.BigEndian.Uint32(hdr[1:])
+		n := binary.BigEndian.Uint32(hdr[5:])
+		if typ != muxData && typ != muxWindow && n != 0 {
+			m.fail(ErrBadMuxFrame)
+			return
+		}
+		switch typ {
+		case muxData:
+			if n > muxMaxFrame {
+				m.fail(ErrBadMuxFrame)
+				return
+			}
+			payload := make([]byte, n)
+			if _, err := io.ReadFull(m.RWC, payload); err != nil {
+				m.fail(noEOF(err))
+				return
+			}
+			m.wire.AddRead(int64(n))
+			if s := m.stream(id); s != nil && !s.push(payload) {
+				m.fail(ErrBadMuxFrame)
+				return
+			}
+		case muxWindow:
+			if s := m.stream(id); s != nil {
+				s.grant(int(n))
+			}
+		case muxOpen:
+			if !m.accept(id) {
+				m.fail(ErrBadMuxFrame)
+				return
+			}
+		case muxFin, muxClose:
+			if s := m.stream(id); s != nil && s.finished(typ == muxClose) {
+				m.remove(id)
+			}
+		default:
+			m.fail(ErrBadMuxFrame)
+			return
+		}
+	}
+}
+
+// accept queues a stream opened by the peer, reporting false if id is
+// not a valid new id. If the backlog is full the stream is closed instead,
+// later frames for it are ignored.
+func (m *Mux) accept(id uint32) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id&muxPeerBit == 0 || m.streams[id] != nil {
+		return false
+	}
+	if len(m.backlog) >= muxMaxBacklog {
+		// Not from readLoop, a peer that is itself blocked writing
+		// would never read the frame.
+		go m.writeFrame(muxClose, id, 0, nil)
+		return true
+	}
+	s := newMuxStream(m, id)
+	m.streams[id] = s
+	m.backlog = append(m.backlog, s)
+	select {
+	case m.accepted <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+// MuxStream is one stream of a Mux. Reads and Writes may run concurrently,
+// concurrent Writes do not interleave.
+type MuxStream struct {
+	mux *Mux
+	id  uint32
+
+	// Serializes writes and the frames ending them.
+	wmu sync.Mutex
+
+	mu   sync.Mutex
+	cond sync.Cond
+	buf  bytes.Buffer
+	// Bytes read but not yet granted back to the peer.
+	unacked    int
+	sendWindow int
+	// Payload bytes read and written, and the most buffered at once.
+	readCount   int64
+	writeCount  int64
+	maxBuffered int
+	// Close was called.
+	closed bool
+	// Close or CloseWrite was called.
+	writeClosed bool
+	// The peer sent muxFin or muxClose.
+	remoteFin bool
+	// The peer sent muxClose.
+	remoteClosed bool
+}
+
+func newMuxStream(m *Mux, id uint32) *MuxStream {
+	s := &MuxStream{mux: m, id: id, sendWindow: muxWindowSize}
+	s.cond.L = &s.mu
+	return s
+}
+
+// ID returns the stream id, unique among the streams of its Mux.
+func (s *MuxStream) ID() uint32 {
+	return s.id
+}
+
+// Buffered returns the number of bytes received but not yet read.
+func (s *MuxStream) Buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Len()
+}
+
+// Stats returns the payload bytes read and written, and the most that
+// were waiting to be read at once, at most the 256KiB window.
+func (s *MuxStream) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Stats{
+		ReadCount:   s.readCount,
+		WriteCount:  s.writeCount,
+		MaxBuffered: int64(s.maxBuffered),
+	}
+}
+
+// push buffers data from the peer, reporting false if the peer overran
+// the window. Data for a closed stream is dropped.
+func (s *MuxStream) push(p []byte) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+	if s.buf.Len()+s.unacked+len(p) > muxWindowSize {
+		return false
+	}
+	s.buf.Write(p)
+	s.maxBuffered = maxInt(s.maxBuffered, s.buf.Len())
+	s.cond.Broadcast()
+	return true
+}
+
+func (s *MuxStream) grant(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sendWindow += n
+	s.cond.Broadcast()
+}
+
+// finished records the end of the peer's writes, reporting whether the
+// stream is now done in both directions.
+func (s *MuxStream) finished(closed bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.remoteFin = true
+	if closed {
+		s.remoteClosed = true
+	}
+	s.cond.Broadcast()
+	return s.closed
+}
+
+// Read returns io.EOF once the peer has called Close or CloseWrite and
+// everything it wrote has been read.
+func (s *MuxStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	for s.buf.Len() == 0 {
+		var err error
+		switch {
+		case s.closed:
+			err = io.ErrClosedPipe
+		case s.remoteFin:
+			err = io.EOF
+		case isClosedChan(s.mux.closed):
+			err = s.mux.err
+		}
+		if err != nil || len(p) == 0 {
+			s.mu.Unlock()
+			return 0, err
+		}
+		s.cond.Wait()
+	}
+	n, _ := s.buf.Read(p)
+	s.readCount += int64(n)
+	s.mux.countRead(n)
+	s.unacked += n
+	grant := 0
+	if s.unacked >= muxWindowSize/2 && !s.remoteFin {
+		grant, s.unacked = s.unacked, 0
+	}
+	s.mu.Unlock()
+	if grant > 0 {
+		// An error fails the mux, which the next call reports.
+		s.mux.writeFrame(muxWindow, s.id, uint32(grant), nil)
+	}
+	return n, nil
+}
+
+func (s *MuxStream) writeErrLocked() error {
+	switch {
+	case s.writeClosed, s.remoteClosed:
+		return io.ErrClosedPipe
+	case isClosedChan(s.mux.closed):
+		return s.mux.err
+	}
+	return nil
+}
+
+// Write blocks while the peer's window is full. Once the peer has called
+// Close it fails with io.ErrClosedPipe.
+func (s *MuxStream) Write(p []byte) (int, error) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	written := 0
+	for len(p) > 0 {
+		s.mu.Lock()
+		for s.sendWindow == 0 && s.writeErrLocked() == nil {
+			s.cond.Wait()
+		}
+		if err := s.writeErrLocked(); err != nil {
+			s.mu.Unlock()
+			return written, err
+		}
+		n := min(len(p), s.sendWindow, muxMaxFrame)
+		s.sendWindow -= n
+		s.mu.Unlock()
+		if err := s.mux.writeFrame(muxData, s.id, 0, p[:n]); err != nil {
+			return written, err
+		}
+		s.mu.Lock()
+		s.writeCount += int64(n)
+		s.mu.Unlock()
+		s.mux.countWrite(n)
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// CloseWrite tells the peer no more data is coming, its reads return
+// io.EOF, while this end can still read.
+func (s *MuxStream) CloseWrite() error {
+	s.mu.Lock()
+	if s.writeClosed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.writeClosed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	return s.mux.writeFrame(muxFin, s.id, 0, nil)
+}
+
+// Close ends both directions, unread data is discarded and the peer's
+// writes fail. A stream stays in its Mux until the peer also closes it.
+func (s *MuxStream) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.writeClosed = true
+	s.buf = bytes.Buffer{}
+	done := s.remoteFin
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.wmu.Lock()
+	err := s.mux.writeFrame(muxClose, s.id, 0, nil)
+	s.wmu.Unlock()
+	if done {
+		s.mux.remove(s.id)
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package extraio
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func muxPair(t *testing.T) (*Mux, *Mux) {
+	a, b := SocketPair()
+	ma, mb := NewMux(a), NewMux(b)
+	t.Cleanup(func() {
+		ma.Close()
+		mb.Close()
+	})
+	return ma, mb
+}
+
+func TestMuxBacklogFull(t *testing.T) {
+	client, server := muxPair(t)
+	for i := 0; i < muxMaxBacklog; i++ {
+		if _, err := client.Open(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read from refused stream: %v, want io.EOF", err)
+	}
+	if _, err := s.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Fatalf("write to refused stream: %v, want io.ErrClosedPipe", err)
+	}
+	for i := 0; i < muxMaxBacklog; i++ {
+		if _, err := server.Accept(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMuxFlowControl(t *testing.T) {
+	client, server := muxPair(t)
+	slow, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	slowPeer, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("x"), 2*muxWindowSize)
+	done := make(chan error, 1)
+	go func() {
+		_, err := slow.Write(data)
+		done <- err
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for slowPeer.Buffered() < muxWindowSize {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d bytes buffered, want the %d byte window", slowPeer.Buffered(), muxWindowSize)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("write overran the window: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// A full window on one stream does not hold up another.
+	fast, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fastPeer, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fast.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(fastPeer, buf); err != nil || string(buf) != "hello" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(slowPeer, got); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data mismatch")
+	}
+	if st := slowPeer.Stats(); st.MaxBuffered > muxWindowSize {
+		t.Fatalf("buffered %d bytes, more than the window", st.MaxBuffered)
+	}
+}
+
+func TestMuxStreamClose(t *testing.T) {
+	client, server := muxPair(t)
+	s, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := server.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CloseWrite delivers what was written, then io.EOF, while the
+	// other direction stays open.
+	s.Write([]byte("bye"))
+	s.CloseWrite()
+	got, err := io.ReadAll(peer)
+	if err != nil || string(got) != "bye" {
+		t.Fatalf("read %q, %v", got, err)
+	}
+	if _, err := peer.Write([]byte("back")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(s, buf); err != nil || string(buf) != "back" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+
+	// Close makes the other end's writes fail.
+	peer.Close()
+	if _, err := peer.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Fatalf("write after Close: %v, want io.ErrClosedPipe", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		_, err := s.Write([]byte("x"))
+		if err == io.ErrClosedPipe {
+			break
+		}
+		if err != nil || time.Now().After(deadline) {
+			t.Fatalf("write to closed stream: %v, want io.ErrClosedPipe", err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Close()
+	deadline = time.Now().Add(5 * time.Second)
+	for client.stream(s.ID()) != nil || server.stream(peer.ID()) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("closed stream still held by its mux")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMuxCloseFailsStreams(t *testing.T) {
+	client, server := muxPair(t)
+	s, err := client.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	client.Close()
+	if _, err := s.Read(make([]byte, 1)); err != ErrMuxClosed {
+		t.Fatalf("read after mux Close: %v, want ErrMuxClosed", err)
+	}
+	if _, err := server.Accept(); err != ErrMuxClosed {
+		t.Fatalf("Accept after peer closed: %v, want ErrMuxClosed", err)
+	}
+}
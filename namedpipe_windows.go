@@ -0,0 +1,262 @@
+//go:build windows
+
+package extraio
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Windows named pipe transport. Handles are opened for overlapped IO and
+// handed to os.NewFile, so reads and writes go through the runtime poller
+// and support deadlines.
+
+const pipeBufferSize = 64 * 1024
+
+// PipeAddr is the name of a Windows named pipe, e.g. `\\.\pipe\myapp`.
+type PipeAddr string
+
+func (a PipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a PipeAddr) String() string {
+	return string(a)
+}
+
+func createPipeInstance(name string, first bool) (windows.Handle, error) {
+	path, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+	h, err := windows.CreateNamedPipe(path, flags, mode, windows.PIPE_UNLIMITED_INSTANCES, pipeBufferSize, pipeBufferSize, 0, nil)
+	if err != nil {
+		return windows.InvalidHandle, os.NewSyscallError("CreateNamedPipe", err)
+	}
+	return h, nil
+}
+
+type namedPipeListener struct {
+	name   string
+	closed atomic.Bool
+	// signalled by Close to abort a pending Accept.
+	closeEvent windows.Handle
+	closeOnce  sync.Once
+
+	// mu serializes Accept, protecting next and ov.
+	mu   sync.Mutex
+	next windows.Handle
+	// heap allocated so the kernel can write to it while Accept waits.
+	ov windows.Overlapped
+}
+
+// ListenPipe creates the named pipe name and listens for local clients.
+func ListenPipe(name string) (net.Listener, error) {
+	h, err := createPipeInstance(name, true)
+	if err != nil {
+		return nil, &net.OpError{Op: "listen", Net: "pipe", Addr: PipeAddr(name), Err: err}
+	}
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, os.NewSyscallError("CreateEvent", err)
+	}
+	return &namedPipeListener{
+		name:       name,
+		closeEvent: ev,
+		next:       h,
+	}, nil
+}
+
+func (l *namedPipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed.Load() {
+		return nil, l.opError(net.ErrClosed)
+	}
+	h := l.next
+	l.next = windows.InvalidHandle
+	if h == windows.InvalidHandle {
+		var err error
+		h, err = createPipeInstance(l.name, false)
+		if err != nil {
+			return nil, l.opError(err)
+		}
+	}
+	ev, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		windows.CloseHandle(h)
+		return nil, l.opError(os.NewSyscallError("CreateEvent", err))
+	}
+	defer windows.CloseHandle(ev)
+	l.ov = windows.Overlapped{HEvent: ev}
+
+	err = windows.ConnectNamedPipe(h, &l.ov)
+	switch err {
+	case nil, windows.ERROR_PIPE_CONNECTED:
+	case windows.ERROR_IO_PENDING:
+		idx, werr := windows.WaitForMultipleObjects([]windows.Handle{ev, l.closeEvent}, false, windows.INFINITE)
+		var n uint32
+		if werr != nil || idx != windows.WAIT_OBJECT_0 {
+			windows.CancelIoEx(h, &l.ov)
+			windows.GetOverlappedResult(h, &l.ov, &n, true)
+			windows.CloseHandle(h)
+			if werr != nil {
+				return nil, l.opError(os.NewSyscallError("WaitForMultipleObjects", werr))
+			}
+			return nil, l.opError(net.ErrClosed)
+		}
+		if err := windows.GetOverlappedResult(h, &l.ov, &n, false); err != nil {
+			windows.CloseHandle(h)
+			return nil, l.opError(os.NewSyscallError("ConnectNamedPipe", err))
+		}
+	default:
+		windows.CloseHandle(h)
+		return nil, l.opError(os.NewSyscallError("ConnectNamedPipe", err))
+	}
+	return newPipeConn(h, l.name), nil
+}
+
+func (l *namedPipeListener) opError(err error) error {
+	return &net.OpError{Op: "accept", Net: "pipe", Addr: PipeAddr(l.name), Err: err}
+}
+
+func (l *namedPipeListener) Close() error {
+	l.closeOnce.Do(func() {
+		l.closed.Store(true)
+		windows.SetEvent(l.closeEvent)
+		// Wait for any Accept to observe the close.
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if l.next != windows.InvalidHandle {
+			windows.CloseHandle(l.next)
+			l.next = windows.InvalidHandle
+		}
+		windows.CloseHandle(l.closeEvent)
+	})
+	return nil
+}
+
+func (l *namedPipeListener) Addr() net.Addr {
+	return PipeAddr(l.name)
+}
+
+// DialPipe connects to the named pipe name, waiting while
+// all instances are busy until ctx is done.
+func DialPipe(ctx context.Context, name string) (net.Conn, error) {
+	path, err := windows.UTF16PtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		h, err := windows.CreateFile(path, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING, windows.FILE_FLAG_OVERLAPPED, 0)
+		if err == nil {
+			return newPipeConn(h, name), nil
+		}
+		if err != windows.ERROR_PIPE_BUSY {
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: PipeAddr(name), Err: os.NewSyscallError("CreateFile", err)}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, &net.OpError{Op: "dial", Net: "pipe", Addr: PipeAddr(name), Err: ctx.Err()}
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// SocketPairOS returns two connected named pipe endpoints
+// backed by real handles, under a unique pipe name.
+func SocketPairOS() (net.Conn, net.Conn, error) {
+	var nonce [8]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, nil, err
+	}
+	name := fmt.Sprintf(`\\.\pipe\extraio-%d-%s`, os.Getpid(), hex.EncodeToString(nonce[:]))
+	l, err := ListenPipe(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer l.Close()
+
+	type result struct {
+		c   net.Conn
+		err error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		c, err := l.Accept()
+		accepted <- result{c, err}
+	}()
+	b, err := DialPipe(context.Background(), name)
+	if err != nil {
+		l.Close()
+		if r := <-accepted; r.c != nil {
+			r.c.Close()
+		}
+		return nil, nil, err
+	}
+	r := <-accepted
+	if r.err != nil {
+		b.Close()
+		return nil, nil, r.err
+	}
+	return r.c, b, nil
+}
+
+type pipeConn struct {
+	f    *os.File
+	addr PipeAddr
+}
+
+func newPipeConn(h windows.Handle, name string) *pipeConn {
+	return &pipeConn{
+		f:    os.NewFile(uintptr(h), name),
+		addr: PipeAddr(name),
+	}
+}
+
+func (c *pipeConn) Read(buf []byte) (int, error) {
+	return c.f.Read(buf)
+}
+
+func (c *pipeConn) Write(buf []byte) (int, error) {
+	return c.f.Write(buf)
+}
+
+func (c *pipeConn) Close() error {
+	return c.f.Close()
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	return c.f.SetDeadline(t)
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	return c.f.SetReadDeadline(t)
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	return c.f.SetWriteDeadline(t)
+}
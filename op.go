@@ -0,0 +1,43 @@
+package extraio
+
+import "fmt"
+
+// Op identifies an operation on a stream.
+type Op int
+
+const (
+	OpRead Op = iota + 1
+	OpWrite
+	OpClose
+)
+
+func (op Op) String() string {
+	switch op {
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpClose:
+		return "close"
+	default:
+		return "unknown"
+	}
+}
+
+func (op Op) MarshalText() ([]byte, error) {
+	return []byte(op.String()), nil
+}
+
+func (op *Op) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "read":
+		*op = OpRead
+	case "write":
+		*op = OpWrite
+	case "close":
+		*op = OpClose
+	default:
+		return fmt.Errorf("extraio: unknown op %q", text)
+	}
+	return nil
+}
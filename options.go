@@ -0,0 +1,359 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"math/bits"
+	"math/rand/v2"
+	"net"
+	"os"
+	"time"
+)
+
+// Option configures the constructors in this package that accept options.
+// Each constructor documents the options it accepts, passing it any other
+// option is a programming error and panics.
+type Option struct {
+	kind  optionKind
+	apply func(*options)
+}
+
+// optionKind identifies an option, sets of them are or'd together.
+type optionKind uint32
+
+const (
+	optHook optionKind = 1 << iota
+	optName
+	optStderr
+	optContext
+	optBackoff
+	optMeters
+	optLines
+	optProgress
+	optSegmentSize
+	optCoalesce
+	optBufferSize
+	optExtraFiles
+	optCloseInherited
+	optFDCheck
+	optCompression
+	optGrace
+	optStderrCapture
+	optAttrs
+	optSeed
+	optFixedLength
+	optMaxMessageSize
+	optHandshake
+	optCodecs
+	optAutoTune
+	optClock
+	optIdleFlush
+
+	// Accepted by everything starting a command.
+	optCmdFDs = optExtraFiles | optCloseInherited | optFDCheck
+	optCmd    = optStderr | optContext | optGrace | optStderrCapture | optCmdFDs
+	optFrames = optFixedLength | optMaxMessageSize
+)
+
+var optionNames = [...]string{
+	"WithHook", "WithName", "WithStderr", "WithContext", "WithBackoff",
+	"WithMeters", "WithLines", "WithProgress", "WithSegmentSize",
+	"WithCoalesce", "WithBufferSize", "WithExtraFiles", "WithCloseInherited",
+	"WithFDCheck", "WithCompression", "WithGrace", "WithStderrCapture",
+	"WithAttrs", "WithSeed", "WithFixedLength", "WithMaxMessageSize",
+	"WithHandshake", "WithCodecs", "WithAutoTune", "WithClock",
+	"WithIdleFlush",
+}
+
+func (k optionKind) String() string {
+	return optionNames[bits.TrailingZeros32(uint32(k))]
+}
+
+type options struct {
+	hook    ObserverHook
+	name    string
+	stderr  io.Writer
+	ctx     context.Context
+	backoff *Backoff
+	meters  []*Meter
+	lines   bool
+
+	progress         func(Progress)
+	progressInterval time.Duration
+
+	segmentSize int
+	coalesce    time.Duration
+
+	minBuf int
+	maxBuf int
+
+	extraFiles     []*os.File
+	closeInherited bool
+	fdCheck        bool
+
+	compress      bool
+	compressLevel int
+
+	grace         time.Duration
+	stderrCapture int
+
+	attrs []Attr
+
+	seed    uint64
+	hasSeed bool
+
+	fixedLength bool
+	maxMessage  int
+
+	handshake func(net.Conn) error
+
+	codecs []string
+
+	autoTuneMax int
+
+	clock     Clock
+	idleFlush time.Duration
+}
+
+// applyOptions applies opts for the constructor named by who, panicking
+// if one is not in accepts.
+func applyOptions(opts []Option, accepts optionKind, who string) options {
+	var o options
+	for _, opt := range opts {
+		if opt.apply == nil {
+			continue
+		}
+		if opt.kind&accepts == 0 {
+			panic("extraio: " + who + " does not accept " + opt.kind.String())
+		}
+		opt.apply(&o)
+	}
+	return o
+}
+
+// filterOptions returns the opts in kinds, for constructors passing their
+// options on to another.
+func filterOptions(opts []Option, kinds optionKind) []Option {
+	var kept []Option
+	for _, opt := range opts {
+		if opt.kind&kinds != 0 {
+			kept = append(kept, opt)
+		}
+	}
+	return kept
+}
+
+// WithHook attaches an ObserverHook to a wrapper.
+func WithHook(h ObserverHook) Option {
+	return Option{optHook, func(o *options) {
+		o.hook = h
+	}}
+}
+
+// WithName names a stream for logging and reporting.
+func WithName(name string) Option {
+	return Option{optName, func(o *options) {
+		o.name = name
+	}}
+}
+
+// WithStderr sends a command's stderr to w instead of discarding it,
+// e.g. a *PrefixSuffixSaver.
+func WithStderr(w io.Writer) Option {
+	return Option{optStderr, func(o *options) {
+		o.stderr = w
+	}}
+}
+
+// WithContext ties a stream to ctx, it is closed when ctx is done.
+// Rate limited streams instead abandon waits for their limiter, and
+// TracedConn only takes its pprof labels.
+func WithContext(ctx context.Context) Option {
+	return Option{optContext, func(o *options) {
+		o.ctx = ctx
+	}}
+}
+
+// WithBackoff enables retrying temporary errors with the given backoff.
+func WithBackoff(b Backoff) Option {
+	return Option{optBackoff, func(o *options) {
+		o.backoff = &b
+	}}
+}
+
+// WithMeters credits every byte counted by a metered wrapper to each of meters as well.
+func WithMeters(meters ...*Meter) Option {
+	return Option{optMeters, func(o *options) {
+		o.meters = append(o.meters, meters...)
+	}}
+}
+
+// WithLines switches output capture to whole lines.
+func WithLines() Option {
+	return Option{optLines, func(o *options) {
+		o.lines = true
+	}}
+}
+
+// WithProgress calls fn with the progress of a transfer every interval,
+// and once more on completion. An interval <= 0 means every second.
+func WithProgress(fn func(Progress), interval time.Duration) Option {
+	return Option{optProgress, func(o *options) {
+		o.progress = fn
+		o.progressInterval = interval
+	}}
+}
+
+// WithSegmentSize splits each write to an in memory pair into segments
+// of at most n bytes, as the peer would see them over TCP.
+func WithSegmentSize(n int) Option {
+	return Option{optSegmentSize, func(o *options) {
+		o.segmentSize = n
+	}}
+}
+
+// WithCoalesce holds small writes to an in memory pair for up to delay
+// and delivers adjacent ones together, up to the segment size.
+func WithCoalesce(delay time.Duration) Option {
+	return Option{optCoalesce, func(o *options) {
+		o.coalesce = delay
+	}}
+}
+
+// WithBufferSize bounds the buffer a copy may adapt its size within,
+// zero values take the defaults of 4KiB and 1MiB.
+func WithBufferSize(min, max int) Option {
+	return Option{optBufferSize, func(o *options) {
+		o.minBuf = min
+		o.maxBuf = max
+	}}
+}
+
+// WithExtraFiles passes files to a command as descriptors 3 onwards,
+// like cmd.ExtraFiles.
+func WithExtraFiles(files ...*os.File) Option {
+	return Option{optExtraFiles, func(o *options) {
+		o.extraFiles = files
+	}}
+}
+
+// WithCloseInherited runs CloseInheritedFDs before a command is started,
+// so it only inherits stdio and its extra files.
+func WithCloseInherited() Option {
+	return Option{optCloseInherited, func(o *options) {
+		o.closeInherited = true
+	}}
+}
+
+// WithFDCheck refuses to start a command that would inherit descriptors
+// other than stdio and its extra files, returning a *FDLeakError.
+// The check is skipped where InheritableFDs is unsupported.
+func WithFDCheck() Option {
+	return Option{optFDCheck, func(o *options) {
+		o.fdCheck = true
+	}}
+}
+
+// WithCompression enables flate compression at level, e.g. flate.DefaultCompression.
+func WithCompression(level int) Option {
+	return Option{optCompression, func(o *options) {
+		o.compress = true
+		o.compressLevel = level
+	}}
+}
+
+// WithGrace sets how long closing a command waits for it to exit before killing it.
+func WithGrace(d time.Duration) Option {
+	return Option{optGrace, func(o *options) {
+		o.grace = d
+	}}
+}
+
+// WithStderrCapture keeps the first and last n bytes of a command's stderr
+// in a PrefixSuffixSaver, for including in error messages. With WithStderr
+// too, stderr goes to both.
+func WithStderrCapture(n int) Option {
+	return Option{optStderrCapture, func(o *options) {
+		o.stderrCapture = n
+	}}
+}
+
+// WithAttrs adds attributes to every measurement an InstrumentedConn records.
+func WithAttrs(attrs ...Attr) Option {
+	return Option{optAttrs, func(o *options) {
+		o.attrs = append(o.attrs, attrs...)
+	}}
+}
+
+// WithSeed makes the randomness of simulation wrappers repeatable,
+// by default they are seeded randomly.
+func WithSeed(seed uint64) Option {
+	return Option{optSeed, func(o *options) {
+		o.seed = seed
+		o.hasSeed = true
+	}}
+}
+
+// WithFixedLength frames messages with a big endian uint32 length
+// instead of a uvarint.
+func WithFixedLength() Option {
+	return Option{optFixedLength, func(o *options) {
+		o.fixedLength = true
+	}}
+}
+
+// WithMaxMessageSize limits framed messages to n bytes, 0 means
+// DefaultMaxMessageSize.
+func WithMaxMessageSize(n int) Option {
+	return Option{optMaxMessageSize, func(o *options) {
+		o.maxMessage = n
+	}}
+}
+
+// WithHandshake runs fn on every conn a ReconnectingConn dials before
+// it is used, for example to authenticate or resubscribe.
+func WithHandshake(fn func(net.Conn) error) Option {
+	return Option{optHandshake, func(o *options) {
+		o.handshake = fn
+	}}
+}
+
+// WithCodecs sets the compression formats a CompressedConn offers, most
+// preferred first, by default every registered Compressor.
+func WithCodecs(names ...string) Option {
+	return Option{optCodecs, func(o *options) {
+		o.codecs = names
+	}}
+}
+
+// WithAutoTune lets a BufferedPipe grow its buffer, up to max bytes, to
+// hold what arrives while the reader is away at the observed throughput.
+func WithAutoTune(max int) Option {
+	return Option{optAutoTune, func(o *options) {
+		o.autoTuneMax = max
+	}}
+}
+
+// WithClock drives a wrapper's timers with c instead of SystemClock.
+func WithClock(c Clock) Option {
+	return Option{optClock, func(o *options) {
+		o.clock = c
+	}}
+}
+
+// WithIdleFlush makes a BatchWriter send held writes once no write has
+// arrived for d.
+func WithIdleFlush(d time.Duration) Option {
+	return Option{optIdleFlush, func(o *options) {
+		o.idleFlush = d
+	}}
+}
+
+// rng returns a generator seeded per WithSeed, or randomly.
+func (o *options) rng() *rand.Rand {
+	seed := o.seed
+	if !o.hasSeed {
+		seed = rand.Uint64()
+	}
+	return rand.New(rand.NewPCG(seed, seed))
+}
@@ -0,0 +1,25 @@
+package extraio
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionNotAccepted(t *testing.T) {
+	defer func() {
+		msg, _ := recover().(string)
+		if !strings.Contains(msg, "NewMeteredConn does not accept WithGrace") {
+			t.Fatalf("panic %q", msg)
+		}
+	}()
+	NewMeteredConn(nopConn{}, WithGrace(time.Second))
+}
+
+func TestOptionsForwarded(t *testing.T) {
+	// Only the framing options reach NewMessageConn.
+	pc := NewPacketConnAdapter(nopConn{}, WithName("a"), WithFixedLength())
+	if !pc.Conn.Reader.Fixed32 || pc.LocalAddr().String() != "a" {
+		t.Fatal("options not applied")
+	}
+}
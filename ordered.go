@@ -0,0 +1,138 @@
+package extraio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var ErrOrderedWriterClosed = errors.New("extraio: write to closed OrderedWriter")
+
+// OrderedWriter accepts non overlapping WriteAt calls in any order, for
+// example from parallel range downloads, and writes the data to an
+// underlying writer as one sequential stream.
+//
+// Data ahead of the stream position is copied and buffered up to a limit,
+// beyond which WriteAt blocks until the gap is filled. Errors from the
+// underlying writer are returned by subsequent calls.
+type OrderedWriter struct {
+	w   io.Writer
+	max int64
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	next     int64
+	writing  bool
+	buffered int64
+	pending  map[int64][]byte
+	closed   bool
+	err      error
+}
+
+// NewOrderedWriter returns an OrderedWriter writing to w, with at most
+// maxBuffered bytes of out of order data held at once. A single write
+// larger than maxBuffered is still accepted when nothing else is buffered.
+func NewOrderedWriter(w io.Writer, maxBuffered int64) *OrderedWriter {
+	ow := &OrderedWriter{
+		w:       w,
+		max:     maxBuffered,
+		pending: make(map[int64][]byte),
+	}
+	ow.cond = sync.NewCond(&ow.mu)
+	return ow
+}
+
+func (ow *OrderedWriter) WriteAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("extraio: negative offset")
+	}
+	lenp := len(p)
+
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	for {
+		if ow.err != nil {
+			return 0, ow.err
+		}
+		if ow.closed {
+			return 0, ErrOrderedWriterClosed
+		}
+		if off < ow.next {
+			// Already written, at least partially.
+			if off+int64(len(p)) <= ow.next {
+				return lenp, nil
+			}
+			p = p[ow.next-off:]
+			off = ow.next
+		}
+		if off == ow.next && !ow.writing {
+			break
+		}
+		if ow.buffered == 0 || ow.buffered+int64(len(p)) <= ow.max {
+			ow.pending[off] = append([]byte(nil), p...)
+			ow.buffered += int64(len(p))
+			return lenp, nil
+		}
+		ow.cond.Wait()
+	}
+
+	ow.writing = true
+	defer func() {
+		ow.writing = false
+		ow.cond.Broadcast()
+	}()
+	for {
+		ow.mu.Unlock()
+		n, err := ow.w.Write(p)
+		ow.mu.Lock()
+		ow.next += int64(n)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err != nil {
+			ow.err = err
+			return 0, err
+		}
+		next, ok := ow.pending[ow.next]
+		if !ok {
+			return lenp, nil
+		}
+		delete(ow.pending, ow.next)
+		ow.buffered -= int64(len(next))
+		p = next
+		ow.cond.Broadcast()
+	}
+}
+
+// Offset returns the number of bytes written to the underlying writer.
+func (ow *OrderedWriter) Offset() int64 {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	return ow.next
+}
+
+// Buffered returns the number of out of order bytes currently held.
+func (ow *OrderedWriter) Buffered() int64 {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	return ow.buffered
+}
+
+// Close fails if data is still waiting on a gap, it does not close the underlying writer.
+func (ow *OrderedWriter) Close() error {
+	ow.mu.Lock()
+	defer ow.mu.Unlock()
+	for ow.writing {
+		ow.cond.Wait()
+	}
+	ow.closed = true
+	ow.cond.Broadcast()
+	if ow.err != nil {
+		return ow.err
+	}
+	if len(ow.pending) != 0 {
+		return fmt.Errorf("extraio: OrderedWriter closed with a gap at offset %d", ow.next)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package extraio
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type messageResult struct {
+	msg []byte
+	err error
+}
+
+// PacketConnAdapter presents a framed stream as a net.PacketConn, so
+// datagram protocols can run over pipes and command stdio in tests. Each
+// WriteTo sends one message and each ReadFrom returns one, truncated like
+// a datagram if p is too small. The stream has a single peer, so the
+// address given to WriteTo is ignored and ReadFrom always returns Remote.
+//
+// Reads and writes happen on background goroutines so deadlines can
+// interrupt the wait for them, as with a DeadlineReadWriteCloser.
+type PacketConnAdapter struct {
+	Conn *MessageConn
+	// Returned by LocalAddr and ReadFrom, by default a "mem" address.
+	Local  net.Addr
+	Remote net.Addr
+
+	readDeadline  deadline
+	writeDeadline deadline
+
+	rmu     sync.Mutex
+	pending chan messageResult
+	w       asyncWriter
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// NewPacketConnAdapter returns rwc as a net.PacketConn, both ends must
+// use the same framing options. It accepts WithFixedLength,
+// WithMaxMessageSize and WithName, used as both addresses.
+func NewPacketConnAdapter(rwc io.ReadWriteCloser, opts ...Option) *PacketConnAdapter {
+	o := applyOptions(opts, optName|optFrames, "NewPacketConnAdapter")
+	addr := memAddr("packet")
+	if o.name != "" {
+		addr = memAddr(o.name)
+	}
+	mc := NewMessageConn(rwc, filterOptions(opts, optFrames)...)
+	return &PacketConnAdapter{
+		Conn:   mc,
+		Local:  addr,
+		Remote: addr,
+		w:      asyncWriter{w: mc.Writer},
+		closed: make(chan struct{}),
+	}
+}
+
+func (pc *PacketConnAdapter) ReadFrom(p []byte) (int, net.Addr, error) {
+	pc.rmu.Lock()
+	defer pc.rmu.Unlock()
+	if isClosedChan(pc.closed) {
+		return 0, nil, net.ErrClosed
+	}
+	if pc.readDeadline.expired() {
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+	if pc.pending == nil {
+		ch := make(chan messageResult, 1)
+		go func() {
+			msg, err := pc.Conn.ReadMessage()
+			ch <- messageResult{msg: msg, err: err}
+		}()
+		pc.pending = ch
+	}
+	select {
+	case res := <-pc.pending:
+		pc.pending = nil
+		if res.err != nil {
+			return 0, nil, res.err
+		}
+		return copy(p, res.msg), pc.Remote, nil
+	case <-pc.readDeadline.wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-pc.closed:
+		return 0, nil, net.ErrClosed
+	}
+}
+
+// WriteTo sends p as one message to the peer, whatever addr is.
+func (pc *PacketConnAdapter) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return pc.w.write(p, &pc.writeDeadline, pc.closed)
+}
+
+// Close closes the stream and unblocks pending reads and writes.
+func (pc *PacketConnAdapter) Close() error {
+	err := net.ErrClosed
+	pc.closeOnce.Do(func() {
+		close(pc.closed)
+		err = pc.Conn.Close()
+	})
+	return err
+}
+
+func (pc *PacketConnAdapter) LocalAddr() net.Addr {
+	return pc.Local
+}
+
+func (pc *PacketConnAdapter) SetDeadline(t time.Time) error {
+	pc.readDeadline.set(t)
+	pc.writeDeadline.set(t)
+	return nil
+}
+
+func (pc *PacketConnAdapter) SetReadDeadline(t time.Time) error {
+	pc.readDeadline.set(t)
+	return nil
+}
+
+func (pc *PacketConnAdapter) SetWriteDeadline(t time.Time) error {
+	pc.writeDeadline.set(t)
+	return nil
+}
+
+// NetConn returns the stream under the framing if it is a net.Conn, or
+// nil, so ConnContext(pc.NetConn()) finds a context attached to it.
+func (pc *PacketConnAdapter) NetConn() net.Conn {
+	c, _ := pc.Conn.RWC.(net.Conn)
+	return c
+}
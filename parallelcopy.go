@@ -0,0 +1,79 @@
+package extraio
+
+import (
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Bytes each ParallelCopy worker claims at a time.
+	parallelChunk = 4 << 20
+	// Bytes each worker reads and writes per call.
+	parallelBuf = 1 << 20
+)
+
+// ParallelCopy copies size bytes from src to dst at the same offsets,
+// with workers goroutines each claiming the next unclaimed range until
+// none are left. On fast storage this beats a sequential copy. A workers
+// value <= 0 uses GOMAXPROCS.
+//
+// It returns the total bytes written and the first error. After an error
+// the bytes written are not necessarily a prefix of the range. A src
+// shorter than size gives io.ErrUnexpectedEOF.
+func ParallelCopy(dst io.WriterAt, src io.ReaderAt, size int64, workers int) (int64, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if chunks := (size + parallelChunk - 1) / parallelChunk; int64(workers) > chunks {
+		workers = int(max(chunks, 1))
+	}
+	var (
+		next    atomic.Int64
+		written atomic.Int64
+		failed  atomic.Bool
+		errOnce sync.Once
+		err     error
+		wg      sync.WaitGroup
+	)
+	fail := func(e error) {
+		errOnce.Do(func() { err = e })
+		failed.Store(true)
+	}
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, parallelBuf)
+			for !failed.Load() {
+				start := next.Add(parallelChunk) - parallelChunk
+				if start >= size {
+					return
+				}
+				end := min(start+parallelChunk, size)
+				for off := start; off < end && !failed.Load(); {
+					b := buf[:min(int64(len(buf)), end-off)]
+					n, rerr := src.ReadAt(b, off)
+					if n < len(b) {
+						if rerr == nil || rerr == io.EOF {
+							rerr = io.ErrUnexpectedEOF
+						}
+						fail(rerr)
+					}
+					if n > 0 {
+						nw, werr := dst.WriteAt(b[:n], off)
+						written.Add(int64(nw))
+						if werr != nil {
+							fail(werr)
+							return
+						}
+					}
+					off += int64(n)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return written.Load(), err
+}
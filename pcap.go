@@ -0,0 +1,305 @@
+package extraio
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	pcapLinkTypeRaw = 101
+	pcapSnapLen     = 65535
+	pcapMaxPayload  = pcapSnapLen - 40
+
+	tcpFlagFin = 0x01
+	tcpFlagPsh = 0x08
+	tcpFlagAck = 0x10
+
+	// pcapng block types, and the lengths of blocks without options.
+	pcapngSectionHeader     = 0x0a0d0d0a
+	pcapngInterface         = 1
+	pcapngEnhancedPacket    = 6
+	pcapngByteOrderMagic    = 0x1a2b3c4d
+	pcapngSectionHeaderLen  = 28
+	pcapngInterfaceLen      = 20
+	pcapngEnhancedPacketLen = 32
+)
+
+// PcapWriter writes synthesized IPv4/TCP packets in pcap or pcapng format
+// so recorded stream traffic can be inspected with tools like Wireshark.
+// It is safe for concurrent use by many PcapConns.
+//
+// Once a write to the underlying writer fails nothing more is captured,
+// the error is returned by Err.
+type PcapWriter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	ng       bool
+	err      error
+	started  bool
+	nextPort uint16
+}
+
+// NewPcapWriter returns a PcapWriter writing classic pcap.
+func NewPcapWriter(w io.Writer) *PcapWriter {
+	return &PcapWriter{w: w, nextPort: 40000}
+}
+
+// NewPcapNGWriter returns a PcapWriter writing pcapng, with one section
+// and one raw IP interface.
+func NewPcapNGWriter(w io.Writer) *PcapWriter {
+	return &PcapWriter{w: w, ng: true, nextPort: 40000}
+}
+
+// Err returns the error that stopped the capture, if any.
+func (pw *PcapWriter) Err() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.err
+}
+
+func (pw *PcapWriter) fileHeader() []byte {
+	if !pw.ng {
+		hdr := make([]byte, 24)
+		binary.LittleEndian.PutUint32(hdr[0:], 0xa1b2c3d4)
+		binary.LittleEndian.PutUint16(hdr[4:], 2)
+		binary.LittleEndian.PutUint16(hdr[6:], 4)
+		binary.LittleEndian.PutUint32(hdr[16:], pcapSnapLen)
+		binary.LittleEndian.PutUint32(hdr[20:], pcapLinkTypeRaw)
+		return hdr
+	}
+	hdr := make([]byte, pcapngSectionHeaderLen+pcapngInterfaceLen)
+	shb := hdr[:pcapngSectionHeaderLen]
+	binary.LittleEndian.PutUint32(shb[0:], pcapngSectionHeader)
+	binary.LittleEndian.PutUint32(shb[4:], pcapngSectionHeaderLen)
+	binary.LittleEndian.PutUint32(shb[8:], pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[12:], 1)
+	// Section length unknown.
+	binary.LittleEndian.PutUint64(shb[16:], ^uint64(0))
+	binary.LittleEndian.PutUint32(shb[24:], pcapngSectionHeaderLen)
+	idb := hdr[pcapngSectionHeaderLen:]
+	binary.LittleEndian.PutUint32(idb[0:], pcapngInterface)
+	binary.LittleEndian.PutUint32(idb[4:], pcapngInterfaceLen)
+	binary.LittleEndian.PutUint16(idb[8:], pcapLinkTypeRaw)
+	binary.LittleEndian.PutUint32(idb[12:], pcapSnapLen)
+	binary.LittleEndian.PutUint32(idb[16:], pcapngInterfaceLen)
+	return hdr
+}
+
+// record frames an IP packet as a pcap record or pcapng enhanced packet
+// block. Timestamps are in microseconds, the default for both.
+func (pw *PcapWriter) record(ts time.Time, packet []byte) []byte {
+	if !pw.ng {
+		b := make([]byte, 16, 16+len(packet))
+		binary.LittleEndian.PutUint32(b[0:], uint32(ts.Unix()))
+		binary.LittleEndian.PutUint32(b[4:], uint32(ts.Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(b[8:], uint32(len(packet)))
+		binary.LittleEndian.PutUint32(b[12:], uint32(len(packet)))
+		return append(b, packet...)
+	}
+	padded := (len(packet) + 3) &^ 3
+	total := pcapngEnhancedPacketLen + padded
+	b := make([]byte, total)
+	us := uint64(ts.UnixMicro())
+	binary.LittleEndian.PutUint32(b[0:], pcapngEnhancedPacket)
+	binary.LittleEndian.PutUint32(b[4:], uint32(total))
+	binary.LittleEndian.PutUint32(b[12:], uint32(us>>32))
+	binary.LittleEndian.PutUint32(b[16:], uint32(us))
+	binary.LittleEndian.PutUint32(b[20:], uint32(len(packet)))
+	binary.LittleEndian.PutUint32(b[24:], uint32(len(packet)))
+	copy(b[28:], packet)
+	binary.LittleEndian.PutUint32(b[total-4:], uint32(total))
+	return b
+}
+
+func (pw *PcapWriter) writeLocked(b []byte) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if !pw.started {
+		if _, pw.err = pw.w.Write(pw.fileHeader()); pw.err != nil {
+			return pw.err
+		}
+		pw.started = true
+	}
+	_, pw.err = pw.w.Write(b)
+	return pw.err
+}
+
+// pcapEndpoint is one side of a synthesized TCP connection.
+type pcapEndpoint struct {
+	ip   [4]byte
+	port uint16
+	seq  uint32
+}
+
+func (pw *PcapWriter) endpoint(addr net.Addr, fallback [4]byte) pcapEndpoint {
+	if ta, ok := addr.(*net.TCPAddr); ok {
+		if ip4 := ta.IP.To4(); ip4 != nil {
+			var e pcapEndpoint
+			copy(e.ip[:], ip4)
+			e.port = uint16(ta.Port)
+			return e
+		}
+	}
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	pw.nextPort++
+	return pcapEndpoint{ip: fallback, port: pw.nextPort}
+}
+
+// writeSegment records payload sent from src to dst, advancing src.seq.
+func (pw *PcapWriter) writeSegment(src, dst *pcapEndpoint, flags byte, payload []byte) error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	for {
+		seg := payload[:minInt(len(payload), pcapMaxPayload)]
+		payload = payload[len(seg):]
+		if err := pw.writeLocked(pw.record(time.Now(), pcapPacket(src, dst, flags, seg))); err != nil {
+			return err
+		}
+		src.seq += uint32(len(seg))
+		if flags&tcpFlagFin != 0 {
+			src.seq++
+		}
+		if len(payload) == 0 {
+			return nil
+		}
+	}
+}
+
+// pcapPacket returns an IPv4 packet holding a TCP segment.
+func pcapPacket(src, dst *pcapEndpoint, flags byte, payload []byte) []byte {
+	total := 40 + len(payload)
+	b := make([]byte, total)
+
+	ip := b[:20]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(total))
+	ip[8] = 64
+	ip[9] = 6 // TCP
+	copy(ip[12:16], src.ip[:])
+	copy(ip[16:20], dst.ip[:])
+	binary.BigEndian.PutUint16(ip[10:], ^onesSum(0, ip))
+
+	tcp := b[20:]
+	binary.BigEndian.PutUint16(tcp[0:], src.port)
+	binary.BigEndian.PutUint16(tcp[2:], dst.port)
+	binary.BigEndian.PutUint32(tcp[4:], src.seq)
+	binary.BigEndian.PutUint32(tcp[8:], dst.seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags | tcpFlagAck
+	binary.BigEndian.PutUint16(tcp[14:], 65535)
+	copy(tcp[20:], payload)
+
+	var pseudo [12]byte
+	copy(pseudo[0:4], src.ip[:])
+	copy(pseudo[4:8], dst.ip[:])
+	pseudo[9] = 6
+	binary.BigEndian.PutUint16(pseudo[10:], uint16(len(tcp)))
+	binary.BigEndian.PutUint16(tcp[16:], ^onesSum(onesSum(0, pseudo[:]), tcp))
+	return b
+}
+
+// onesSum adds b to the internet checksum sum.
+func onesSum(sum uint16, b []byte) uint16 {
+	s := uint32(sum)
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(binary.BigEndian.Uint16(b[i:]))
+	}
+	if len(b)%2 == 1 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+	for s > 0xffff {
+		s = (s >> 16) + (s & 0xffff)
+	}
+	return uint16(s)
+}
+
+// PcapConn records the traffic on Conn to a PcapWriter as a TCP
+// connection between its local and remote addresses. Addresses that are
+// not IPv4 TCP addresses are replaced with 10.0.0.1 and 10.0.0.2.
+//
+// A failed capture does not fail Read or Write, check Err, Close
+// returns the capture error if closing Conn succeeds.
+type PcapConn struct {
+	Conn net.Conn
+	P    *PcapWriter
+
+	mu     sync.Mutex
+	local  pcapEndpoint
+	remote pcapEndpoint
+}
+
+func NewPcapConn(c net.Conn, p *PcapWriter) *PcapConn {
+	return &PcapConn{
+		Conn:   c,
+		P:      p,
+		local:  p.endpoint(c.LocalAddr(), [4]byte{10, 0, 0, 1}),
+		remote: p.endpoint(c.RemoteAddr(), [4]byte{10, 0, 0, 2}),
+	}
+}
+
+func (pc *PcapConn) Read(buf []byte) (int, error) {
+	n, err := pc.Conn.Read(buf)
+	if n > 0 {
+		pc.mu.Lock()
+		pc.P.writeSegment(&pc.remote, &pc.local, tcpFlagPsh, buf[:n])
+		pc.mu.Unlock()
+	}
+	return n, err
+}
+
+func (pc *PcapConn) Write(buf []byte) (int, error) {
+	n, err := pc.Conn.Write(buf)
+	if n > 0 {
+		pc.mu.Lock()
+		pc.P.writeSegment(&pc.local, &pc.remote, tcpFlagPsh, buf[:n])
+		pc.mu.Unlock()
+	}
+	return n, err
+}
+
+// Close records a FIN from the local side.
+func (pc *PcapConn) Close() error {
+	err := pc.Conn.Close()
+	pc.mu.Lock()
+	perr := pc.P.writeSegment(&pc.local, &pc.remote, tcpFlagFin, nil)
+	pc.mu.Unlock()
+	if err == nil {
+		err = perr
+	}
+	return err
+}
+
+// Err returns the error that stopped the capture, if any.
+func (pc *PcapConn) Err() error {
+	return pc.P.Err()
+}
+
+func (pc *PcapConn) LocalAddr() net.Addr {
+	return pc.Conn.LocalAddr()
+}
+
+func (pc *PcapConn) RemoteAddr() net.Addr {
+	return pc.Conn.RemoteAddr()
+}
+
+func (pc *PcapConn) SetDeadline(t time.Time) error {
+	return pc.Conn.SetDeadline(t)
+}
+
+func (pc *PcapConn) SetReadDeadline(t time.Time) error {
+	return pc.Conn.SetReadDeadline(t)
+}
+
+func (pc *PcapConn) SetWriteDeadline(t time.Time) error {
+	return pc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (pc *PcapConn) NetConn() net.Conn {
+	return pc.Conn
+}
@@ -0,0 +1,115 @@
+package extraio
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// Probe frames are [type][seq uint64][sender time uint64], big endian.
+const (
+	pingFrameLen = 17
+	pingRequest  = 'p'
+	pingReply    = 'P'
+)
+
+var ErrBadPing = errors.New("extraio: malformed ping frame")
+
+// PingStats summarizes the round trips measured by Ping.
+type PingStats struct {
+	Sent     int
+	Received int
+	Min      time.Duration
+	Max      time.Duration
+	Avg      time.Duration
+	// Mean difference between consecutive round trips.
+	Jitter time.Duration
+}
+
+// PingResponder answers the probes sent by Ping on rw until rw returns
+// an error, returning nil if that error is io.EOF.
+func PingResponder(rw io.ReadWriter) error {
+	var frame [pingFrameLen]byte
+	for {
+		if _, err := io.ReadFull(rw, frame[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if frame[0] != pingRequest {
+			return ErrBadPing
+		}
+		frame[0] = pingReply
+		if _, err := rw.Write(frame[:]); err != nil {
+			return err
+		}
+	}
+}
+
+// Ping sends count probes to a PingResponder on the other end of rw,
+// one every interval, and reports the round trip times. When ctx is done
+// it returns ctx.Err(), interrupting a probe blocked in rw as CopyContext
+// does, so a dead tunnel cannot hang a health check but rw may be
+// unusable afterwards.
+func Ping(ctx context.Context, rw io.ReadWriter, count int, interval time.Duration) (PingStats, error) {
+	stop := context.AfterFunc(ctx, func() {
+		interruptIO(rw, true)
+		interruptIO(rw, false)
+	})
+	stats, err := ping(ctx, rw, count, interval)
+	stop()
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return stats, err
+}
+
+func ping(ctx context.Context, rw io.ReadWriter, count int, interval time.Duration) (PingStats, error) {
+	var stats PingStats
+	var total, jitter, last time.Duration
+	var frame [pingFrameLen]byte
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			if err := sleepContext(ctx, interval); err != nil {
+				return stats, err
+			}
+		}
+		start := time.Now()
+		frame[0] = pingRequest
+		binary.BigEndian.PutUint64(frame[1:], uint64(seq))
+		binary.BigEndian.PutUint64(frame[9:], uint64(start.UnixNano()))
+		if _, err := rw.Write(frame[:]); err != nil {
+			return stats, err
+		}
+		stats.Sent++
+		if _, err := io.ReadFull(rw, frame[:]); err != nil {
+			return stats, noEOF(err)
+		}
+		if frame[0] != pingReply || binary.BigEndian.Uint64(frame[1:]) != uint64(seq) {
+			return stats, ErrBadPing
+		}
+		rtt := time.Since(start)
+		stats.Received++
+		if stats.Received == 1 || rtt < stats.Min {
+			stats.Min = rtt
+		}
+		if rtt > stats.Max {
+			stats.Max = rtt
+		}
+		if stats.Received > 1 {
+			d := rtt - last
+			if d < 0 {
+				d = -d
+			}
+			jitter += d
+			stats.Jitter = jitter / time.Duration(stats.Received-1)
+		}
+		last = rtt
+		total += rtt
+		stats.Avg = total / time.Duration(stats.Received)
+	}
+	return stats, nil
+}
@@ -0,0 +1,99 @@
+package extraio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var errPipelineAborted = errors.New("extraio: pipeline aborted")
+
+// Stage is one step of a Pipeline, reading its input from r and writing
+// its output to w. Returning closes w, so the next stage sees io.EOF.
+type Stage func(r io.Reader, w io.Writer) error
+
+// Pipeline runs stages concurrently, connected by pipes.
+type Pipeline []Stage
+
+// Run feeds src through the stages in order into dst. The first stage to
+// fail, or ctx being done, aborts every pipe between stages so the rest
+// return promptly, reads from src and writes to dst are not interrupted.
+// A stage finishing without reading all of its input stops the stages
+// before it without that being an error. The returned error joins the
+// errors of the stages that failed of their own accord.
+func (p Pipeline) Run(ctx context.Context, src io.Reader, dst io.Writer) error {
+	if len(p) == 0 {
+		_, err := Copy(dst, src)
+		return err
+	}
+	n := len(p)
+	readers := make([]*io.PipeReader, n-1)
+	writers := make([]*io.PipeWriter, n-1)
+	for i := range readers {
+		readers[i], writers[i] = io.Pipe()
+	}
+	var once sync.Once
+	abort := func() {
+		once.Do(func() {
+			for i := range readers {
+				readers[i].CloseWithError(errPipelineAborted)
+				writers[i].CloseWithError(errPipelineAborted)
+			}
+		})
+	}
+	stop := context.AfterFunc(ctx, abort)
+	defer stop()
+
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i, stage := range p {
+		var r io.Reader = src
+		if i > 0 {
+			r = readers[i-1]
+		}
+		var w io.Writer = dst
+		if i < n-1 {
+			w = writers[i]
+		}
+		go func() {
+			defer wg.Done()
+			err := stage(r, w)
+			errs[i] = err
+			if err != nil && !pipelineAborted(err) {
+				abort()
+				return
+			}
+			if i < n-1 {
+				if err != nil {
+					writers[i].CloseWithError(err)
+				} else {
+					writers[i].Close()
+				}
+			}
+			if i > 0 {
+				readers[i-1].CloseWithError(errPipelineAborted)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var failed []error
+	if err := ctx.Err(); err != nil {
+		failed = append(failed, err)
+	}
+	for i, err := range errs {
+		if err != nil && !pipelineAborted(err) {
+			failed = append(failed, fmt.Errorf("extraio: pipeline stage %d: %w", i, err))
+		}
+	}
+	return errors.Join(failed...)
+}
+
+// pipelineAborted reports whether err is a consequence of Run closing
+// a pipe, once both ends are closed io.Pipe reports io.ErrClosedPipe.
+func pipelineAborted(err error) bool {
+	return errors.Is(err, errPipelineAborted) || errors.Is(err, io.ErrClosedPipe)
+}
@@ -0,0 +1,92 @@
+package extraio
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+// memAddr is the address of a PipeListener and its conns.
+type memAddr string
+
+func (memAddr) Network() string  { return "mem" }
+func (a memAddr) String() string { return string(a) }
+
+// PipeListener is an in memory net.Listener, conns are made by its Dial
+// methods from a SocketPair wrapped in a ConnAdapter, so tests can run
+// servers without binding ports. Options given to NewPipeListener
+// apply to every SocketPair.
+type PipeListener struct {
+	addr  memAddr
+	opts  []Option
+	conns chan net.Conn
+	once  sync.Once
+	done  chan struct{}
+}
+
+// Accepts WithName, used as the listener's address,
+// and the options of SocketPair.
+func NewPipeListener(opts ...Option) *PipeListener {
+	o := applyOptions(opts, optName|optSegmentSize|optCoalesce, "NewPipeListener")
+	addr := memAddr("pipe")
+	if o.name != "" {
+		addr = memAddr(o.name)
+	}
+	return &PipeListener{
+		addr:  addr,
+		opts:  filterOptions(opts, optSegmentSize|optCoalesce),
+		conns: make(chan net.Conn),
+		done:  make(chan struct{}),
+	}
+}
+
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener, unblocking Accept and Dial calls.
+// Established conns are unaffected.
+func (l *PipeListener) Close() error {
+	err := net.ErrClosed
+	l.once.Do(func() {
+		close(l.done)
+		err = nil
+	})
+	return err
+}
+
+func (l *PipeListener) Addr() net.Addr {
+	return l.addr
+}
+
+// Dial connects to the listener, waiting for Accept.
+func (l *PipeListener) Dial() (net.Conn, error) {
+	return l.DialContext(context.Background(), "", "")
+}
+
+// DialContext is Dial ignoring network and address, so it can be used as
+// e.g. http.Transport.DialContext.
+func (l *PipeListener) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	a, b := SocketPair(l.opts...)
+	client := NewConnAdapter(a)
+	client.Local, client.Remote = l.addr, l.addr
+	server := NewConnAdapter(b)
+	server.Local, server.Remote = l.addr, l.addr
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.done:
+		client.Close()
+		server.Close()
+		return nil, &net.OpError{Op: "dial", Net: l.addr.Network(), Addr: l.addr, Err: net.ErrClosed}
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, &net.OpError{Op: "dial", Net: l.addr.Network(), Addr: l.addr, Err: ctx.Err()}
+	}
+}
@@ -0,0 +1,97 @@
+//go:build unix
+
+package extraio
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// aLongTimeAgo is a deadline in the past, used to wake blocked operations.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// PollableFile reads and writes a duplicate of a file descriptor switched to
+// non-blocking mode, so operations go through the runtime poller and can
+// be interrupted by Close, deadlines or context cancellation. This makes
+// reads from stdin, ttys and serial devices killable.
+//
+// Non-blocking mode is a property of the shared open file description, so
+// it is also visible through the original descriptor until Close restores it.
+type PollableFile struct {
+	f *os.File
+}
+
+func NewPollableFile(f *os.File) (*PollableFile, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	nfd := -1
+	var dupErr error
+	err = rc.Control(func(fd uintptr) {
+		nfd, dupErr = unix.FcntlInt(fd, unix.F_DUPFD_CLOEXEC, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dupErr != nil {
+		return nil, os.NewSyscallError("fcntl", dupErr)
+	}
+	if err := unix.SetNonblock(nfd, true); err != nil {
+		unix.Close(nfd)
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+	// NewFile registers non-blocking descriptors with the runtime poller.
+	return &PollableFile{f: os.NewFile(uintptr(nfd), f.Name())}, nil
+}
+
+func (pf *PollableFile) Read(buf []byte) (int, error) {
+	return pf.f.Read(buf)
+}
+
+// ReadContext is Read, abandoned with ctx.Err() when ctx is done.
+// Cancellation clears any read deadline.
+func (pf *PollableFile) ReadContext(ctx context.Context, buf []byte) (int, error) {
+	stop := context.AfterFunc(ctx, func() {
+		_ = pf.f.SetReadDeadline(aLongTimeAgo)
+	})
+	n, err := pf.f.Read(buf)
+	if !stop() {
+		_ = pf.f.SetReadDeadline(time.Time{})
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			err = ctx.Err()
+		}
+	}
+	return n, err
+}
+
+func (pf *PollableFile) Write(buf []byte) (int, error) {
+	return pf.f.Write(buf)
+}
+
+func (pf *PollableFile) SetDeadline(t time.Time) error {
+	return pf.f.SetDeadline(t)
+}
+
+func (pf *PollableFile) SetReadDeadline(t time.Time) error {
+	return pf.f.SetReadDeadline(t)
+}
+
+func (pf *PollableFile) SetWriteDeadline(t time.Time) error {
+	return pf.f.SetWriteDeadline(t)
+}
+
+// Close restores blocking mode and closes the duplicate, interrupting any
+// blocked Read. The original file is left open.
+func (pf *PollableFile) Close() error {
+	if rc, err := pf.f.SyscallConn(); err == nil {
+		_ = rc.Control(func(fd uintptr) {
+			_ = unix.SetNonblock(int(fd), false)
+		})
+	}
+	return pf.f.Close()
+}
@@ -0,0 +1,146 @@
+package extraio
+
+import (
+	"io"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	defaultBufSize = 32 * 1024
+	// Smaller buffers make copies mostly syscall overhead, and empty
+	// ones make io.CopyBuffer panic.
+	minPoolBufSize = 512
+)
+
+// BufferPool reuses buffers of one size through a sync.Pool, cutting
+// allocations when many streams copy at once. It is safe for concurrent use.
+type BufferPool struct {
+	size int
+	// pool holds *[]byte rather than []byte so Put does not allocate.
+	pool sync.Pool
+
+	gets   atomic.Int64
+	puts   atomic.Int64
+	allocs atomic.Int64
+}
+
+// BufferPoolStats are a BufferPool's counters, for tuning its size.
+type BufferPoolStats struct {
+	Size int
+	Gets int64
+	Puts int64
+	// Buffers allocated because the pool was empty, a high ratio to
+	// Gets means buffers are not being returned or were collected.
+	Allocs int64
+	// Gets not yet matched by a Put.
+	InUse int64
+}
+
+// DefaultBufferPool is used by the copies in this package and by
+// CopyPooled when given no pool.
+var DefaultBufferPool = NewBufferPool(defaultBufSize)
+
+// NewBufferPool returns a pool of buffers of size bytes, a size below
+// 512 is taken as 512.
+func NewBufferPool(size int) *BufferPool {
+	size = maxInt(size, minPoolBufSize)
+	p := &BufferPool{size: size}
+	p.pool.New = func() any {
+		p.allocs.Add(1)
+		b := make([]byte, size)
+		return &b
+	}
+	return p
+}
+
+func (p *BufferPool) Size() int {
+	return p.size
+}
+
+// Get returns a buffer of Size bytes, return it with Put when done.
+func (p *BufferPool) Get() *[]byte {
+	p.gets.Add(1)
+	return p.pool.Get().(*[]byte)
+}
+
+// Put returns b to the pool, buffers of another size are dropped.
+func (p *BufferPool) Put(b *[]byte) {
+	p.puts.Add(1)
+	if cap(*b) != p.size {
+		return
+	}
+	*b = (*b)[:p.size]
+	p.pool.Put(b)
+}
+
+func (p *BufferPool) Stats() BufferPoolStats {
+	gets, puts := p.gets.Load(), p.puts.Load()
+	return BufferPoolStats{
+		Size:   p.size,
+		Gets:   gets,
+		Puts:   puts,
+		Allocs: p.allocs.Load(),
+		InUse:  gets - puts,
+	}
+}
+
+func getBuf() *[]byte {
+	return DefaultBufferPool.Get()
+}
+
+func putBuf(b *[]byte) {
+	DefaultBufferPool.Put(b)
+}
+
+// sizedPools hold buffers of each power of two from minPoolBufSize to
+// 16MiB, for buffers that change size such as Copy's. The 32KiB class is
+// DefaultBufferPool.
+var sizedPools = func() []*BufferPool {
+	pools := make([]*BufferPool, 16)
+	for i := range pools {
+		size := minPoolBufSize << i
+		if size == defaultBufSize {
+			pools[i] = DefaultBufferPool
+		} else {
+			pools[i] = NewBufferPool(size)
+		}
+	}
+	return pools
+}()
+
+// sizeClass returns the index of the smallest sizedPools class holding size.
+func sizeClass(size int) int {
+	return maxInt(bits.Len(uint(size-1))-bits.Len(minPoolBufSize-1), 0)
+}
+
+// getSizedBuf returns a buffer of size bytes from the smallest class
+// that fits, return it with putSizedBuf.
+func getSizedBuf(size int) *[]byte {
+	i := sizeClass(size)
+	if i >= len(sizedPools) {
+		b := make([]byte, size)
+		return &b
+	}
+	b := sizedPools[i].Get()
+	*b = (*b)[:size]
+	return b
+}
+
+func putSizedBuf(b *[]byte) {
+	if i := sizeClass(cap(*b)); i < len(sizedPools) {
+		sizedPools[i].Put(b)
+	}
+}
+
+// CopyPooled is io.Copy using a buffer from pool, or DefaultBufferPool
+// if pool is nil. Like io.Copy it uses ReadFrom or WriteTo when available.
+func CopyPooled(dst io.Writer, src io.Reader, pool *BufferPool) (int64, error) {
+	if pool == nil {
+		pool = DefaultBufferPool
+	}
+	buf := pool.Get()
+	defer pool.Put(buf)
+	return io.CopyBuffer(dst, src, *buf)
+}
@@ -0,0 +1,95 @@
+package extraio
+
+import "time"
+
+// Progress is passed to progress callbacks during transfers.
+type Progress struct {
+	Bytes int64
+	// Expected total, or -1 if unknown.
+	Total   int64
+	Elapsed time.Duration
+	// Bytes per second since the previous report.
+	Rate float64
+}
+
+// Percent returns completion between 0 and 100, or -1 if Total is unknown.
+func (p Progress) Percent() float64 {
+	if p.Total < 0 {
+		return -1
+	}
+	if p.Total == 0 {
+		return 100
+	}
+	return 100 * float64(p.Bytes) / float64(p.Total)
+}
+
+// ETA estimates the time remaining from the average rate so far,
+// it is 0 if Total is unknown or nothing has been transferred.
+func (p Progress) ETA() time.Duration {
+	if p.Total < 0 || p.Bytes <= 0 || p.Bytes >= p.Total {
+		return 0
+	}
+	perByte := float64(p.Elapsed) / float64(p.Bytes)
+	return time.Duration(perByte * float64(p.Total-p.Bytes))
+}
+
+const defaultProgressInterval = time.Second
+
+type progressReporter struct {
+	fn        func(Progress)
+	interval  time.Duration
+	total     int64
+	start     time.Time
+	last      time.Time
+	lastBytes int64
+}
+
+func newProgressReporter(fn func(Progress), interval time.Duration, total int64) *progressReporter {
+	if fn == nil {
+		return nil
+	}
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	now := time.Now()
+	return &progressReporter{
+		fn:       fn,
+		interval: interval,
+		total:    total,
+		start:    now,
+		last:     now,
+	}
+}
+
+// update reports progress if an interval has passed, nil reporters do nothing.
+func (pr *progressReporter) update(bytes int64) {
+	if pr == nil {
+		return
+	}
+	if now := time.Now(); now.Sub(pr.last) >= pr.interval {
+		pr.report(now, bytes)
+	}
+}
+
+// finish always reports.
+func (pr *progressReporter) finish(bytes int64) {
+	if pr == nil {
+		return
+	}
+	pr.report(time.Now(), bytes)
+}
+
+func (pr *progressReporter) report(now time.Time, bytes int64) {
+	rate := 0.0
+	if d := now.Sub(pr.last).Seconds(); d > 0 {
+		rate = float64(bytes-pr.lastBytes) / d
+	}
+	pr.last = now
+	pr.lastBytes = bytes
+	pr.fn(Progress{
+		Bytes:   bytes,
+		Total:   pr.total,
+		Elapsed: now.Sub(pr.start),
+		Rate:    rate,
+	})
+}
@@ -0,0 +1,58 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Proxy copies a to b and b to a concurrently until both directions are
+// done, then closes both and returns the bytes copied each way.
+//
+// When one direction reaches EOF its destination is half closed with
+// CloseWrite if it has that method, so the end of stream is passed
+// through while the other direction carries on. Destinations without
+// CloseWrite only see it when Proxy returns.
+//
+// If either direction fails, or ctx is done, both streams are closed to
+// unblock the other and the first error, or ctx.Err(), is returned.
+func Proxy(ctx context.Context, a, b io.ReadWriteCloser) (aToB, bToA int64, err error) {
+	var closeOnce sync.Once
+	closeBoth := func() {
+		closeOnce.Do(func() {
+			a.Close()
+			b.Close()
+		})
+	}
+	stop := context.AfterFunc(ctx, closeBoth)
+	defer stop()
+
+	errs := make(chan error, 2)
+	pipe := func(dst io.Writer, src io.Reader, count *int64) {
+		buf := getBuf()
+		defer putBuf(buf)
+		n, err := io.CopyBuffer(dst, src, *buf)
+		*count = n
+		if err == nil {
+			if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+				err = cw.CloseWrite()
+			}
+		}
+		if err != nil {
+			closeBoth()
+		}
+		errs <- err
+	}
+	go pipe(b, a, &aToB)
+	go pipe(a, b, &bToA)
+	for range 2 {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	closeBoth()
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return aToB, bToA, err
+}
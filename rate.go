@@ -0,0 +1,123 @@
+package extraio
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	rateWindow   = 10 * time.Second
+	rateInterval = time.Second
+	rateSamples  = int(rateWindow/rateInterval) + 1
+)
+
+type rateSample struct {
+	at    time.Time
+	stats Stats
+}
+
+// rateTracker keeps a ring of byte count samples, at most one per
+// rateInterval, taken whenever a rate is asked for and, once one has been,
+// as bytes are counted.
+type rateTracker struct {
+	// Set by the first rate call, until then observe does nothing so
+	// streams nobody polls never read the clock.
+	polled int32
+	// UnixNano of the newest sample, lets observe skip the lock.
+	lastNano int64
+
+	mu      sync.Mutex
+	samples [rateSamples]rateSample
+	next    int
+	count   int
+}
+
+// observe records s, the counts before an operation is counted, if a
+// sample is due.
+func (rt *rateTracker) observe(s Stats) {
+	if atomic.LoadInt32(&rt.polled) == 0 {
+		return
+	}
+	now := time.Now()
+	if now.UnixNano()-atomic.LoadInt64(&rt.lastNano) < int64(rateInterval) {
+		return
+	}
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.recordLocked(now, s)
+}
+
+func (rt *rateTracker) recordLocked(now time.Time, s Stats) {
+	last := (rt.next + rateSamples - 1) % rateSamples
+	if rt.count > 0 && now.Sub(rt.samples[last].at) < rateInterval {
+		return
+	}
+	rt.samples[rt.next] = rateSample{at: now, stats: s}
+	rt.next = (rt.next + 1) % rateSamples
+	if rt.count < rateSamples {
+		rt.count++
+	}
+	atomic.StoreInt64(&rt.lastNano, now.UnixNano())
+}
+
+// rate records s and returns bytes per second over the window, or since
+// the newest sample before it when none fall inside.
+func (rt *rateTracker) rate(s Stats) (float64, float64) {
+	atomic.StoreInt32(&rt.polled, 1)
+	now := time.Now()
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	// Oldest sample inside the window, else the newest before it.
+	var oldest *rateSample
+	for i := rt.count; i > 0; i-- {
+		smp := &rt.samples[(rt.next+rateSamples-i)%rateSamples]
+		oldest = smp
+		if now.Sub(smp.at) <= rateWindow {
+			break
+		}
+	}
+	rt.recordLocked(now, s)
+	if oldest == nil {
+		return 0, 0
+	}
+	secs := now.Sub(oldest.at).Seconds()
+	if secs <= 0 {
+		return 0, 0
+	}
+	return float64(s.ReadCount-oldest.stats.ReadCount) / secs,
+		float64(s.WriteCount-oldest.stats.WriteCount) / secs
+}
+
+func (rt *rateTracker) reset() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.next = 0
+	rt.count = 0
+	atomic.StoreInt64(&rt.lastNano, 0)
+}
+
+// Rate returns bytes per second read and written over roughly the last ten
+// seconds. The first call starts sampling, taking samples as bytes are
+// counted from then on, and returns zero. A call after a long quiet spell
+// reports the rate since the newest sample before the window.
+func (mConn *MeteredConn) Rate() (float64, float64) {
+	return mConn.rate.rate(mConn.Stats())
+}
+
+// Rate returns bytes per second written, see MeteredConn.Rate.
+func (mw *MeteredWriter) Rate() float64 {
+	_, w := mw.rate.rate(mw.Stats())
+	return w
+}
+
+// Rate returns bytes per second read, see MeteredConn.Rate.
+func (mw *MeteredReader) Rate() float64 {
+	r, _ := mw.rate.rate(mw.Stats())
+	return r
+}
+
+// Rate returns bytes per second read and written, see MeteredConn.Rate.
+func (m *MeteredReadWriteCloser) Rate() (float64, float64) {
+	return m.rate.rate(m.Stats())
+}
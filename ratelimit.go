@@ -0,0 +1,330 @@
+package extraio
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Limiter paces byte transfers. Its method set matches
+// golang.org/x/time/rate's Limiter, so one of those can be used directly.
+type Limiter interface {
+	// WaitN blocks until n bytes may be transferred or ctx is done,
+	// n is never more than Burst.
+	WaitN(ctx context.Context, n int) error
+	Burst() int
+}
+
+// TokenBucket is a Limiter allowing Rate bytes per second on average and
+// up to Burst bytes at once. It is safe for concurrent use.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full TokenBucket, a burst < 1 is taken as 1.
+func NewTokenBucket(bytesPerSec float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   bytesPerSec,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (tb *TokenBucket) Burst() int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	return tb.burst
+}
+
+// SetRate changes the rate and burst, tokens already accumulated are kept
+// up to the new burst.
+func (tb *TokenBucket) SetRate(bytesPerSec float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	tb.refill(time.Now())
+	tb.rate = bytesPerSec
+	tb.burst = burst
+	tb.tokens = min(tb.tokens, float64(burst))
+}
+
+func (tb *TokenBucket) refill(now time.Time) {
+	tb.tokens = min(tb.tokens+now.Sub(tb.last).Seconds()*tb.rate, float64(tb.burst))
+	tb.last = now
+}
+
+// WaitN reserves n tokens, waiting for the bucket to refill if it is
+// short. The reservation is given back if ctx is done first, or fails
+// straight away if ctx's deadline is too soon for it.
+func (tb *TokenBucket) WaitN(ctx context.Context, n int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tb.mu.Lock()
+	if n > tb.burst {
+		tb.mu.Unlock()
+		return errors.New("extraio: WaitN exceeds limiter burst")
+	}
+	now := time.Now()
+	tb.refill(now)
+	tb.tokens -= float64(n)
+	if tb.tokens >= 0 {
+		tb.mu.Unlock()
+		return nil
+	}
+	if tb.rate <= 0 {
+		tb.tokens += float64(n)
+		tb.mu.Unlock()
+		return errors.New("extraio: limiter rate is zero")
+	}
+	wait := time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+	if dl, ok := ctx.Deadline(); ok && dl.Before(now.Add(wait)) {
+		tb.tokens += float64(n)
+		tb.mu.Unlock()
+		return context.DeadlineExceeded
+	}
+	tb.mu.Unlock()
+
+	err := sleepContext(ctx, wait)
+	if err != nil {
+		tb.mu.Lock()
+		tb.refill(time.Now())
+		tb.tokens = min(tb.tokens+float64(n), float64(tb.burst))
+		tb.mu.Unlock()
+	}
+	return err
+}
+
+// limitChunk returns how much of a buffer of size n to pass to l at once.
+func limitChunk(l Limiter, n int) int {
+	return max(min(n, l.Burst()), 1)
+}
+
+// RateLimitedReader throttles reads from R with Limiter. Each read is
+// limited to the limiter's burst and waits for the bytes it returned, so
+// reads are paced by what was actually transferred.
+type RateLimitedReader struct {
+	R       io.Reader
+	Limiter Limiter
+	// if not nil, called after every read
+	Hook ObserverHook
+	ctx  context.Context
+}
+
+// Accepts WithContext, waits are abandoned with ctx.Err() when ctx is done,
+// and WithHook.
+func NewRateLimitedReader(r io.Reader, l Limiter, opts ...Option) *RateLimitedReader {
+	o := applyOptions(opts, optContext|optHook, "NewRateLimitedReader")
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &RateLimitedReader{R: r, Limiter: l, Hook: o.hook, ctx: ctx}
+}
+
+func (rl *RateLimitedReader) Read(buf []byte) (int, error) {
+	n, err := rl.read(buf)
+	if rl.Hook != nil {
+		rl.Hook.OnRead(n, err)
+	}
+	return n, err
+}
+
+func (rl *RateLimitedReader) read(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return rl.R.Read(buf)
+	}
+	n, err := rl.R.Read(buf[:limitChunk(rl.Limiter, len(buf))])
+	if n > 0 {
+		if werr := rl.Limiter.WaitN(rl.ctx, n); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return n, err
+}
+
+// RateLimitedWriter throttles writes to W with Limiter, writing in
+// pieces no larger than the limiter's burst.
+type RateLimitedWriter struct {
+	W       io.Writer
+	Limiter Limiter
+	// if not nil, called after every write
+	Hook ObserverHook
+	ctx  context.Context
+}
+
+// Accepts WithContext, waits are abandoned with ctx.Err() when ctx is done,
+// and WithHook.
+func NewRateLimitedWriter(w io.Writer, l Limiter, opts ...Option) *RateLimitedWriter {
+	o := applyOptions(opts, optContext|optHook, "NewRateLimitedWriter")
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &RateLimitedWriter{W: w, Limiter: l, Hook: o.hook, ctx: ctx}
+}
+
+func (wl *RateLimitedWriter) Write(buf []byte) (int, error) {
+	n, err := limitedWrite(wl.ctx, wl.W, wl.Limiter, buf)
+	if wl.Hook != nil {
+		wl.Hook.OnWrite(n, err)
+	}
+	return n, err
+}
+
+func limitedWrite(ctx context.Context, w io.Writer, l Limiter, buf []byte) (int, error) {
+	written := 0
+	for written < len(buf) {
+		chunk := buf[written:]
+		chunk = chunk[:limitChunk(l, len(chunk))]
+		if err := l.WaitN(ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// RateLimitedConn throttles each direction of Conn with its own Limiter,
+// a nil Limiter leaves that direction unlimited. Read and write deadlines
+// also cut short a wait for the limiter, returning os.ErrDeadlineExceeded.
+// A deadline set during a wait applies from the next operation.
+type RateLimitedConn struct {
+	Conn         net.Conn
+	ReadLimiter  Limiter
+	WriteLimiter Limiter
+	// if not nil, called after every operation
+	Hook ObserverHook
+
+	ctx           context.Context
+	readDeadline  deadline
+	writeDeadline deadline
+}
+
+// Either limiter may be shared with other streams, e.g. a BandwidthGroup.
+// Accepts WithContext, waits are abandoned with ctx.Err() when ctx is done,
+// and WithHook.
+func NewRateLimitedConn(c net.Conn, read, write Limiter, opts ...Option) *RateLimitedConn {
+	o := applyOptions(opts, optContext|optHook, "NewRateLimitedConn")
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &RateLimitedConn{
+		Conn:         c,
+		ReadLimiter:  read,
+		WriteLimiter: write,
+		Hook:         o.hook,
+		ctx:          ctx,
+	}
+}
+
+// limitErr maps a wait cut short by a deadline to os.ErrDeadlineExceeded.
+func limitErr(ctx context.Context, err error) error {
+	if cause := context.Cause(ctx); errors.Is(cause, os.ErrDeadlineExceeded) {
+		return os.ErrDeadlineExceeded
+	}
+	return err
+}
+
+func (lc *RateLimitedConn) Read(buf []byte) (int, error) {
+	n, err := lc.read(buf)
+	if lc.Hook != nil {
+		lc.Hook.OnRead(n, err)
+	}
+	return n, err
+}
+
+func (lc *RateLimitedConn) read(buf []byte) (int, error) {
+	l := lc.ReadLimiter
+	if l == nil || len(buf) == 0 {
+		return lc.Conn.Read(buf)
+	}
+	n, err := lc.Conn.Read(buf[:limitChunk(l, len(buf))])
+	if n > 0 {
+		ctx, cancel := lc.readDeadline.context(lc.ctx)
+		werr := l.WaitN(ctx, n)
+		if werr != nil && err == nil {
+			err = limitErr(ctx, werr)
+		}
+		cancel()
+	}
+	return n, err
+}
+
+func (lc *RateLimitedConn) Write(buf []byte) (int, error) {
+	n, err := lc.write(buf)
+	if lc.Hook != nil {
+		lc.Hook.OnWrite(n, err)
+	}
+	return n, err
+}
+
+func (lc *RateLimitedConn) write(buf []byte) (int, error) {
+	l := lc.WriteLimiter
+	if l == nil {
+		return lc.Conn.Write(buf)
+	}
+	ctx, cancel := lc.writeDeadline.context(lc.ctx)
+	defer cancel()
+	n, err := limitedWrite(ctx, lc.Conn, l, buf)
+	if err != nil {
+		err = limitErr(ctx, err)
+	}
+	return n, err
+}
+
+func (lc *RateLimitedConn) Close() error {
+	err := lc.Conn.Close()
+	if lc.Hook != nil {
+		lc.Hook.OnClose(err)
+	}
+	return err
+}
+
+func (lc *RateLimitedConn) LocalAddr() net.Addr {
+	return lc.Conn.LocalAddr()
+}
+
+func (lc *RateLimitedConn) RemoteAddr() net.Addr {
+	return lc.Conn.RemoteAddr()
+}
+
+func (lc *RateLimitedConn) SetDeadline(t time.Time) error {
+	lc.readDeadline.set(t)
+	lc.writeDeadline.set(t)
+	return lc.Conn.SetDeadline(t)
+}
+
+func (lc *RateLimitedConn) SetReadDeadline(t time.Time) error {
+	lc.readDeadline.set(t)
+	return lc.Conn.SetReadDeadline(t)
+}
+
+func (lc *RateLimitedConn) SetWriteDeadline(t time.Time) error {
+	lc.writeDeadline.set(t)
+	return lc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (lc *RateLimitedConn) NetConn() net.Conn {
+	return lc.Conn
+}
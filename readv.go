@@ -0,0 +1,48 @@
+package extraio
+
+import (
+	"io"
+	"syscall"
+)
+
+// BuffersReader is implemented by streams that can fill several
+// buffers with one call, mirroring net.Buffers for writes.
+type BuffersReader interface {
+	ReadBuffers(bufs [][]byte) (int64, error)
+}
+
+// ReadBuffers reads into bufs, filling each in turn before the next. Like a
+// single Read it may return less than the total capacity. r's own
+// ReadBuffers method is used when present, then readv(2) where r exposes a
+// file descriptor and the platform supports it, otherwise one Read into the
+// first non-empty buffer.
+func ReadBuffers(r io.Reader, bufs [][]byte) (int64, error) {
+	if br, ok := r.(BuffersReader); ok {
+		return br.ReadBuffers(bufs)
+	}
+	if sc, ok := r.(syscall.Conn); ok {
+		if n, handled, err := readv(sc, bufs); handled {
+			return n, err
+		}
+	}
+	for _, buf := range bufs {
+		if len(buf) == 0 {
+			continue
+		}
+		n, err := r.Read(buf)
+		return int64(n), err
+	}
+	return 0, nil
+}
+
+func (mConn *MeteredConn) ReadBuffers(bufs [][]byte) (int64, error) {
+	n, err := ReadBuffers(mConn.Conn, bufs)
+	mConn.countRead(n, err)
+	return n, err
+}
+
+func (mw *MeteredReader) ReadBuffers(bufs [][]byte) (int64, error) {
+	n, err := ReadBuffers(mw.R, bufs)
+	mw.countRead(n, err)
+	return n, err
+}
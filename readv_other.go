@@ -0,0 +1,13 @@
+//go:build !(darwin || linux || openbsd)
+
+package extraio
+
+import "syscall"
+
+func readv(sc syscall.Conn, bufs [][]byte) (int64, bool, error) {
+	return 0, false, nil
+}
+
+func writev(sc syscall.Conn, bufs [][]byte) (int64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,96 @@
+//go:build darwin || linux || openbsd
+
+package extraio
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxIovecs is the smallest IOV_MAX of the supported platforms.
+const maxIovecs = 1024
+
+func readv(sc syscall.Conn, bufs [][]byte) (int64, bool, error) {
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+	if len(bufs) > maxIovecs {
+		bufs = bufs[:maxIovecs]
+	}
+	var (
+		n      int
+		total  int
+		rerr   error
+		called bool
+	)
+	err = rc.Read(func(fd uintptr) bool {
+		called = true
+		n, rerr = unix.Readv(int(fd), bufs)
+		for rerr == unix.EINTR {
+			n, rerr = unix.Readv(int(fd), bufs)
+		}
+		return rerr != unix.EAGAIN
+	})
+	if !called {
+		// e.g. the conn was already closed.
+		return 0, true, err
+	}
+	if err == nil {
+		err = rerr
+	}
+	if err != nil {
+		if _, isErrno := err.(unix.Errno); isErrno {
+			err = os.NewSyscallError("readv", err)
+		}
+		return 0, true, err
+	}
+	for _, b := range bufs {
+		total += len(b)
+	}
+	if n == 0 && total > 0 {
+		return 0, true, io.EOF
+	}
+	return int64(n), true, nil
+}
+
+// writev writes all of bufs, which it consumes, with as few writev calls
+// as possible.
+func writev(sc syscall.Conn, bufs [][]byte) (int64, bool, error) {
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return 0, false, nil
+	}
+	var written int64
+	for len(bufs) > 0 {
+		iov := bufs[:minInt(len(bufs), maxIovecs)]
+		var (
+			n    int
+			werr error
+		)
+		err := rc.Write(func(fd uintptr) bool {
+			n, werr = unix.Writev(int(fd), iov)
+			for werr == unix.EINTR {
+				n, werr = unix.Writev(int(fd), iov)
+			}
+			return werr != unix.EAGAIN
+		})
+		if err == nil && werr != nil {
+			err = os.NewSyscallError("writev", werr)
+		}
+		if n > 0 {
+			written += int64(n)
+			bufs = consumeBuffers(bufs, n)
+		}
+		if err != nil {
+			return written, true, err
+		}
+		if n <= 0 {
+			return written, true, io.ErrShortWrite
+		}
+	}
+	return written, true, nil
+}
@@ -0,0 +1,222 @@
+package extraio
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReconnectingConn presents a series of conns from Dial as one long lived
+// conn. When a read or write fails, including a read of io.EOF, the conn
+// is closed and a new one dialed, retrying per Backoff, and the operation
+// carries on over the new conn. Deadline errors are returned as usual.
+//
+// Data in flight when a conn fails may be lost, protocols needing every
+// byte must acknowledge and resend above this layer. NewReconnectingConn
+// must be used to create a ReconnectingConn.
+type ReconnectingConn struct {
+	Dial func(ctx context.Context) (net.Conn, error)
+	// If not nil, run on every new conn before it is used.
+	Handshake func(net.Conn) error
+	Backoff   Backoff
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	conn net.Conn
+	// Incremented with each new conn.
+	gen           uint64
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	reconnects atomic.Int64
+	readCount  atomic.Int64
+	writeCount atomic.Int64
+}
+
+// NewReconnectingConn dials the first conn, retrying per the backoff,
+// before returning. It accepts WithBackoff, WithHandshake and WithContext,
+// which bounds all dialing.
+func NewReconnectingConn(dial func(ctx context.Context) (net.Conn, error), opts ...Option) (*ReconnectingConn, error) {
+	o := applyOptions(opts, optContext|optHandshake|optBackoff, "NewReconnectingConn")
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rc := &ReconnectingConn{Dial: dial, Handshake: o.handshake}
+	if o.backoff != nil {
+		rc.Backoff = *o.backoff
+	}
+	rc.ctx, rc.cancel = context.WithCancel(ctx)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if err := rc.dialLocked(); err != nil {
+		rc.cancel()
+		return nil, err
+	}
+	return rc, nil
+}
+
+// dialLocked dials until a conn passes the handshake or the backoff is
+// exhausted.
+func (rc *ReconnectingConn) dialLocked() error {
+	for attempt := 0; ; attempt++ {
+		c, err := rc.Dial(rc.ctx)
+		if err == nil && rc.Handshake != nil {
+			if err = rc.Handshake(c); err != nil {
+				c.Close()
+			}
+		}
+		if err == nil {
+			rc.conn = c
+			rc.gen++
+			if !rc.readDeadline.IsZero() {
+				c.SetReadDeadline(rc.readDeadline)
+			}
+			if !rc.writeDeadline.IsZero() {
+				c.SetWriteDeadline(rc.writeDeadline)
+			}
+			return nil
+		}
+		if rc.ctx.Err() != nil {
+			return net.ErrClosed
+		}
+		if rc.Backoff.Exhausted(attempt) {
+			return err
+		}
+		if sleepContext(rc.ctx, rc.Backoff.Delay(attempt)) != nil {
+			return net.ErrClosed
+		}
+	}
+}
+
+func (rc *ReconnectingConn) current() (net.Conn, uint64, error) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.ctx.Err() != nil {
+		return nil, 0, net.ErrClosed
+	}
+	return rc.conn, rc.gen, nil
+}
+
+// reconnect replaces conn generation gen, unless that was already done.
+func (rc *ReconnectingConn) reconnect(gen uint64) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.ctx.Err() != nil {
+		return net.ErrClosed
+	}
+	if rc.gen != gen {
+		return nil
+	}
+	rc.conn.Close()
+	if err := rc.dialLocked(); err != nil {
+		return err
+	}
+	rc.reconnects.Add(1)
+	return nil
+}
+
+// retryable reports whether err calls for a new conn.
+func (rc *ReconnectingConn) retryable(err error) bool {
+	return !errors.Is(err, os.ErrDeadlineExceeded) && rc.ctx.Err() == nil
+}
+
+func (rc *ReconnectingConn) Read(buf []byte) (int, error) {
+	for {
+		c, gen, err := rc.current()
+		if err != nil {
+			return 0, err
+		}
+		n, err := c.Read(buf)
+		rc.readCount.Add(int64(n))
+		if n > 0 || err == nil || !rc.retryable(err) {
+			return n, err
+		}
+		if err := rc.reconnect(gen); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (rc *ReconnectingConn) Write(buf []byte) (int, error) {
+	written := 0
+	for {
+		c, gen, err := rc.current()
+		if err != nil {
+			return written, err
+		}
+		n, err := c.Write(buf[written:])
+		rc.writeCount.Add(int64(n))
+		written += n
+		if err == nil || !rc.retryable(err) {
+			return written, err
+		}
+		if err := rc.reconnect(gen); err != nil {
+			return written, err
+		}
+	}
+}
+
+// Reconnects returns the number of times a failed conn was replaced.
+func (rc *ReconnectingConn) Reconnects() int64 {
+	return rc.reconnects.Load()
+}
+
+// Stats returns the bytes read and written over all conns.
+func (rc *ReconnectingConn) Stats() Stats {
+	return Stats{ReadCount: rc.readCount.Load(), WriteCount: rc.writeCount.Load()}
+}
+
+// Close stops any redial in progress and closes the current conn.
+func (rc *ReconnectingConn) Close() error {
+	if rc.ctx.Err() != nil {
+		return net.ErrClosed
+	}
+	rc.cancel()
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.conn.Close()
+}
+
+func (rc *ReconnectingConn) LocalAddr() net.Addr {
+	return rc.NetConn().LocalAddr()
+}
+
+func (rc *ReconnectingConn) RemoteAddr() net.Addr {
+	return rc.NetConn().RemoteAddr()
+}
+
+// SetDeadline applies to the current conn and every later one.
+func (rc *ReconnectingConn) SetDeadline(t time.Time) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.readDeadline, rc.writeDeadline = t, t
+	return rc.conn.SetDeadline(t)
+}
+
+func (rc *ReconnectingConn) SetReadDeadline(t time.Time) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.readDeadline = t
+	return rc.conn.SetReadDeadline(t)
+}
+
+func (rc *ReconnectingConn) SetWriteDeadline(t time.Time) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.writeDeadline = t
+	return rc.conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the current conn.
+func (rc *ReconnectingConn) NetConn() net.Conn {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.conn
+}
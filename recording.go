@@ -0,0 +1,210 @@
+package extraio
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// TranscriptEvent is one operation captured by a RecordingConn.
+type TranscriptEvent struct {
+	Op Op
+	// Time since the recording started.
+	At   time.Duration
+	Data []byte
+	// Error message of the operation, "EOF" for io.EOF.
+	Err string
+}
+
+// transcriptLine is the serialized form of a TranscriptEvent, data that
+// is printable text is kept readable for reviewing fixtures.
+type transcriptLine struct {
+	Op   Op            `json:"op"`
+	At   time.Duration `json:"at"`
+	Text *string       `json:"text,omitempty"`
+	Data []byte        `json:"data,omitempty"`
+	Err  string        `json:"err,omitempty"`
+}
+
+func (ev TranscriptEvent) MarshalJSON() ([]byte, error) {
+	line := transcriptLine{Op: ev.Op, At: ev.At, Err: ev.Err}
+	if isPrintableText(ev.Data) {
+		text := string(ev.Data)
+		line.Text = &text
+	} else {
+		line.Data = ev.Data
+	}
+	return json.Marshal(line)
+}
+
+func (ev *TranscriptEvent) UnmarshalJSON(b []byte) error {
+	var line transcriptLine
+	if err := json.Unmarshal(b, &line); err != nil {
+		return err
+	}
+	*ev = TranscriptEvent{Op: line.Op, At: line.At, Data: line.Data, Err: line.Err}
+	if line.Text != nil {
+		ev.Data = []byte(*line.Text)
+	}
+	return nil
+}
+
+func isPrintableText(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	for _, r := range string(b) {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// Transcript is a recorded session, serialized as one JSON event per line
+// so recordings diff well when committed as test fixtures.
+type Transcript struct {
+	Events []TranscriptEvent
+}
+
+// WriteTo writes t to w as JSON lines.
+func (t *Transcript) WriteTo(w io.Writer) (int64, error) {
+	mw := NewMeteredWriter(w)
+	bw := bufio.NewWriter(mw)
+	enc := json.NewEncoder(bw)
+	for _, ev := range t.Events {
+		if err := enc.Encode(ev); err != nil {
+			return mw.BytesWritten(), err
+		}
+	}
+	err := bw.Flush()
+	return mw.BytesWritten(), err
+}
+
+// ReadTranscript reads a Transcript written by WriteTo.
+func ReadTranscript(r io.Reader) (*Transcript, error) {
+	t := &Transcript{}
+	dec := json.NewDecoder(r)
+	for {
+		var ev TranscriptEvent
+		err := dec.Decode(&ev)
+		if err == io.EOF {
+			return t, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("extraio: reading transcript event %d: %w", len(t.Events), err)
+		}
+		t.Events = append(t.Events, ev)
+	}
+}
+
+// SaveTranscript writes t to the file at path.
+func SaveTranscript(path string, t *Transcript) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = t.WriteTo(f)
+	cerr := f.Close()
+	if err != nil {
+		return err
+	}
+	return cerr
+}
+
+// LoadTranscript reads the Transcript saved at path.
+func LoadTranscript(path string) (*Transcript, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTranscript(f)
+}
+
+// RecordingConn captures every Read, Write and Close on Conn with its
+// data and time, for saving real sessions as test fixtures.
+type RecordingConn struct {
+	Conn net.Conn
+
+	mu     sync.Mutex
+	start  time.Time
+	events []TranscriptEvent
+}
+
+func NewRecordingConn(c net.Conn) *RecordingConn {
+	return &RecordingConn{Conn: c, start: time.Now()}
+}
+
+func (rc *RecordingConn) record(op Op, data []byte, err error) {
+	ev := TranscriptEvent{Op: op}
+	if len(data) > 0 {
+		ev.Data = append([]byte(nil), data...)
+	}
+	if err != nil {
+		ev.Err = err.Error()
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	ev.At = time.Since(rc.start)
+	rc.events = append(rc.events, ev)
+}
+
+// Transcript returns a copy of the events recorded so far.
+func (rc *RecordingConn) Transcript() *Transcript {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return &Transcript{Events: append([]TranscriptEvent(nil), rc.events...)}
+}
+
+func (rc *RecordingConn) Read(buf []byte) (int, error) {
+	n, err := rc.Conn.Read(buf)
+	if n > 0 || err != nil {
+		rc.record(OpRead, buf[:n], err)
+	}
+	return n, err
+}
+
+func (rc *RecordingConn) Write(buf []byte) (int, error) {
+	n, err := rc.Conn.Write(buf)
+	rc.record(OpWrite, buf[:n], err)
+	return n, err
+}
+
+func (rc *RecordingConn) Close() error {
+	err := rc.Conn.Close()
+	rc.record(OpClose, nil, err)
+	return err
+}
+
+func (rc *RecordingConn) LocalAddr() net.Addr {
+	return rc.Conn.LocalAddr()
+}
+
+func (rc *RecordingConn) RemoteAddr() net.Addr {
+	return rc.Conn.RemoteAddr()
+}
+
+func (rc *RecordingConn) SetDeadline(t time.Time) error {
+	return rc.Conn.SetDeadline(t)
+}
+
+func (rc *RecordingConn) SetReadDeadline(t time.Time) error {
+	return rc.Conn.SetReadDeadline(t)
+}
+
+func (rc *RecordingConn) SetWriteDeadline(t time.Time) error {
+	return rc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (rc *RecordingConn) NetConn() net.Conn {
+	return rc.Conn
+}
@@ -0,0 +1,209 @@
+package extraio
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats is a snapshot of a stream's byte counters.
+type Stats struct {
+	ReadCount  int64
+	WriteCount int64
+	// The most bytes held at once, set by wrappers that buffer data
+	// such as BufferedPipe, BatchWriter and MuxStream.
+	MaxBuffered int64
+}
+
+// StatsProvider is implemented by the metered wrappers.
+type StatsProvider interface {
+	Stats() Stats
+}
+
+// WireStatsProvider is implemented by wrappers that change the data
+// passing through them, such as CompressedConn and Mux, to report the
+// bytes on the stream beneath them as well.
+type WireStatsProvider interface {
+	WireStats() Stats
+}
+
+// wireStats returns the WireStats of s or of the first layer beneath it
+// with that method, looking through NetConn, or ok false if none has it.
+func wireStats(s any) (Stats, bool) {
+	for s != nil {
+		if w, ok := s.(WireStatsProvider); ok {
+			return w.WireStats(), true
+		}
+		u, ok := s.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		s = u.NetConn()
+	}
+	return Stats{}, false
+}
+
+// StreamInfo describes a stream registered with a Registry.
+type StreamInfo struct {
+	Name    string
+	Peer    string
+	Created time.Time
+	Age     time.Duration
+	Stats   Stats
+	// The bytes beneath the stream, see WireStatsProvider, otherwise
+	// the same as Stats.
+	Wire Stats
+	// Average bytes per second since Created.
+	ReadRate  float64
+	WriteRate float64
+}
+
+type registryEntry struct {
+	name    string
+	s       StatsProvider
+	created time.Time
+}
+
+// Registry tracks live named streams so they can be listed,
+// for example by an admin endpoint. It is safe for concurrent use.
+type Registry struct {
+	mu      sync.Mutex
+	nextID  uint64
+	streams map[uint64]*registryEntry
+	meters  map[string]*Meter
+	// Final counts of removed streams, by name.
+	retired map[string]Stats
+}
+
+// DefaultRegistry is a process wide Registry for convenience,
+// nothing is added to it unless explicitly registered.
+var DefaultRegistry = &Registry{}
+
+// Register adds s under name and returns a function removing it again,
+// typically deferred or called when the stream is closed.
+// Streams with a RemoteAddr method report it as their peer.
+func (r *Registry) Register(name string, s StatsProvider) func() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.streams == nil {
+		r.streams = make(map[uint64]*registryEntry)
+	}
+	id := r.nextID
+	r.nextID++
+	r.streams[id] = &registryEntry{
+		name:    name,
+		s:       s,
+		created: time.Now(),
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			final := s.Stats()
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			delete(r.streams, id)
+			if r.retired == nil {
+				r.retired = make(map[string]Stats)
+			}
+			total := r.retired[name]
+			total.ReadCount += final.ReadCount
+			total.WriteCount += final.WriteCount
+			r.retired[name] = total
+		})
+	}
+}
+
+// Streams returns a snapshot of all registered streams, oldest first.
+func (r *Registry) Streams() []StreamInfo {
+	r.mu.Lock()
+	entries := make([]*registryEntry, 0, len(r.streams))
+	for _, e := range r.streams {
+		entries = append(entries, e)
+	}
+	r.mu.Unlock()
+
+	now := time.Now()
+	infos := make([]StreamInfo, 0, len(entries))
+	for _, e := range entries {
+		info := StreamInfo{
+			Name:    e.name,
+			Created: e.created,
+			Age:     now.Sub(e.created),
+			Stats:   e.s.Stats(),
+		}
+		info.Wire = info.Stats
+		if w, ok := wireStats(e.s); ok {
+			info.Wire = w
+		}
+		if a, ok := e.s.(interface{ RemoteAddr() net.Addr }); ok {
+			if addr := a.RemoteAddr(); addr != nil {
+				info.Peer = addr.String()
+			}
+		}
+		if secs := info.Age.Seconds(); secs > 0 {
+			info.ReadRate = float64(info.Stats.ReadCount) / secs
+			info.WriteRate = float64(info.Stats.WriteCount) / secs
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Created.Equal(infos[j].Created) {
+			return infos[i].Name < infos[j].Name
+		}
+		return infos[i].Created.Before(infos[j].Created)
+	})
+	return infos
+}
+
+// Totals returns the bytes read and written by every stream ever
+// registered, summed by name. Unlike Streams it includes streams that have
+// since been removed, so the counts never go down unless a stream is Reset.
+func (r *Registry) Totals() map[string]Stats {
+	r.mu.Lock()
+	totals := make(map[string]Stats, len(r.retired))
+	for name, s := range r.retired {
+		totals[name] = s
+	}
+	entries := make([]*registryEntry, 0, len(r.streams))
+	for _, e := range r.streams {
+		entries = append(entries, e)
+	}
+	r.mu.Unlock()
+	for _, e := range entries {
+		s := e.s.Stats()
+		total := totals[e.name]
+		total.ReadCount += s.ReadCount
+		total.WriteCount += s.WriteCount
+		totals[e.name] = total
+	}
+	return totals
+}
+
+// Meter returns the Meter for label, creating it on first use.
+// Attach it to streams with WithMeters to roll their traffic up per label,
+// e.g. NewMeteredConn(c, WithMeters(reg.Meter("tenant=acme"))).
+func (r *Registry) Meter(label string) *Meter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.meters == nil {
+		r.meters = make(map[string]*Meter)
+	}
+	m, ok := r.meters[label]
+	if !ok {
+		m = &Meter{}
+		r.meters[label] = m
+	}
+	return m
+}
+
+// Meters returns a snapshot of every label's Meter.
+func (r *Registry) Meters() map[string]Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := make(map[string]Stats, len(r.meters))
+	for label, m := range r.meters {
+		stats[label] = m.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,261 @@
+package extraio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// ReplayMismatchError is returned by a ReplayConn write that differs
+// from the recording.
+type ReplayMismatchError struct {
+	// Index of the recorded write event.
+	Event int
+	// Offset in the written stream of the first differing byte.
+	Offset int64
+	// Up to 32 bytes expected and written from Offset, Want is empty
+	// when writing beyond the end of the recording.
+	Want []byte
+	Got  []byte
+}
+
+func (e *ReplayMismatchError) Error() string {
+	if len(e.Want) == 0 {
+		return fmt.Sprintf("extraio: replay: write at offset %d beyond end of transcript: %q", e.Offset, e.Got)
+	}
+	return fmt.Sprintf("extraio: replay: write at offset %d differs from event %d: got %q, want %q", e.Offset, e.Event, e.Got, e.Want)
+}
+
+// ReplayConn plays the part of the peer recorded in a Transcript, checking
+// that writes match the recorded writes and answering reads with the
+// recorded reads. Reads and writes are matched separately, so they may
+// be split differently than when recorded, but a read is only served
+// once every write recorded before it has been made. Recorded read
+// errors are returned as their message, io.EOF as itself, and reads past
+// the end of the recording return io.EOF.
+type ReplayConn struct {
+	Transcript *Transcript
+	// Holds back each read until its recorded time since the replay began.
+	Timing bool
+
+	ctx   context.Context
+	start time.Time
+
+	mu sync.Mutex
+	// event index and offset into its data of the next write and read.
+	wEvent, wOff int
+	rEvent, rOff int
+	written      int64
+	err          error
+	// closed and replaced whenever writes advance.
+	progress  chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+
+	readDeadline  deadline
+	writeDeadline deadline
+}
+
+// NewReplayConn accepts WithContext, the context returned by Context.
+// There is no conn beneath a ReplayConn, so it is where ConnContext stops.
+func NewReplayConn(t *Transcript, opts ...Option) *ReplayConn {
+	o := applyOptions(opts, optContext, "NewReplayConn")
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &ReplayConn{
+		Transcript: t,
+		ctx:        ctx,
+		start:      time.Now(),
+		progress:   make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+// next returns the index of the first event from i for op.
+func (rc *ReplayConn) next(i int, op Op) int {
+	events := rc.Transcript.Events
+	for i < len(events) && events[i].Op != op {
+		i++
+	}
+	return i
+}
+
+func replayErr(msg string) error {
+	if msg == io.EOF.Error() {
+		return io.EOF
+	}
+	return errors.New(msg)
+}
+
+func (rc *ReplayConn) Write(buf []byte) (int, error) {
+	if isClosedChan(rc.done) {
+		return 0, net.ErrClosed
+	}
+	if rc.writeDeadline.expired() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.err != nil {
+		return 0, rc.err
+	}
+	n, err := rc.match(buf)
+	close(rc.progress)
+	rc.progress = make(chan struct{})
+	return n, err
+}
+
+// match consumes recorded writes matching buf, rc.mu must be held.
+func (rc *ReplayConn) match(buf []byte) (int, error) {
+	events := rc.Transcript.Events
+	n := 0
+	for n < len(buf) {
+		j := rc.next(rc.wEvent, OpWrite)
+		if j == len(events) {
+			rc.err = &ReplayMismatchError{Event: j, Offset: rc.written, Got: clip(buf[n:], 32)}
+			return n, rc.err
+		}
+		rc.wEvent = j
+		ev := events[j]
+		want := ev.Data[rc.wOff:]
+		k := min(len(want), len(buf)-n)
+		for i := range k {
+			if want[i] != buf[n+i] {
+				rc.err = &ReplayMismatchError{
+					Event:  j,
+					Offset: rc.written + int64(i),
+					Want:   clip(want[i:], 32),
+					Got:    clip(buf[n+i:], 32),
+				}
+				return n + i, rc.err
+			}
+		}
+		n += k
+		rc.wOff += k
+		rc.written += int64(k)
+		if rc.wOff == len(ev.Data) {
+			rc.wEvent++
+			rc.wOff = 0
+			if ev.Err != "" {
+				return n, replayErr(ev.Err)
+			}
+		}
+	}
+	return n, nil
+}
+
+func clip(b []byte, n int) []byte {
+	return append([]byte(nil), b[:min(len(b), n)]...)
+}
+
+func (rc *ReplayConn) Read(buf []byte) (int, error) {
+	for {
+		if isClosedChan(rc.done) {
+			return 0, net.ErrClosed
+		}
+		if rc.readDeadline.expired() {
+			return 0, os.ErrDeadlineExceeded
+		}
+		rc.mu.Lock()
+		events := rc.Transcript.Events
+		j := rc.next(rc.rEvent, OpRead)
+		if j == len(events) {
+			rc.mu.Unlock()
+			return 0, io.EOF
+		}
+		if rc.err != nil {
+			err := rc.err
+			rc.mu.Unlock()
+			return 0, err
+		}
+		if rc.next(rc.wEvent, OpWrite) < j {
+			progress := rc.progress
+			rc.mu.Unlock()
+			select {
+			case <-progress:
+			case <-rc.readDeadline.wait():
+			case <-rc.done:
+			}
+			continue
+		}
+		ev := events[j]
+		rc.mu.Unlock()
+
+		if rc.Timing && !sleepUntil(rc.start.Add(ev.At), rc.readDeadline.wait()) {
+			continue
+		}
+
+		rc.mu.Lock()
+		rc.rEvent = j
+		n := copy(buf, ev.Data[rc.rOff:])
+		rc.rOff += n
+		var err error
+		if rc.rOff == len(ev.Data) {
+			rc.rEvent++
+			rc.rOff = 0
+			if ev.Err != "" {
+				err = replayErr(ev.Err)
+			}
+		}
+		rc.mu.Unlock()
+		return n, err
+	}
+}
+
+// Verify returns the first mismatched write, or an error if recorded
+// writes were never made, for checking a session once it is over.
+func (rc *ReplayConn) Verify() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.err != nil {
+		return rc.err
+	}
+	if j := rc.next(rc.wEvent, OpWrite); j < len(rc.Transcript.Events) {
+		return fmt.Errorf("extraio: replay: recorded write event %d not made, %d bytes written", j, rc.written)
+	}
+	return nil
+}
+
+func (rc *ReplayConn) Close() error {
+	err := net.ErrClosed
+	rc.closeOnce.Do(func() {
+		close(rc.done)
+		err = nil
+	})
+	return err
+}
+
+func (rc *ReplayConn) LocalAddr() net.Addr {
+	return memAddr("replay")
+}
+
+func (rc *ReplayConn) RemoteAddr() net.Addr {
+	return memAddr("replay")
+}
+
+func (rc *ReplayConn) SetDeadline(t time.Time) error {
+	rc.readDeadline.set(t)
+	rc.writeDeadline.set(t)
+	return nil
+}
+
+func (rc *ReplayConn) SetReadDeadline(t time.Time) error {
+	rc.readDeadline.set(t)
+	return nil
+}
+
+func (rc *ReplayConn) SetWriteDeadline(t time.Time) error {
+	rc.writeDeadline.set(t)
+	return nil
+}
+
+func (rc *ReplayConn) Context() context.Context {
+	return rc.ctx
+}
@@ -0,0 +1,308 @@
+package extraio
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var ErrSourceChanged = errors.New("extraio: source changed since checkpoint")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Checkpoint records the progress of a ResumableCopy.
+type Checkpoint struct {
+	Offset int64
+	// Marshalled state of ResumableCopy.Hash after Offset bytes.
+	HashState []byte `json:",omitempty"`
+	// CRC-32C of the OverlapLen source bytes ending at Offset,
+	// checked against the source when resuming.
+	OverlapSum uint32
+	OverlapLen int
+}
+
+// CheckpointStore persists checkpoints for ResumableCopy.
+type CheckpointStore interface {
+	// Load returns false if no checkpoint exists for key.
+	Load(key string) (Checkpoint, bool, error)
+	Save(key string, cp Checkpoint) error
+	Delete(key string) error
+}
+
+// MemoryCheckpointStore keeps checkpoints in memory, mostly useful for tests.
+type MemoryCheckpointStore struct {
+	mu  sync.Mutex
+	cps map[string]Checkpoint
+}
+
+func (s *MemoryCheckpointStore) Load(key string) (Checkpoint, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cp, ok := s.cps[key]
+	return cp, ok, nil
+}
+
+func (s *MemoryCheckpointStore) Save(key string, cp Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cps == nil {
+		s.cps = make(map[string]Checkpoint)
+	}
+	s.cps[key] = cp
+	return nil
+}
+
+func (s *MemoryCheckpointStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.cps, key)
+	return nil
+}
+
+// DirCheckpointStore keeps each checkpoint as a JSON file in Dir,
+// replaced atomically on every save. Keys must be valid file names.
+type DirCheckpointStore struct {
+	Dir string
+}
+
+func (s *DirCheckpointStore) path(key string) string {
+	return filepath.Join(s.Dir, key+".checkpoint")
+}
+
+func (s *DirCheckpointStore) Load(key string) (Checkpoint, bool, error) {
+	var cp Checkpoint
+	buf, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, false, nil
+	}
+	if err != nil {
+		return cp, false, err
+	}
+	if err := json.Unmarshal(buf, &cp); err != nil {
+		return cp, false, fmt.Errorf("extraio: corrupt checkpoint %q: %w", key, err)
+	}
+	return cp, true, nil
+}
+
+func (s *DirCheckpointStore) Save(key string, cp Checkpoint) error {
+	buf, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(s.Dir, key+".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), s.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (s *DirCheckpointStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+const (
+	defaultCheckpointInterval = 4 << 20
+	defaultCheckpointOverlap  = 4096
+)
+
+// ResumableCopy copies Src to Dst, saving a Checkpoint to Store every Interval
+// bytes so an interrupted copy can be resumed by running it again with the
+// same Key. On resume the Overlap source bytes before the checkpoint are
+// re-read and verified, and both Src and Dst are seeked to the checkpoint.
+type ResumableCopy struct {
+	Src   io.ReadSeeker
+	Dst   io.WriteSeeker
+	Store CheckpointStore
+	Key   string
+	// Bytes between checkpoints, default 4MiB.
+	Interval int64
+	// Bytes verified when resuming, default 4KiB.
+	Overlap int
+	// Optional running hash of everything copied, its state is saved in each
+	// checkpoint so it must implement encoding.BinaryMarshaler and
+	// encoding.BinaryUnmarshaler, as the crypto/sha256 and crypto/sha512 hashes do.
+	Hash hash.Hash
+}
+
+// Run copies from the last checkpoint to EOF and returns the final offset.
+// Dst is synced before each checkpoint if it has a Sync method. The
+// checkpoint is deleted once the copy completes.
+func (rc *ResumableCopy) Run(ctx context.Context) (int64, error) {
+	interval := rc.Interval
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	overlap := rc.Overlap
+	if overlap <= 0 {
+		overlap = defaultCheckpointOverlap
+	}
+
+	cp, ok, err := rc.Store.Load(rc.Key)
+	if err != nil {
+		return 0, err
+	}
+	tail := make([]byte, 0, overlap)
+	var off int64
+	if ok {
+		tail, err = rc.resume(cp, tail)
+		if err != nil {
+			return 0, err
+		}
+		off = cp.Offset
+	}
+	if _, err := rc.Dst.Seek(off, io.SeekStart); err != nil {
+		return off, err
+	}
+
+	buf := getBuf()
+	defer putBuf(buf)
+	lastCheckpoint := off
+	for {
+		if err := ctx.Err(); err != nil {
+			return off, rc.checkpointAfterError(off, tail, err)
+		}
+		n, rerr := rc.Src.Read(*buf)
+		if n > 0 {
+			nw, werr := rc.Dst.Write((*buf)[:n])
+			if werr == nil && nw != n {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				// The partial write is redone from the last good offset.
+				return off, rc.checkpointAfterError(off, tail, werr)
+			}
+			if rc.Hash != nil {
+				rc.Hash.Write((*buf)[:n])
+			}
+			tail = appendTail(tail, (*buf)[:n], overlap)
+			off += int64(n)
+			if off-lastCheckpoint >= interval {
+				if err := rc.checkpoint(off, tail); err != nil {
+					return off, err
+				}
+				lastCheckpoint = off
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return off, rc.checkpointAfterError(off, tail, rerr)
+		}
+	}
+	if err := syncIfPossible(rc.Dst); err != nil {
+		return off, err
+	}
+	return off, rc.Store.Delete(rc.Key)
+}
+
+func (rc *ResumableCopy) resume(cp Checkpoint, tail []byte) ([]byte, error) {
+	if cp.OverlapLen > int(cp.Offset) || cp.OverlapLen < 0 {
+		return nil, fmt.Errorf("extraio: invalid checkpoint %q", rc.Key)
+	}
+	if _, err := rc.Src.Seek(cp.Offset-int64(cp.OverlapLen), io.SeekStart); err != nil {
+		return nil, err
+	}
+	if cap(tail) < cp.OverlapLen {
+		tail = make([]byte, 0, cp.OverlapLen)
+	}
+	tail = tail[:cp.OverlapLen]
+	if _, err := io.ReadFull(rc.Src, tail); err != nil {
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, ErrSourceChanged
+		}
+		return nil, err
+	}
+	if crc32.Checksum(tail, castagnoli) != cp.OverlapSum {
+		return nil, ErrSourceChanged
+	}
+	if rc.Hash != nil {
+		u, ok := rc.Hash.(encoding.BinaryUnmarshaler)
+		if !ok || (cp.HashState == nil && cp.Offset != 0) {
+			return nil, fmt.Errorf("extraio: cannot restore hash state for %q", rc.Key)
+		}
+		if cp.HashState != nil {
+			if err := u.UnmarshalBinary(cp.HashState); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tail, nil
+}
+
+func (rc *ResumableCopy) checkpoint(off int64, tail []byte) error {
+	if err := syncIfPossible(rc.Dst); err != nil {
+		return err
+	}
+	cp := Checkpoint{
+		Offset:     off,
+		OverlapSum: crc32.Checksum(tail, castagnoli),
+		OverlapLen: len(tail),
+	}
+	if rc.Hash != nil {
+		m, ok := rc.Hash.(encoding.BinaryMarshaler)
+		if !ok {
+			return errors.New("extraio: ResumableCopy.Hash must implement encoding.BinaryMarshaler")
+		}
+		state, err := m.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		cp.HashState = state
+	}
+	return rc.Store.Save(rc.Key, cp)
+}
+
+// checkpointAfterError saves progress so far, returning the original error.
+func (rc *ResumableCopy) checkpointAfterError(off int64, tail []byte, err error) error {
+	if cperr := rc.checkpoint(off, tail); cperr != nil {
+		return errors.Join(err, cperr)
+	}
+	return err
+}
+
+// appendTail appends p to tail keeping only the last max bytes.
+func appendTail(tail, p []byte, max int) []byte {
+	if len(p) >= max {
+		tail = tail[:max]
+		copy(tail, p[len(p)-max:])
+		return tail
+	}
+	if keep := max - len(p); len(tail) > keep {
+		copy(tail, tail[len(tail)-keep:])
+		tail = tail[:keep]
+	}
+	return append(tail, p...)
+}
+
+func syncIfPossible(w interface{}) error {
+	if s, ok := w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// ResumableReader reads from a source that can be reopened at an offset,
+// such as a file or an HTTP range request, tracking the offset consumed.
+// When a read fails with an error Retryable accepts, the reader is closed
+// and Open called for a new one at the current offset, retrying per
+// Backoff, so a download or upload carries on where it broke off.
+type ResumableReader struct {
+	Open    func(offset int64) (io.ReadCloser, error)
+	Backoff Backoff
+	// Defaults to every error but io.EOF.
+	Retryable func(error) bool
+
+	ctx     context.Context
+	r       io.ReadCloser
+	off     int64
+	resumes int
+}
+
+// NewResumableReader returns a ResumableReader starting at offset, which
+// calls open on the first Read. It accepts WithBackoff and WithContext,
+// which abandons the sleep between attempts.
+func NewResumableReader(open func(offset int64) (io.ReadCloser, error), offset int64, opts ...Option) *ResumableReader {
+	o := applyOptions(opts, optContext|optBackoff, "NewResumableReader")
+	rr := &ResumableReader{Open: open, ctx: o.ctx, off: offset}
+	if o.backoff != nil {
+		rr.Backoff = *o.backoff
+	}
+	if rr.ctx == nil {
+		rr.ctx = context.Background()
+	}
+	return rr
+}
+
+// OpenFileAt returns an open function for a ResumableReader reading the
+// file at path, seeking each newly opened file to the offset.
+func OpenFileAt(path string) func(offset int64) (io.ReadCloser, error) {
+	return func(offset int64) (io.ReadCloser, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return f, nil
+	}
+}
+
+func (rr *ResumableReader) retryable(err error) bool {
+	if rr.Retryable == nil {
+		return err != io.EOF
+	}
+	return rr.Retryable(err)
+}
+
+func (rr *ResumableReader) Read(buf []byte) (int, error) {
+	for attempt := 0; ; attempt++ {
+		var err error
+		if rr.r == nil {
+			rr.r, err = rr.Open(rr.off)
+			if err != nil {
+				rr.r = nil
+			}
+		}
+		if rr.r != nil {
+			var n int
+			n, err = rr.r.Read(buf)
+			rr.off += int64(n)
+			if err != nil && err != io.EOF && rr.retryable(err) {
+				// Resume on the next call, after returning the data.
+				rr.detach()
+			}
+			if n > 0 || err == nil || err == io.EOF {
+				return n, err
+			}
+		}
+		if !rr.retryable(err) || rr.Backoff.Exhausted(attempt) {
+			return 0, err
+		}
+		if serr := sleepContext(rr.ctx, rr.Backoff.Delay(attempt)); serr != nil {
+			return 0, err
+		}
+		rr.detach()
+	}
+}
+
+// detach closes the current reader so the next read reopens.
+func (rr *ResumableReader) detach() {
+	if rr.r != nil {
+		rr.r.Close()
+		rr.r = nil
+		rr.resumes++
+	}
+}
+
+// Attach replaces the underlying reader with r, which must be positioned
+// at Offset, closing the old one. This resumes by hand, for callers that
+// reopen the source themselves.
+func (rr *ResumableReader) Attach(r io.ReadCloser) {
+	rr.detach()
+	rr.r = r
+}
+
+// Offset returns the offset of the next byte to be read.
+func (rr *ResumableReader) Offset() int64 {
+	return rr.off
+}
+
+// Resumes returns the number of times the underlying reader was replaced.
+func (rr *ResumableReader) Resumes() int {
+	return rr.resumes
+}
+
+// Close closes the current underlying reader, if any.
+func (rr *ResumableReader) Close() error {
+	if rr.r == nil {
+		return nil
+	}
+	err := rr.r.Close()
+	rr.r = nil
+	return err
+}
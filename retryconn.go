@@ -0,0 +1,158 @@
+package extraio
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+)
+
+// RetryConn retries reads and writes that fail with an error Temporary
+// classifies as worth retrying, sleeping between attempts per Backoff.
+// Data written before a failure is not written again.
+type RetryConn struct {
+	Conn    net.Conn
+	Backoff Backoff
+	// Defaults to IsTemporary.
+	Temporary func(error) bool
+}
+
+// Accepts WithBackoff.
+func NewRetryConn(c net.Conn, opts ...Option) *RetryConn {
+	o := applyOptions(opts, optBackoff, "NewRetryConn")
+	rc := &RetryConn{Conn: c, Temporary: IsTemporary}
+	if o.backoff != nil {
+		rc.Backoff = *o.backoff
+	}
+	return rc
+}
+
+func (rc *RetryConn) temporary(err error) bool {
+	if rc.Temporary == nil {
+		return IsTemporary(err)
+	}
+	return rc.Temporary(err)
+}
+
+func (rc *RetryConn) Read(buf []byte) (int, error) {
+	for attempt := 0; ; attempt++ {
+		n, err := rc.Conn.Read(buf)
+		if n > 0 || err == nil || !rc.temporary(err) || rc.Backoff.Exhausted(attempt) {
+			return n, err
+		}
+		time.Sleep(rc.Backoff.Delay(attempt))
+	}
+}
+
+func (rc *RetryConn) Write(buf []byte) (int, error) {
+	written := 0
+	for attempt := 0; ; {
+		n, err := rc.Conn.Write(buf[written:])
+		written += n
+		if err == nil || !rc.temporary(err) || rc.Backoff.Exhausted(attempt) {
+			return written, err
+		}
+		if n > 0 {
+			attempt = 0
+			continue
+		}
+		time.Sleep(rc.Backoff.Delay(attempt))
+		attempt++
+	}
+}
+
+func (rc *RetryConn) Close() error {
+	return rc.Conn.Close()
+}
+
+func (rc *RetryConn) LocalAddr() net.Addr {
+	return rc.Conn.LocalAddr()
+}
+
+func (rc *RetryConn) RemoteAddr() net.Addr {
+	return rc.Conn.RemoteAddr()
+}
+
+func (rc *RetryConn) SetDeadline(t time.Time) error {
+	return rc.Conn.SetDeadline(t)
+}
+
+func (rc *RetryConn) SetReadDeadline(t time.Time) error {
+	return rc.Conn.SetReadDeadline(t)
+}
+
+func (rc *RetryConn) SetWriteDeadline(t time.Time) error {
+	return rc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (rc *RetryConn) NetConn() net.Conn {
+	return rc.Conn
+}
+
+// RetryWriter retries writes to W that fail with an error Temporary
+// classifies as transient, such as those from flaky network filesystems,
+// sleeping between attempts per Backoff. A retry resumes after the bytes
+// already written, and if W is an io.Seeker it is first moved back there
+// in case the failed write advanced the offset without saying so.
+type RetryWriter struct {
+	W       io.Writer
+	Backoff Backoff
+	// Defaults to IsTemporary.
+	Temporary func(error) bool
+
+	ctx context.Context
+}
+
+// NewRetryWriter returns a RetryWriter, temporary may be nil to use
+// IsTemporary. It accepts WithBackoff and WithContext, which abandons the
+// sleep between attempts.
+func NewRetryWriter(w io.Writer, temporary func(error) bool, opts ...Option) *RetryWriter {
+	o := applyOptions(opts, optContext|optBackoff, "NewRetryWriter")
+	rw := &RetryWriter{W: w, Temporary: temporary, ctx: o.ctx}
+	if o.backoff != nil {
+		rw.Backoff = *o.backoff
+	}
+	if rw.ctx == nil {
+		rw.ctx = context.Background()
+	}
+	return rw
+}
+
+func (rw *RetryWriter) temporary(err error) bool {
+	if rw.Temporary == nil {
+		return IsTemporary(err)
+	}
+	return rw.Temporary(err)
+}
+
+func (rw *RetryWriter) Write(buf []byte) (int, error) {
+	seeker, _ := rw.W.(io.Seeker)
+	start := int64(-1)
+	if seeker != nil {
+		if pos, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			start = pos
+		}
+	}
+	written := 0
+	for attempt := 0; ; {
+		n, err := rw.W.Write(buf[written:])
+		written += n
+		if err == nil || !rw.temporary(err) || rw.Backoff.Exhausted(attempt) {
+			return written, err
+		}
+		if n > 0 {
+			attempt = 0
+		} else {
+			if serr := sleepContext(rw.ctx, rw.Backoff.Delay(attempt)); serr != nil {
+				return written, err
+			}
+			attempt++
+		}
+		if start >= 0 {
+			if _, serr := seeker.Seek(start+int64(written), io.SeekStart); serr != nil {
+				return written, err
+			}
+		}
+	}
+}
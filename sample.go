@@ -0,0 +1,105 @@
+package extraio
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Sampler decides which of a stream of events to keep, one in every
+// Every events and at most PerSecond per second. Zero fields do not limit.
+// It is safe for concurrent use.
+type Sampler struct {
+	Every     int64
+	PerSecond int64
+
+	count int64
+
+	mu          sync.Mutex
+	second      int64
+	secondCount int64
+}
+
+// Sample reports whether the current event should be kept.
+func (s *Sampler) Sample() bool {
+	if s.Every > 1 && atomic.AddInt64(&s.count, 1)%s.Every != 0 {
+		return false
+	}
+	if s.PerSecond <= 0 {
+		return true
+	}
+	now := time.Now().Unix()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now != s.second {
+		s.second = now
+		s.secondCount = 0
+	}
+	if s.secondCount >= s.PerSecond {
+		return false
+	}
+	s.secondCount++
+	return true
+}
+
+// SampledConn calls Fn after the reads and writes chosen by Sampler,
+// so busy connections can be observed without logging every operation.
+type SampledConn struct {
+	Conn    net.Conn
+	Sampler Sampler
+	Fn      func(op Op, n int, err error)
+}
+
+func NewSampledConn(c net.Conn, every int64, fn func(op Op, n int, err error)) *SampledConn {
+	return &SampledConn{
+		Conn:    c,
+		Sampler: Sampler{Every: every},
+		Fn:      fn,
+	}
+}
+
+func (sc *SampledConn) Read(buf []byte) (int, error) {
+	n, err := sc.Conn.Read(buf)
+	if sc.Sampler.Sample() {
+		sc.Fn(OpRead, n, err)
+	}
+	return n, err
+}
+
+func (sc *SampledConn) Write(buf []byte) (int, error) {
+	n, err := sc.Conn.Write(buf)
+	if sc.Sampler.Sample() {
+		sc.Fn(OpWrite, n, err)
+	}
+	return n, err
+}
+
+func (sc *SampledConn) Close() error {
+	return sc.Conn.Close()
+}
+
+func (sc *SampledConn) LocalAddr() net.Addr {
+	return sc.Conn.LocalAddr()
+}
+
+func (sc *SampledConn) RemoteAddr() net.Addr {
+	return sc.Conn.RemoteAddr()
+}
+
+func (sc *SampledConn) SetDeadline(t time.Time) error {
+	return sc.Conn.SetDeadline(t)
+}
+
+func (sc *SampledConn) SetReadDeadline(t time.Time) error {
+	return sc.Conn.SetReadDeadline(t)
+}
+
+func (sc *SampledConn) SetWriteDeadline(t time.Time) error {
+	return sc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (sc *SampledConn) NetConn() net.Conn {
+	return sc.Conn
+}
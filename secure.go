@@ -0,0 +1,396 @@
+package extraio
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrHandshake      = errors.New("extraio: secure transport handshake failed")
+	ErrAuthentication = errors.New("extraio: message authentication failed")
+)
+
+// Hello messages are "XIOS" version flags ncipher ciphers... random[32].
+var secureMagic = []byte("XIOS")
+
+const (
+	secureVersion    = 1
+	secureFlagFlate  = 1
+	secureRandomLen  = 32
+	secureMaxPlain   = 64 * 1024
+	secureMaxCiphers = 16
+
+	cipherAES256GCM = 1
+	cipherAES128GCM = 2
+)
+
+// Ciphers in order of preference, with their key sizes.
+var secureCiphers = []struct {
+	id     byte
+	keyLen int
+}{
+	{cipherAES256GCM, 32},
+	{cipherAES128GCM, 16},
+}
+
+// sealedWriter encrypts each write as one or more frames of
+// [uint32 ciphertext length][ciphertext], the length is authenticated
+// and the nonce is a per direction frame counter. A frame with no
+// plaintext ends the stream, so a cut one can be told from a closed one.
+type sealedWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+	seq  uint64
+	buf  []byte
+}
+
+func (sw *sealedWriter) nonce() []byte {
+	nonce := make([]byte, sw.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], sw.seq)
+	sw.seq++
+	return nonce
+}
+
+func (sw *sealedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:minInt(len(p), secureMaxPlain)]
+		var hdr [4]byte
+		binary.BigEndian.PutUint32(hdr[:], uint32(len(chunk)+sw.aead.Overhead()))
+		sw.buf = append(sw.buf[:0], hdr[:]...)
+		sw.buf = sw.aead.Seal(sw.buf, sw.nonce(), chunk, hdr[:])
+		if _, err := sw.w.Write(sw.buf); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
+
+// close sends the frame ending the stream.
+func (sw *sealedWriter) close() error {
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(sw.aead.Overhead()))
+	sw.buf = append(sw.buf[:0], hdr[:]...)
+	sw.buf = sw.aead.Seal(sw.buf, sw.nonce(), nil, hdr[:])
+	_, err := sw.w.Write(sw.buf)
+	return err
+}
+
+// openedReader reads and authenticates the frames of a sealedWriter,
+// returning io.ErrUnexpectedEOF if the stream ends without its final frame.
+type openedReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	seq   uint64
+	buf   []byte
+	plain []byte
+	ended bool
+}
+
+func (or *openedReader) nonce() []byte {
+	nonce := make([]byte, or.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], or.seq)
+	or.seq++
+	return nonce
+}
+
+func (or *openedReader) Read(p []byte) (int, error) {
+	for len(or.plain) == 0 {
+		if or.ended {
+			return 0, io.EOF
+		}
+		var hdr [4]byte
+		if _, err := io.ReadFull(or.r, hdr[:]); err != nil {
+			return 0, noEOF(err)
+		}
+		n := int(binary.BigEndian.Uint32(hdr[:]))
+		if n < or.aead.Overhead() || n > secureMaxPlain+or.aead.Overhead() {
+			return 0, ErrAuthentication
+		}
+		if cap(or.buf) < n {
+			or.buf = make([]byte, n)
+		}
+		ct := or.buf[:n]
+		if _, err := io.ReadFull(or.r, ct); err != nil {
+			return 0, noEOF(err)
+		}
+		plain, err := or.aead.Open(ct[:0], or.nonce(), ct, hdr[:])
+		if err != nil {
+			return 0, ErrAuthentication
+		}
+		or.plain = plain
+		or.ended = len(plain) == 0
+	}
+	n := copy(p, or.plain)
+	or.plain = or.plain[n:]
+	return n, nil
+}
+
+// SecureTransport runs a handshake over rwc with a peer doing the same,
+// then returns a stream that encrypts and authenticates everything with
+// keys derived from the pre-shared key. The peers agree on the protocol
+// version and cipher (AES-256-GCM or AES-128-GCM), and with
+// WithCompression on both sides data is compressed before encryption.
+// Each peer's writes are framed and sealed with a key and nonce sequence
+// of their own, so frames cannot be replayed, reordered or reflected.
+// Close sends a sealed final frame, a stream ending without one reads as
+// io.ErrUnexpectedEOF, so truncation cannot pass for a clean end.
+//
+// Compression is flushed at the end of every Write, so the size of each
+// frame reveals how well that write compressed. An attacker who can get
+// their own data written alongside a secret can use that to recover the
+// secret, as in the CRIME attack on TLS. Only use WithCompression when
+// writes never mix secrets with data an attacker controls.
+//
+// If the handshake fails the caller should close rwc.
+// Accepts WithCompression.
+func SecureTransport(rwc io.ReadWriteCloser, key []byte, opts ...Option) (io.ReadWriteCloser, error) {
+	o := applyOptions(opts, optCompression, "SecureTransport")
+
+	hello := make([]byte, 0, 7+len(secureCiphers)+secureRandomLen)
+	hello = append(hello, secureMagic...)
+	hello = append(hello, secureVersion)
+	var flags byte
+	if o.compress {
+		flags |= secureFlagFlate
+	}
+	hello = append(hello, flags, byte(len(secureCiphers)))
+	for _, c := range secureCiphers {
+		hello = append(hello, c.id)
+	}
+	random := make([]byte, secureRandomLen)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	hello = append(hello, random...)
+
+	// Both peers write first, so write concurrently in
+	// case rwc is unbuffered.
+	werr := make(chan error, 1)
+	go func() {
+		_, err := rwc.Write(hello)
+		werr <- err
+	}()
+	peerHello, err := readHello(rwc)
+	if err != nil {
+		return nil, err
+	}
+	if err := <-werr; err != nil {
+		return nil, err
+	}
+
+	// The only version so far is 1, later versions will fall back to it.
+	if peerHello[4] < 1 {
+		return nil, ErrHandshake
+	}
+	peerCiphers := peerHello[7 : 7+int(peerHello[6])]
+	peerRandom := peerHello[len(peerHello)-secureRandomLen:]
+	if bytes.Equal(peerRandom, random) {
+		return nil, ErrHandshake
+	}
+	keyLen := 0
+	for _, c := range secureCiphers {
+		if bytes.IndexByte(peerCiphers, c.id) >= 0 {
+			keyLen = c.keyLen
+			break
+		}
+	}
+	if keyLen == 0 {
+		return nil, ErrHandshake
+	}
+	compress := o.compress && peerHello[5]&secureFlagFlate != 0
+
+	// Bind the keys to both hellos, in an order both peers agree on.
+	transcript := sha256.New()
+	if bytes.Compare(hello, peerHello) < 0 {
+		transcript.Write(hello)
+		transcript.Write(peerHello)
+	} else {
+		transcript.Write(peerHello)
+		transcript.Write(hello)
+	}
+	salt := transcript.Sum(nil)
+	sendAEAD, err := secureAEAD(key, salt, random, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	recvAEAD, err := secureAEAD(key, salt, peerRandom, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &sealedWriter{w: rwc, aead: sendAEAD}
+	or := &openedReader{r: rwc, aead: recvAEAD}
+
+	// Each side proves it derived the same keys from the same hellos.
+	go func() {
+		_, err := sw.Write(salt)
+		werr <- err
+	}()
+	confirm := make([]byte, len(salt))
+	_, err = io.ReadFull(or, confirm)
+	if err == ErrAuthentication || (err == nil && subtle.ConstantTimeCompare(confirm, salt) != 1) {
+		err = ErrHandshake
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := <-werr; err != nil {
+		return nil, err
+	}
+
+	st := &secureTransport{rwc: rwc, r: or, w: sw, sw: sw}
+	if compress {
+		fw, err := flate.NewWriter(sw, o.compressLevel)
+		if err != nil {
+			return nil, err
+		}
+		st.fw = fw
+		st.w = fw
+		st.r = flate.NewReader(or)
+	}
+	return st, nil
+}
+
+func readHello(r io.Reader) ([]byte, error) {
+	hello := make([]byte, 7, 7+secureMaxCiphers+secureRandomLen)
+	if _, err := io.ReadFull(r, hello); err != nil {
+		return nil, noEOF(err)
+	}
+	if !bytes.Equal(hello[:4], secureMagic) || hello[6] > secureMaxCiphers {
+		return nil, ErrHandshake
+	}
+	hello = hello[:7+int(hello[6])+secureRandomLen]
+	if _, err := io.ReadFull(r, hello[7:]); err != nil {
+		return nil, noEOF(err)
+	}
+	return hello, nil
+}
+
+func secureAEAD(key, salt, random []byte, keyLen int) (cipher.AEAD, error) {
+	k, err := hkdf.Key(sha256.New, key, salt, "extraio secure transport "+string(random), keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+type secureTransport struct {
+	rwc io.ReadWriteCloser
+	r   io.Reader
+	w   io.Writer
+	sw  *sealedWriter
+	fw  *flate.Writer
+	wmu sync.Mutex
+	// Set once the final frame has been sent.
+	closed bool
+}
+
+func (st *secureTransport) Read(buf []byte) (int, error) {
+	return st.r.Read(buf)
+}
+
+func (st *secureTransport) Write(buf []byte) (int, error) {
+	st.wmu.Lock()
+	defer st.wmu.Unlock()
+	n, err := st.w.Write(buf)
+	if err == nil && st.fw != nil {
+		err = st.fw.Flush()
+	}
+	return n, err
+}
+
+// Close ends the compressed stream if any, sends the final frame and
+// closes the underlying stream.
+func (st *secureTransport) Close() error {
+	st.wmu.Lock()
+	var ferr error
+	if !st.closed {
+		st.closed = true
+		if st.fw != nil {
+			ferr = st.fw.Close()
+		}
+		if ferr == nil {
+			ferr = st.sw.close()
+		}
+	}
+	st.wmu.Unlock()
+	return errors.Join(ferr, st.rwc.Close())
+}
+
+// EncryptedConn is a net.Conn secured by SecureTransport, for handing an
+// encrypted stream to code expecting a conn. Deadlines and addresses are
+// those of Conn. As with TLS, a write cut short by a deadline leaves the
+// stream unusable. SecureTransport secures any io.ReadWriteCloser, such
+// as a command's stdio, the same way.
+type EncryptedConn struct {
+	Conn net.Conn
+
+	st io.ReadWriteCloser
+}
+
+// NewEncryptedConn runs the SecureTransport handshake over c with key and
+// opts, closing c if it fails.
+func NewEncryptedConn(c net.Conn, key []byte, opts ...Option) (*EncryptedConn, error) {
+	st, err := SecureTransport(c, key, opts...)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	return &EncryptedConn{Conn: c, st: st}, nil
+}
+
+func (ec *EncryptedConn) Read(buf []byte) (int, error) {
+	return ec.st.Read(buf)
+}
+
+func (ec *EncryptedConn) Write(buf []byte) (int, error) {
+	return ec.st.Write(buf)
+}
+
+func (ec *EncryptedConn) Close() error {
+	return ec.st.Close()
+}
+
+func (ec *EncryptedConn) LocalAddr() net.Addr {
+	return ec.Conn.LocalAddr()
+}
+
+func (ec *EncryptedConn) RemoteAddr() net.Addr {
+	return ec.Conn.RemoteAddr()
+}
+
+func (ec *EncryptedConn) SetDeadline(t time.Time) error {
+	return ec.Conn.SetDeadline(t)
+}
+
+func (ec *EncryptedConn) SetReadDeadline(t time.Time) error {
+	return ec.Conn.SetReadDeadline(t)
+}
+
+func (ec *EncryptedConn) SetWriteDeadline(t time.Time) error {
+	return ec.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (ec *EncryptedConn) NetConn() net.Conn {
+	return ec.Conn
+}
@@ -0,0 +1,110 @@
+package extraio
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+	"testing"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// tamperStream flips a bit in every write once armed.
+type tamperStream struct {
+	io.ReadWriteCloser
+	armed atomic.Bool
+}
+
+func (ts *tamperStream) Write(p []byte) (int, error) {
+	if ts.armed.Load() && len(p) > 0 {
+		p = append([]byte(nil), p...)
+		p[len(p)-1] ^= 1
+	}
+	return ts.ReadWriteCloser.Write(p)
+}
+
+func securePair(t *testing.T, a, b io.ReadWriteCloser, opts ...Option) (io.ReadWriteCloser, io.ReadWriteCloser) {
+	t.Helper()
+	type result struct {
+		st  io.ReadWriteCloser
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		st, err := SecureTransport(b, testKey, opts...)
+		ch <- result{st, err}
+	}()
+	sa, err := SecureTransport(a, testKey, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := <-ch
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	return sa, r.st
+}
+
+func TestSecureTransportRoundTrip(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithCompression(-1)}} {
+		a, b := SocketPair()
+		sa, sb := securePair(t, a, b, opts...)
+		msg := bytes.Repeat([]byte("secret "), 20000)
+		go func() {
+			sa.Write(msg)
+			sa.Close()
+		}()
+		got, err := io.ReadAll(sb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatal("data mismatch")
+		}
+	}
+}
+
+func TestSecureTransportTruncated(t *testing.T) {
+	a, b := SocketPair()
+	sa, sb := securePair(t, a, b)
+	go func() {
+		sa.Write([]byte("hello"))
+		// Cut the stream at a frame boundary without the final frame.
+		a.Close()
+	}()
+	got, err := io.ReadAll(sb)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("got %v, want io.ErrUnexpectedEOF", err)
+	}
+	if string(got) != "hello" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestSecureTransportTampered(t *testing.T) {
+	a, b := SocketPair()
+	ta := &tamperStream{ReadWriteCloser: a}
+	sa, sb := securePair(t, ta, b)
+	ta.armed.Store(true)
+	go sa.Write([]byte("hello"))
+	if _, err := sb.Read(make([]byte, 16)); err != ErrAuthentication {
+		t.Fatalf("got %v, want ErrAuthentication", err)
+	}
+}
+
+func TestSecureTransportWrongKey(t *testing.T) {
+	a, b := SocketPair()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := SecureTransport(b, []byte("another key"))
+		b.Close()
+		errc <- err
+	}()
+	if _, err := SecureTransport(a, testKey); err == nil {
+		t.Fatal("handshake succeeded with different keys")
+	}
+	a.Close()
+	if err := <-errc; err == nil {
+		t.Fatal("peer handshake succeeded with different keys")
+	}
+}
@@ -0,0 +1,100 @@
+package extraio
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// segmentWriter delivers writes to W in segments of at most size bytes,
+// when delay is non zero small writes are held for up to delay and
+// coalesced, much like Nagle's algorithm.
+type segmentWriter struct {
+	w     io.WriteCloser
+	size  int
+	delay time.Duration
+
+	mu      sync.Mutex
+	pending []byte
+	timer   *time.Timer
+	err     error
+}
+
+func newSegmentWriter(w io.WriteCloser, size int, delay time.Duration) *segmentWriter {
+	if size <= 0 {
+		size = defaultBufSize
+	}
+	return &segmentWriter{w: w, size: size, delay: delay}
+}
+
+func (sw *segmentWriter) Write(p []byte) (int, error) {
+	if sw.delay <= 0 {
+		return sw.writeSegments(p)
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.err != nil {
+		return 0, sw.err
+	}
+	sw.pending = append(sw.pending, p...)
+	for len(sw.pending) >= sw.size {
+		if _, err := sw.w.Write(sw.pending[:sw.size]); err != nil {
+			sw.err = err
+			return 0, err
+		}
+		sw.pending = sw.pending[:copy(sw.pending, sw.pending[sw.size:])]
+	}
+	if len(sw.pending) > 0 && sw.timer == nil {
+		sw.timer = time.AfterFunc(sw.delay, sw.timedFlush)
+	}
+	return len(p), nil
+}
+
+func (sw *segmentWriter) writeSegments(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		seg := p[:minInt(len(p), sw.size)]
+		n, err := sw.w.Write(seg)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (sw *segmentWriter) timedFlush() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	sw.timer = nil
+	sw.flushLocked()
+}
+
+func (sw *segmentWriter) flushLocked() error {
+	if sw.err != nil || len(sw.pending) == 0 {
+		return sw.err
+	}
+	_, err := sw.w.Write(sw.pending)
+	sw.pending = sw.pending[:0]
+	if err != nil {
+		sw.err = err
+	}
+	return err
+}
+
+// Close sends any coalesced data before closing, like a Write it blocks
+// until the peer reads it.
+func (sw *segmentWriter) Close() error {
+	sw.mu.Lock()
+	if sw.timer != nil {
+		sw.timer.Stop()
+		sw.timer = nil
+	}
+	err := sw.flushLocked()
+	sw.mu.Unlock()
+	if cerr := sw.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
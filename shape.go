@@ -0,0 +1,348 @@
+package extraio
+
+import (
+	"math/rand/v2"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LinkProfile describes one direction of a simulated network link.
+type LinkProfile struct {
+	// One way delay added to every write.
+	Latency time.Duration
+	// Up to this much random extra delay, data is never reordered.
+	Jitter time.Duration
+	// Bytes per second, 0 is unlimited.
+	Bandwidth float64
+	// Probability in [0, 1] that a write is delayed by a retransmission
+	// timeout, as a TCP stream sees a lost packet.
+	Loss float64
+}
+
+// ShapeProfile describes both directions of a simulated link, Up is the
+// direction written by the ShapedConn and Down the one it reads.
+type ShapeProfile struct {
+	Up   LinkProfile
+	Down LinkProfile
+}
+
+var (
+	Shape3G = ShapeProfile{
+		Up:   LinkProfile{Latency: 100 * time.Millisecond, Jitter: 20 * time.Millisecond, Bandwidth: 96e3},
+		Down: LinkProfile{Latency: 100 * time.Millisecond, Jitter: 20 * time.Millisecond, Bandwidth: 200e3},
+	}
+	ShapeSatellite = ShapeProfile{
+		Up:   LinkProfile{Latency: 300 * time.Millisecond, Jitter: 10 * time.Millisecond, Bandwidth: 128e3},
+		Down: LinkProfile{Latency: 300 * time.Millisecond, Jitter: 10 * time.Millisecond, Bandwidth: 1.25e6},
+	}
+	ShapeLossyWiFi = ShapeProfile{
+		Up:   LinkProfile{Latency: 5 * time.Millisecond, Jitter: 15 * time.Millisecond, Bandwidth: 2.5e6, Loss: 0.02},
+		Down: LinkProfile{Latency: 5 * time.Millisecond, Jitter: 15 * time.Millisecond, Bandwidth: 2.5e6, Loss: 0.02},
+	}
+)
+
+// ShapePreset returns the preset named "3g", "satellite" or "lossy-wifi",
+// ignoring case.
+func ShapePreset(name string) (ShapeProfile, bool) {
+	switch strings.ToLower(name) {
+	case "3g":
+		return Shape3G, true
+	case "satellite":
+		return ShapeSatellite, true
+	case "lossy-wifi":
+		return ShapeLossyWiFi, true
+	default:
+		return ShapeProfile{}, false
+	}
+}
+
+// minRTO is the smallest retransmission delay simulated for a loss.
+const minRTO = 200 * time.Millisecond
+
+// shapedChunksMax bounds the chunks in flight each way, beyond it writes
+// block and inbound data is left in Conn, like full socket buffers.
+const shapedChunksMax = 64
+
+type shapedChunk struct {
+	data []byte
+	at   time.Time
+	err  error
+}
+
+// linkClock schedules chunks on one direction of a link.
+type linkClock struct {
+	free time.Time
+	last time.Time
+}
+
+// schedule returns when n bytes starting to send at now have been
+// serialized onto the link, and when they arrive at the far end.
+func (lc *linkClock) schedule(p *LinkProfile, rng func() float64, now time.Time, n int) (sent, arrive time.Time) {
+	sent = now
+	if lc.free.After(sent) {
+		sent = lc.free
+	}
+	if p.Bandwidth > 0 {
+		sent = sent.Add(time.Duration(float64(n) / p.Bandwidth * float64(time.Second)))
+	}
+	lc.free = sent
+	delay := p.Latency
+	if p.Jitter > 0 {
+		delay += time.Duration(rng() * float64(p.Jitter))
+	}
+	if p.Loss > 0 && rng() < p.Loss {
+		delay += max(minRTO, 2*p.Latency)
+	}
+	arrive = sent.Add(delay)
+	if arrive.Before(lc.last) {
+		arrive = lc.last
+	}
+	lc.last = arrive
+	return sent, arrive
+}
+
+// ShapedConn simulates a slow network between Conn and its peer, adding
+// latency, jitter, bandwidth caps and retransmission delays to each
+// direction per Profile. Writes block for their serialization time and
+// are then delivered in the background once they have crossed the link,
+// reads return data only after it would have arrived.
+type ShapedConn struct {
+	Conn    net.Conn
+	Profile ShapeProfile
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	wmu       sync.Mutex
+	up        linkClock
+	out       chan shapedChunk
+	outErr    error
+	delivered chan struct{}
+	// UnixNano arrival time of the last write.
+	lastArrival atomic.Int64
+
+	rmu      sync.Mutex
+	readOnce sync.Once
+	// only used by receive.
+	down      linkClock
+	in        chan shapedChunk
+	pending   *shapedChunk
+	closeOnce sync.Once
+	// closing is closed by Close, closed once in flight data is delivered
+	// or abandoned.
+	closing chan struct{}
+	closed  chan struct{}
+
+	readDeadline  deadline
+	writeDeadline deadline
+}
+
+// Accepts WithSeed.
+func NewShapedConn(c net.Conn, p ShapeProfile, opts ...Option) *ShapedConn {
+	o := applyOptions(opts, optSeed, "NewShapedConn")
+	sc := &ShapedConn{
+		Conn:      c,
+		Profile:   p,
+		rng:       o.rng(),
+		out:       make(chan shapedChunk, shapedChunksMax),
+		delivered: make(chan struct{}),
+		in:        make(chan shapedChunk, shapedChunksMax),
+		closing:   make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+	go sc.deliver()
+	return sc
+}
+
+func (sc *ShapedConn) random() float64 {
+	sc.rngMu.Lock()
+	defer sc.rngMu.Unlock()
+	return sc.rng.Float64()
+}
+
+// sleepUntil waits for t, returning false if done is closed first.
+func sleepUntil(t time.Time, done <-chan struct{}) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (sc *ShapedConn) Write(buf []byte) (int, error) {
+	sc.wmu.Lock()
+	defer sc.wmu.Unlock()
+	select {
+	case <-sc.closing:
+		return 0, net.ErrClosed
+	case <-sc.delivered:
+		return 0, sc.outErr
+	default:
+	}
+	if sc.writeDeadline.expired() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	saved := sc.up
+	sent, arrive := sc.up.schedule(&sc.Profile.Up, sc.random, time.Now(), len(buf))
+	if !sleepUntil(sent, sc.writeDeadline.wait()) {
+		sc.up = saved
+		return 0, os.ErrDeadlineExceeded
+	}
+	select {
+	case sc.out <- shapedChunk{data: append([]byte(nil), buf...), at: arrive}:
+	case <-sc.delivered:
+		return 0, sc.outErr
+	case <-sc.closing:
+		return 0, net.ErrClosed
+	case <-sc.writeDeadline.wait():
+		sc.up = saved
+		return 0, os.ErrDeadlineExceeded
+	}
+	sc.lastArrival.Store(arrive.UnixNano())
+	return len(buf), nil
+}
+
+// deliver writes chunks to Conn as they arrive, until a write fails or
+// Close is called and nothing is left in flight, then closes delivered.
+func (sc *ShapedConn) deliver() {
+	defer close(sc.delivered)
+	for {
+		var chunk shapedChunk
+		select {
+		case chunk = <-sc.out:
+		case <-sc.closing:
+			select {
+			case chunk = <-sc.out:
+			default:
+				return
+			}
+		}
+		if !sleepUntil(chunk.at, sc.closed) {
+			return
+		}
+		if _, err := sc.Conn.Write(chunk.data); err != nil {
+			sc.outErr = err
+			return
+		}
+	}
+}
+
+// receive reads Conn into chunks stamped with their arrival time.
+func (sc *ShapedConn) receive() {
+	for {
+		buf := make([]byte, 32*1024)
+		n, err := sc.Conn.Read(buf)
+		now := time.Now()
+		chunk := shapedChunk{at: now, err: err}
+		if n > 0 {
+			_, chunk.at = sc.down.schedule(&sc.Profile.Down, sc.random, now, n)
+			chunk.data = buf[:n]
+		}
+		select {
+		case sc.in <- chunk:
+		case <-sc.closing:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sc *ShapedConn) Read(buf []byte) (int, error) {
+	sc.readOnce.Do(func() { go sc.receive() })
+	sc.rmu.Lock()
+	defer sc.rmu.Unlock()
+	if sc.readDeadline.expired() {
+		return 0, os.ErrDeadlineExceeded
+	}
+	chunk := sc.pending
+	if chunk == nil {
+		select {
+		case c := <-sc.in:
+			chunk = &c
+			sc.pending = chunk
+		case <-sc.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		case <-sc.closing:
+			return 0, net.ErrClosed
+		}
+	}
+	if !sleepUntil(chunk.at, sc.readDeadline.wait()) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	n := copy(buf, chunk.data)
+	chunk.data = chunk.data[n:]
+	if len(chunk.data) > 0 {
+		return n, nil
+	}
+	// An error stays pending to be returned again, like Conn would.
+	if chunk.err == nil {
+		sc.pending = nil
+	}
+	return n, chunk.err
+}
+
+// shapeLinger is how long Close waits beyond the last write's arrival
+// for the peer to accept the data still in flight.
+const shapeLinger = time.Second
+
+// Close delivers data still crossing the link, so it reaches the peer
+// ahead of the close as a FIN would, then closes Conn. It waits at most
+// shapeLinger past the last write's arrival for the peer to take it.
+func (sc *ShapedConn) Close() error {
+	sc.closeOnce.Do(func() {
+		close(sc.closing)
+		linger := time.Until(time.Unix(0, sc.lastArrival.Load())) + shapeLinger
+		timer := time.NewTimer(linger)
+		select {
+		case <-sc.delivered:
+		case <-timer.C:
+		}
+		timer.Stop()
+		close(sc.closed)
+	})
+	return sc.Conn.Close()
+}
+
+func (sc *ShapedConn) LocalAddr() net.Addr {
+	return sc.Conn.LocalAddr()
+}
+
+func (sc *ShapedConn) RemoteAddr() net.Addr {
+	return sc.Conn.RemoteAddr()
+}
+
+// SetDeadline sets the deadlines seen by Read and Write, the background
+// delivery to Conn is not subject to them.
+func (sc *ShapedConn) SetDeadline(t time.Time) error {
+	sc.readDeadline.set(t)
+	sc.writeDeadline.set(t)
+	return nil
+}
+
+func (sc *ShapedConn) SetReadDeadline(t time.Time) error {
+	sc.readDeadline.set(t)
+	return nil
+}
+
+func (sc *ShapedConn) SetWriteDeadline(t time.Time) error {
+	sc.writeDeadline.set(t)
+	return nil
+}
+
+// NetConn returns the wrapped conn.
+func (sc *ShapedConn) NetConn() net.Conn {
+	return sc.Conn
+}
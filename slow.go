@@ -0,0 +1,92 @@
+package extraio
+
+import (
+	"net"
+	"time"
+)
+
+// SlowOp describes a single operation that took longer than a SlowConn's Threshold.
+type SlowOp struct {
+	Name     string
+	Peer     net.Addr
+	Op       Op
+	N        int
+	Duration time.Duration
+	Err      error
+}
+
+// SlowConn calls OnSlow whenever a single Read or Write takes longer than
+// Threshold. It only costs two time.Now calls per operation.
+type SlowConn struct {
+	Conn      net.Conn
+	Name      string
+	Threshold time.Duration
+	OnSlow    func(SlowOp)
+}
+
+// Accepts WithName.
+func NewSlowConn(c net.Conn, threshold time.Duration, onSlow func(SlowOp), opts ...Option) *SlowConn {
+	o := applyOptions(opts, optName, "NewSlowConn")
+	return &SlowConn{
+		Conn:      c,
+		Name:      o.name,
+		Threshold: threshold,
+		OnSlow:    onSlow,
+	}
+}
+
+func (sc *SlowConn) check(op Op, start time.Time, n int, err error) {
+	if d := time.Since(start); d > sc.Threshold {
+		sc.OnSlow(SlowOp{
+			Name:     sc.Name,
+			Peer:     sc.Conn.RemoteAddr(),
+			Op:       op,
+			N:        n,
+			Duration: d,
+			Err:      err,
+		})
+	}
+}
+
+func (sc *SlowConn) Read(buf []byte) (int, error) {
+	start := time.Now()
+	n, err := sc.Conn.Read(buf)
+	sc.check(OpRead, start, n, err)
+	return n, err
+}
+
+func (sc *SlowConn) Write(buf []byte) (int, error) {
+	start := time.Now()
+	n, err := sc.Conn.Write(buf)
+	sc.check(OpWrite, start, n, err)
+	return n, err
+}
+
+func (sc *SlowConn) Close() error {
+	return sc.Conn.Close()
+}
+
+func (sc *SlowConn) LocalAddr() net.Addr {
+	return sc.Conn.LocalAddr()
+}
+
+func (sc *SlowConn) RemoteAddr() net.Addr {
+	return sc.Conn.RemoteAddr()
+}
+
+func (sc *SlowConn) SetDeadline(t time.Time) error {
+	return sc.Conn.SetDeadline(t)
+}
+
+func (sc *SlowConn) SetReadDeadline(t time.Time) error {
+	return sc.Conn.SetReadDeadline(t)
+}
+
+func (sc *SlowConn) SetWriteDeadline(t time.Time) error {
+	return sc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (sc *SlowConn) NetConn() net.Conn {
+	return sc.Conn
+}
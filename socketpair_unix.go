@@ -0,0 +1,47 @@
+//go:build unix
+
+package extraio
+
+import (
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// SocketPairOS returns two connected unix domain sockets backed by real
+// descriptors, both are *net.UnixConn so File can be used to pass one
+// end to a child process.
+func SocketPairOS() (net.Conn, net.Conn, error) {
+	// Hold ForkLock so no child inherits the descriptors
+	// before they are marked close on exec.
+	syscall.ForkLock.RLock()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err == nil {
+		unix.CloseOnExec(fds[0])
+		unix.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, nil, os.NewSyscallError("socketpair", err)
+	}
+	a, err := fdConn(fds[0], "socketpair-a")
+	if err != nil {
+		unix.Close(fds[1])
+		return nil, nil, err
+	}
+	b, err := fdConn(fds[1], "socketpair-b")
+	if err != nil {
+		a.Close()
+		return nil, nil, err
+	}
+	return a, b, nil
+}
+
+// fdConn turns fd into a net.Conn, closing fd either way.
+func fdConn(fd int, name string) (net.Conn, error) {
+	f := os.NewFile(uintptr(fd), name)
+	defer f.Close()
+	return net.FileConn(f)
+}
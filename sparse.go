@@ -0,0 +1,164 @@
+package extraio
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// sparseBlock is the granularity at which CopySparse looks for zeros,
+// the usual filesystem block size.
+const sparseBlock = 4096
+
+// sparseCopier writes to dst, seeking over zero blocks instead of
+// writing them.
+type sparseCopier struct {
+	dst io.WriteSeeker
+	// Bytes of zeros not yet seeked over.
+	skip int64
+	// Bytes copied including holes.
+	n int64
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (sc *sparseCopier) write(p []byte) error {
+	for len(p) > 0 {
+		block := p[:min(len(p), sparseBlock)]
+		p = p[len(block):]
+		if isZero(block) {
+			sc.hole(int64(len(block)))
+			continue
+		}
+		if sc.skip > 0 {
+			if _, err := sc.dst.Seek(sc.skip, io.SeekCurrent); err != nil {
+				return err
+			}
+			sc.skip = 0
+		}
+		n, err := sc.dst.Write(block)
+		sc.n += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sc *sparseCopier) hole(n int64) {
+	sc.skip += n
+	sc.n += n
+}
+
+func (sc *sparseCopier) copyFrom(src io.Reader) error {
+	buf := getBuf()
+	defer putBuf(buf)
+	for {
+		n, err := src.Read(*buf)
+		if werr := sc.write((*buf)[:n]); werr != nil {
+			return werr
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// finish extends dst over a trailing hole, truncating it to length if
+// it has a Truncate method and otherwise writing a final zero byte.
+func (sc *sparseCopier) finish() error {
+	if sc.skip == 0 {
+		return nil
+	}
+	pos, err := sc.dst.Seek(sc.skip, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if t, ok := sc.dst.(interface{ Truncate(int64) error }); ok {
+		end, err := sc.dst.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if end < pos {
+			if err := t.Truncate(pos); err != nil {
+				return err
+			}
+		}
+		_, err = sc.dst.Seek(pos, io.SeekStart)
+		return err
+	}
+	if _, err := sc.dst.Seek(-1, io.SeekCurrent); err != nil {
+		return err
+	}
+	_, err = sc.dst.Write([]byte{0})
+	return err
+}
+
+// copyExtents copies only the data regions of f, reporting false if
+// the system cannot find them.
+func (sc *sparseCopier) copyExtents(f *os.File) (bool, error) {
+	off, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, nil
+	}
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return false, nil
+	}
+	end := fi.Size()
+	for first := true; off < end; first = false {
+		data, hole, err := dataExtent(f, off, end)
+		if err != nil {
+			if first && errors.Is(err, errors.ErrUnsupported) {
+				return false, nil
+			}
+			return true, err
+		}
+		sc.hole(data - off)
+		if data >= end {
+			break
+		}
+		if _, err := f.Seek(data, io.SeekStart); err != nil {
+			return true, err
+		}
+		if err := sc.copyFrom(io.LimitReader(f, hole-data)); err != nil {
+			return true, err
+		}
+		off = hole
+	}
+	_, err = f.Seek(end, io.SeekStart)
+	return true, err
+}
+
+// CopySparse copies src to dst until EOF like Copy, but seeks over
+// blocks of zeros in dst rather than writing them, so copies of disk
+// images and other sparse files stay sparse. When src is a file on a
+// system with SEEK_DATA its holes are skipped without being read.
+//
+// dst must read as zeros wherever it is skipped, for example a new or
+// truncated file. It returns the bytes copied, holes included.
+func CopySparse(dst io.WriteSeeker, src io.Reader) (int64, error) {
+	sc := &sparseCopier{dst: dst}
+	handled := false
+	var err error
+	if f, ok := src.(*os.File); ok {
+		handled, err = sc.copyExtents(f)
+	}
+	if !handled {
+		err = sc.copyFrom(src)
+	}
+	if err == nil {
+		err = sc.finish()
+	}
+	return sc.n, err
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package extraio
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// dataExtent returns the first region of data in f at or after off, using
+// SEEK_DATA and SEEK_HOLE, or end, end if only a hole remains before end.
+func dataExtent(f *os.File, off, end int64) (data, hole int64, err error) {
+	data, err = f.Seek(off, unix.SEEK_DATA)
+	if errors.Is(err, unix.ENXIO) {
+		return end, end, nil
+	}
+	if errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP) {
+		return 0, 0, errors.ErrUnsupported
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	hole, err = f.Seek(data, unix.SEEK_HOLE)
+	if err != nil {
+		return 0, 0, err
+	}
+	return data, min(hole, end), nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package extraio
+
+import (
+	"errors"
+	"os"
+)
+
+func dataExtent(f *os.File, off, end int64) (data, hole int64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
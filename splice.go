@@ -0,0 +1,46 @@
+package extraio
+
+import "io"
+
+// Splice copies src to dst until EOF in kernel where it can, with
+// sendfile(2) from regular files and splice(2) otherwise, when both ends
+// are files, pipes or sockets on Linux. Other streams fall back to Copy.
+// Metered wrappers on either end are looked through, with their counters
+// still updated as each chunk moves.
+func Splice(dst io.Writer, src io.Reader) (int64, CopyMethod, error) {
+	if n, handled, err := kernelCopy(dst, src); handled {
+		return n, CopyKernel, err
+	}
+	stats, err := Copy(dst, src)
+	return stats.Written, CopyUserspace, err
+}
+
+// kernelCopy is Splice's in kernel path, it reports false, having copied
+// nothing, if the streams beneath any metered wrappers do not support it.
+func kernelCopy(dst io.Writer, src io.Reader) (int64, bool, error) {
+	var counts []func(int64, error)
+	inner := src
+	for {
+		ms, ok := inner.(meteredSource)
+		if !ok {
+			break
+		}
+		counts = append(counts, ms.countRead)
+		inner = ms.innerReader()
+	}
+	innerDst := dst
+	for {
+		ms, ok := innerDst.(meteredSink)
+		if !ok {
+			break
+		}
+		counts = append(counts, ms.countWrite)
+		innerDst = ms.innerWriter()
+	}
+	count := func(n int64) {
+		for _, c := range counts {
+			c(n, nil)
+		}
+	}
+	return spliceFast(innerDst, inner, count)
+}
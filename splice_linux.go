@@ -0,0 +1,175 @@
+//go:build linux
+
+package extraio
+
+import (
+	"io"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxSpliceChunk is the most moved by one splice or sendfile call,
+// the default capacity of a pipe.
+const maxSpliceChunk = 64 * 1024
+
+func rawConn(x any) (syscall.RawConn, bool) {
+	sc, ok := x.(syscall.Conn)
+	if !ok {
+		return nil, false
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return nil, false
+	}
+	return rc, true
+}
+
+// spliceKind returns the file type bits of rc's fd, and whether splice
+// can use it: a socket, pipe or regular file not opened for appending.
+func spliceKind(rc syscall.RawConn, writing bool) (uint32, bool) {
+	var kind uint32
+	ok := false
+	rc.Control(func(fd uintptr) {
+		var st unix.Stat_t
+		if unix.Fstat(int(fd), &st) != nil {
+			return
+		}
+		kind = st.Mode & unix.S_IFMT
+		switch kind {
+		case unix.S_IFSOCK, unix.S_IFIFO:
+			ok = true
+		case unix.S_IFREG:
+			flags, err := unix.FcntlInt(fd, unix.F_GETFL, 0)
+			ok = err == nil && !(writing && flags&unix.O_APPEND != 0)
+		}
+	})
+	return kind, ok
+}
+
+// spliceFast copies src to dst in kernel, calling count after each chunk.
+// It reports false, having copied nothing, if the pair is unsupported.
+func spliceFast(dst io.Writer, src io.Reader, count func(int64)) (int64, bool, error) {
+	srcRC, ok := rawConn(src)
+	if !ok {
+		return 0, false, nil
+	}
+	dstRC, ok := rawConn(dst)
+	if !ok {
+		return 0, false, nil
+	}
+	srcKind, ok := spliceKind(srcRC, false)
+	if !ok {
+		return 0, false, nil
+	}
+	if _, ok := spliceKind(dstRC, true); !ok {
+		return 0, false, nil
+	}
+	if srcKind == unix.S_IFREG {
+		if n, handled, err := sendfile(dstRC, srcRC, count); handled {
+			return n, true, err
+		}
+	}
+	return spliceViaPipe(dstRC, srcRC, count)
+}
+
+func sendfile(dst, src syscall.RawConn, count func(int64)) (int64, bool, error) {
+	var (
+		written int64
+		err     error
+	)
+	ctlErr := src.Control(func(sfd uintptr) {
+		for {
+			var n int
+			var serr error
+			werr := dst.Write(func(dfd uintptr) bool {
+				n, serr = unix.Sendfile(int(dfd), int(sfd), nil, maxSpliceChunk)
+				return serr != unix.EAGAIN && serr != unix.EINTR
+			})
+			if werr != nil {
+				err = werr
+				return
+			}
+			if serr != nil {
+				err = os.NewSyscallError("sendfile", serr)
+				return
+			}
+			if n == 0 {
+				return
+			}
+			written += int64(n)
+			count(int64(n))
+		}
+	})
+	if ctlErr != nil {
+		return 0, false, nil
+	}
+	if written == 0 && isUnsupportedSplice(err) {
+		return 0, false, nil
+	}
+	return written, true, err
+}
+
+func isUnsupportedSplice(err error) bool {
+	if se, ok := err.(*os.SyscallError); ok {
+		err = se.Err
+	}
+	return err == unix.EINVAL || err == unix.ENOSYS || err == unix.EOPNOTSUPP
+}
+
+// spliceViaPipe moves data from src into a pipe and from the pipe to dst,
+// as splice needs a pipe on one side, waiting on each end with its own
+// poller as the standard library does for TCP.
+func spliceViaPipe(dst, src syscall.RawConn, count func(int64)) (int64, bool, error) {
+	var p [2]int
+	if err := unix.Pipe2(p[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		return 0, false, nil
+	}
+	defer unix.Close(p[0])
+	defer unix.Close(p[1])
+
+	const flags = unix.SPLICE_F_MOVE | unix.SPLICE_F_NONBLOCK
+	var written int64
+	for {
+		var (
+			inPipe int64
+			serr   error
+		)
+		rerr := src.Read(func(sfd uintptr) bool {
+			// Splice returns an int on 32 bit platforms.
+			n, err := unix.Splice(int(sfd), nil, p[1], nil, maxSpliceChunk, flags)
+			inPipe, serr = int64(n), err
+			return serr != unix.EAGAIN && serr != unix.EINTR
+		})
+		if rerr == nil && serr != nil {
+			rerr = os.NewSyscallError("splice", serr)
+		}
+		if rerr != nil {
+			if written == 0 && isUnsupportedSplice(rerr) {
+				return 0, false, nil
+			}
+			return written, true, rerr
+		}
+		if inPipe == 0 {
+			return written, true, nil
+		}
+		for inPipe > 0 {
+			var n int64
+			werr := dst.Write(func(dfd uintptr) bool {
+				m, err := unix.Splice(p[0], nil, int(dfd), nil, int(inPipe), flags)
+				n, serr = int64(m), err
+				return serr != unix.EAGAIN && serr != unix.EINTR
+			})
+			if werr == nil && serr != nil {
+				werr = os.NewSyscallError("splice", serr)
+			}
+			if werr != nil {
+				return written, true, werr
+			}
+			inPipe -= n
+			written += n
+			count(n)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package extraio
+
+import "io"
+
+func spliceFast(dst io.Writer, src io.Reader, count func(int64)) (int64, bool, error) {
+	return 0, false, nil
+}
@@ -0,0 +1,64 @@
+package extraio
+
+import (
+	"fmt"
+	"io"
+)
+
+// StreamError annotates an error with the stream it happened on and
+// how far into the stream it was.
+type StreamError struct {
+	Name   string
+	Op     Op
+	Offset int64
+	Err    error
+}
+
+func (e *StreamError) Error() string {
+	return fmt.Sprintf("extraio: %s %s at offset %d: %s", e.Name, e.Op, e.Offset, e.Err)
+}
+
+func (e *StreamError) Unwrap() error {
+	return e.Err
+}
+
+// NamedReader wraps errors from R in a *StreamError,
+// io.EOF is returned as is so callers can still compare against it.
+type NamedReader struct {
+	R      io.Reader
+	Name   string
+	Offset int64
+}
+
+func NewNamedReader(r io.Reader, name string) *NamedReader {
+	return &NamedReader{R: r, Name: name}
+}
+
+func (nr *NamedReader) Read(buf []byte) (int, error) {
+	n, err := nr.R.Read(buf)
+	nr.Offset += int64(n)
+	if err != nil && err != io.EOF {
+		err = &StreamError{Name: nr.Name, Op: OpRead, Offset: nr.Offset, Err: err}
+	}
+	return n, err
+}
+
+// NamedWriter wraps errors from W in a *StreamError.
+type NamedWriter struct {
+	W      io.Writer
+	Name   string
+	Offset int64
+}
+
+func NewNamedWriter(w io.Writer, name string) *NamedWriter {
+	return &NamedWriter{W: w, Name: name}
+}
+
+func (nw *NamedWriter) Write(buf []byte) (int, error) {
+	n, err := nw.W.Write(buf)
+	nw.Offset += int64(n)
+	if err != nil {
+		err = &StreamError{Name: nw.Name, Op: OpWrite, Offset: nw.Offset, Err: err}
+	}
+	return n, err
+}
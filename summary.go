@@ -0,0 +1,88 @@
+package extraio
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Summary describes a finished or ongoing transfer for reporting,
+// it prints as a compact line and logs as a structured group.
+type Summary struct {
+	Name       string
+	ReadBytes  int64
+	WriteBytes int64
+	Duration   time.Duration
+	// Average bytes per second over Duration.
+	ReadRate  float64
+	WriteRate float64
+	Err       error
+}
+
+// Summarize computes a Summary of s accumulated over d.
+func Summarize(name string, s Stats, d time.Duration, err error) Summary {
+	sum := Summary{
+		Name:       name,
+		ReadBytes:  s.ReadCount,
+		WriteBytes: s.WriteCount,
+		Duration:   d,
+		Err:        err,
+	}
+	if secs := d.Seconds(); secs > 0 {
+		sum.ReadRate = float64(s.ReadCount) / secs
+		sum.WriteRate = float64(s.WriteCount) / secs
+	}
+	return sum
+}
+
+// String formats s like
+// "name: read 1.5MiB (512.0KiB/s) wrote 20B (7B/s) in 3s: error".
+func (s Summary) String() string {
+	var b strings.Builder
+	if s.Name != "" {
+		b.WriteString(s.Name)
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "read %s (%s/s) wrote %s (%s/s) in %s",
+		FormatBytes(float64(s.ReadBytes)), FormatBytes(s.ReadRate),
+		FormatBytes(float64(s.WriteBytes)), FormatBytes(s.WriteRate),
+		s.Duration.Round(time.Millisecond))
+	if s.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(s.Err.Error())
+	}
+	return b.String()
+}
+
+// LogValue implements slog.LogValuer.
+func (s Summary) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Int64("read_bytes", s.ReadBytes),
+		slog.Int64("write_bytes", s.WriteBytes),
+		slog.Duration("duration", s.Duration),
+		slog.Float64("read_rate", s.ReadRate),
+		slog.Float64("write_rate", s.WriteRate),
+	}
+	if s.Name != "" {
+		attrs = append([]slog.Attr{slog.String("stream", s.Name)}, attrs...)
+	}
+	if s.Err != nil {
+		attrs = append(attrs, slog.String("error", s.Err.Error()))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// FormatBytes formats n with a binary unit, e.g. "1.5MiB".
+func FormatBytes(n float64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%.0fB", n)
+	}
+	i := -1
+	for n >= 1024 && i < len(units)-1 {
+		n /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f%ciB", n, units[i])
+}
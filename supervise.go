@@ -0,0 +1,178 @@
+package extraio
+
+import (
+	"errors"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRestartsExhausted = errors.New("extraio: command restarted too many times")
+	errSupervisedClosed  = errors.New("extraio: supervised command closed")
+)
+
+// SupervisedCmd is a CmdStream that restarts its command whenever it
+// exits or its stdout hits EOF, so it can be used as a long lived filter.
+// Data written to a command that then crashes is lost, a write failing
+// because the command went away is retried on the new command.
+type SupervisedCmd struct {
+	// Makes a fresh command for each start.
+	NewCmd func() *exec.Cmd
+	// Delays between restarts, MaxRetries limits the total number of restarts.
+	Backoff Backoff
+
+	opts     []Option
+	mu       sync.Mutex
+	cur      *CmdStream
+	restarts int
+	err      error
+	closed   bool
+	// Closed by Close, ends a restart's wait.
+	closing chan struct{}
+	// Set while a restart runs without mu held, closed when it ends.
+	restarting chan struct{}
+}
+
+// NewSupervisedCmd starts the first command. Accepts WithBackoff
+// and the options of StartCmdReadWriteCloser.
+func NewSupervisedCmd(newCmd func() *exec.Cmd, opts ...Option) (*SupervisedCmd, error) {
+	o := applyOptions(opts, optBackoff|optCmd, "NewSupervisedCmd")
+	opts = filterOptions(opts, optCmd)
+	sc := &SupervisedCmd{NewCmd: newCmd, opts: opts, closing: make(chan struct{})}
+	if o.backoff != nil {
+		sc.Backoff = *o.backoff
+	}
+	cur, err := StartCmdReadWriteCloser(newCmd(), opts...)
+	if err != nil {
+		return nil, err
+	}
+	sc.cur = cur
+	return sc, nil
+}
+
+func (sc *SupervisedCmd) current() (*CmdStream, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.cur, sc.err
+}
+
+// restart replaces failed with a new command unless that already happened,
+// waiting for a restart already under way. mu is not held while the
+// failed command is closed or between attempts, so Close can end them.
+func (sc *SupervisedCmd) restart(failed *CmdStream) (*CmdStream, error) {
+	sc.mu.Lock()
+	for sc.restarting != nil {
+		wait := sc.restarting
+		sc.mu.Unlock()
+		<-wait
+		sc.mu.Lock()
+	}
+	if sc.cur != failed || sc.err != nil {
+		defer sc.mu.Unlock()
+		return sc.cur, sc.err
+	}
+	done := make(chan struct{})
+	sc.restarting = done
+	sc.mu.Unlock()
+
+	cur, err := sc.start(failed)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.restarting = nil
+	close(done)
+	if sc.err != nil {
+		// Closed meanwhile.
+		if cur != nil {
+			cur.Close()
+		}
+		return nil, sc.err
+	}
+	if err != nil {
+		sc.err = err
+		return nil, err
+	}
+	sc.cur = cur
+	return cur, nil
+}
+
+// start closes failed and starts a new command per Backoff.
+func (sc *SupervisedCmd) start(failed *CmdStream) (*CmdStream, error) {
+	_ = failed.Close()
+	for {
+		sc.mu.Lock()
+		restarts := sc.restarts
+		sc.mu.Unlock()
+		if sc.Backoff.Exhausted(restarts) {
+			return nil, ErrRestartsExhausted
+		}
+		t := time.NewTimer(sc.Backoff.Delay(restarts))
+		select {
+		case <-t.C:
+		case <-sc.closing:
+			t.Stop()
+			return nil, errSupervisedClosed
+		}
+		sc.mu.Lock()
+		sc.restarts++
+		sc.mu.Unlock()
+		cur, err := StartCmdReadWriteCloser(sc.NewCmd(), sc.opts...)
+		if err == nil {
+			return cur, nil
+		}
+	}
+}
+
+func (sc *SupervisedCmd) Read(buf []byte) (int, error) {
+	cur, err := sc.current()
+	for err == nil {
+		var n int
+		n, err = cur.Read(buf)
+		if n > 0 || err == nil {
+			return n, nil
+		}
+		cur, err = sc.restart(cur)
+	}
+	return 0, err
+}
+
+func (sc *SupervisedCmd) Write(buf []byte) (int, error) {
+	written := 0
+	cur, err := sc.current()
+	for err == nil {
+		var n int
+		n, err = cur.Write(buf[written:])
+		written += n
+		if err == nil {
+			return written, nil
+		}
+		cur, err = sc.restart(cur)
+	}
+	return written, err
+}
+
+// Restarts returns how many times the command has been restarted.
+func (sc *SupervisedCmd) Restarts() int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.restarts
+}
+
+// Close stops supervising and closes the current command,
+// returning its Wait error.
+func (sc *SupervisedCmd) Close() error {
+	sc.mu.Lock()
+	if sc.closed {
+		sc.mu.Unlock()
+		return nil
+	}
+	sc.closed = true
+	close(sc.closing)
+	cur := sc.cur
+	if sc.err == nil {
+		sc.err = errSupervisedClosed
+	}
+	sc.mu.Unlock()
+	return cur.Close()
+}
@@ -0,0 +1,62 @@
+package extraio
+
+import (
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestSupervisedCmdRestarts(t *testing.T) {
+	sc, err := NewSupervisedCmd(func() *exec.Cmd { return exec.Command("echo", "hi") },
+		WithBackoff(Backoff{Initial: time.Millisecond}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(sc, buf); err != nil || string(buf) != "hi\nhi\nhi\n" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+	if n := sc.Restarts(); n < 2 {
+		t.Fatalf("%d restarts, want at least 2", n)
+	}
+}
+
+func TestSupervisedCmdExhausted(t *testing.T) {
+	sc, err := NewSupervisedCmd(func() *exec.Cmd { return exec.Command("true") },
+		WithBackoff(Backoff{Initial: time.Millisecond, MaxRetries: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	if _, err := sc.Read(make([]byte, 1)); err != ErrRestartsExhausted {
+		t.Fatalf("read: %v, want ErrRestartsExhausted", err)
+	}
+	if n := sc.Restarts(); n != 2 {
+		t.Fatalf("%d restarts, want 2", n)
+	}
+}
+
+func TestSupervisedCmdCloseDuringBackoff(t *testing.T) {
+	sc, err := NewSupervisedCmd(func() *exec.Cmd { return exec.Command("true") },
+		WithBackoff(Backoff{Initial: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		_, err := sc.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	sc.Close()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("read succeeded after Close")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not end the wait between restarts")
+	}
+}
@@ -0,0 +1,33 @@
+package extraio
+
+import (
+	"io"
+	"sync"
+)
+
+// SyncWriter serializes writes to W so it can be shared between
+// goroutines, for example a PrefixSuffixSaver given as both cmd.Stdout
+// and cmd.Stderr behind separate wrappers, which exec.Cmd copies to from
+// two goroutines.
+type SyncWriter struct {
+	W  io.Writer
+	mu sync.Mutex
+}
+
+func NewSyncWriter(w io.Writer) *SyncWriter {
+	return &SyncWriter{W: w}
+}
+
+func (sw *SyncWriter) Write(buf []byte) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.W.Write(buf)
+}
+
+// Do calls fn with writes held off, so W can be inspected while others
+// may still be writing, e.g. to call Bytes on a PrefixSuffixSaver.
+func (sw *SyncWriter) Do(fn func()) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	fn()
+}
@@ -0,0 +1,52 @@
+package extraio
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// TCPStats is a snapshot of the kernel's view of a TCP connection.
+type TCPStats struct {
+	RTT    time.Duration
+	RTTVar time.Duration
+	MinRTT time.Duration
+	// Segments retransmitted over the life of the connection.
+	Retransmits uint32
+	// Segments currently considered lost.
+	Lost uint32
+	// Congestion window and slow start threshold, in segments.
+	Cwnd     uint32
+	SSThresh uint32
+	MSS      uint32
+	// Bytes written but not yet sent.
+	NotSent       uint32
+	BytesAcked    uint64
+	BytesReceived uint64
+}
+
+// TCPInfo returns kernel statistics for the TCP connection underlying c,
+// looking through wrappers with a NetConn method. It is only supported
+// on Linux, elsewhere it returns errors.ErrUnsupported.
+func TCPInfo(c net.Conn) (TCPStats, error) {
+	for {
+		if sc, ok := c.(syscall.Conn); ok {
+			// Wrappers may only pass SyscallConn through when they can.
+			if _, err := sc.SyscallConn(); err == nil {
+				return tcpInfo(sc)
+			}
+		}
+		u, ok := c.(interface{ NetConn() net.Conn })
+		if !ok {
+			return TCPStats{}, errors.New("extraio: not a socket")
+		}
+		c = u.NetConn()
+	}
+}
+
+// TCPStats returns kernel statistics for the underlying TCP connection,
+// to be compared with the byte counts from Stats.
+func (mConn *MeteredConn) TCPStats() (TCPStats, error) {
+	return TCPInfo(mConn.Conn)
+}
@@ -0,0 +1,40 @@
+package extraio
+
+import (
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func tcpInfo(sc syscall.Conn) (TCPStats, error) {
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return TCPStats{}, err
+	}
+	var info *unix.TCPInfo
+	var serr error
+	err = rc.Control(func(fd uintptr) {
+		info, serr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil {
+		return TCPStats{}, err
+	}
+	if serr != nil {
+		return TCPStats{}, serr
+	}
+	us := time.Microsecond
+	return TCPStats{
+		RTT:           time.Duration(info.Rtt) * us,
+		RTTVar:        time.Duration(info.Rttvar) * us,
+		MinRTT:        time.Duration(info.Min_rtt) * us,
+		Retransmits:   info.Total_retrans,
+		Lost:          info.Lost,
+		Cwnd:          info.Snd_cwnd,
+		SSThresh:      info.Snd_ssthresh,
+		MSS:           info.Snd_mss,
+		NotSent:       info.Notsent_bytes,
+		BytesAcked:    info.Bytes_acked,
+		BytesReceived: info.Bytes_received,
+	}, nil
+}
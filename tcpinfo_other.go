@@ -0,0 +1,12 @@
+//go:build !linux
+
+package extraio
+
+import (
+	"errors"
+	"syscall"
+)
+
+func tcpInfo(sc syscall.Conn) (TCPStats, error) {
+	return TCPStats{}, errors.ErrUnsupported
+}
@@ -0,0 +1,217 @@
+package extraio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("extraio: temp store quota exceeded")
+
+const defaultTempPrefix = "extraio-"
+
+// TempStore hands out temporary files for spilling data to disk, with the
+// total size of all its live files limited to Quota. Files are named with
+// Prefix and the creating process id so Cleanup can find ones left behind
+// by earlier processes. It is safe for concurrent use.
+type TempStore struct {
+	// Defaults to os.TempDir().
+	Dir string
+	// Defaults to "extraio-".
+	Prefix string
+	// Total bytes allowed across live files, <= 0 means no limit.
+	Quota int64
+
+	used int64
+}
+
+func NewTempStore(dir string, quota int64) *TempStore {
+	return &TempStore{Dir: dir, Quota: quota}
+}
+
+func (ts *TempStore) dir() string {
+	if ts.Dir == "" {
+		return os.TempDir()
+	}
+	return ts.Dir
+}
+
+func (ts *TempStore) prefix() string {
+	if ts.Prefix == "" {
+		return defaultTempPrefix
+	}
+	return ts.Prefix
+}
+
+// Used returns the bytes currently held by live files.
+func (ts *TempStore) Used() int64 {
+	return atomic.LoadInt64(&ts.used)
+}
+
+func (ts *TempStore) reserve(n int64) error {
+	for {
+		used := atomic.LoadInt64(&ts.used)
+		if ts.Quota > 0 && used+n > ts.Quota {
+			return ErrQuotaExceeded
+		}
+		if atomic.CompareAndSwapInt64(&ts.used, used, used+n) {
+			return nil
+		}
+	}
+}
+
+func (ts *TempStore) release(n int64) {
+	atomic.AddInt64(&ts.used, -n)
+}
+
+// Create makes a new empty temporary file, it is deleted on Close.
+func (ts *TempStore) Create() (*TempFile, error) {
+	pattern := ts.prefix() + strconv.Itoa(os.Getpid()) + "-*"
+	f, err := os.CreateTemp(ts.dir(), pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &TempFile{f: f, store: ts}, nil
+}
+
+// Cleanup removes files matching Prefix that were made by other processes
+// and not modified for olderThan, returning how many were removed.
+// Call it on startup to recover space from processes that crashed.
+func (ts *TempStore) Cleanup(olderThan time.Duration) (int, error) {
+	prefix := ts.prefix()
+	entries, err := os.ReadDir(ts.dir())
+	if err != nil {
+		return 0, err
+	}
+	self := strconv.Itoa(os.Getpid())
+	removed := 0
+	var errs []error
+	for _, e := range entries {
+		name := e.Name()
+		if !e.Type().IsRegular() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		pid, _, ok := strings.Cut(name[len(prefix):], "-")
+		if !ok || pid == self {
+			continue
+		}
+		if _, err := strconv.Atoi(pid); err != nil {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < olderThan {
+			continue
+		}
+		if err := os.Remove(filepath.Join(ts.dir(), name)); err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		removed++
+	}
+	return removed, errors.Join(errs...)
+}
+
+// TempFile is a file from a TempStore, writes that would grow it past the
+// store's quota fail with ErrQuotaExceeded. It is not safe for concurrent use.
+type TempFile struct {
+	f     *os.File
+	store *TempStore
+	off   int64
+	size  int64
+	guard misuseGuard
+}
+
+// Name returns the path of the file.
+func (tf *TempFile) Name() string {
+	return tf.f.Name()
+}
+
+// Size returns the current size of the file.
+func (tf *TempFile) Size() int64 {
+	return tf.size
+}
+
+func (tf *TempFile) Read(buf []byte) (int, error) {
+	tf.guard.enter("TempFile use")
+	defer tf.guard.exit()
+	n, err := tf.ReadAt(buf, tf.off)
+	tf.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (tf *TempFile) ReadAt(buf []byte, off int64) (int, error) {
+	return tf.f.ReadAt(buf, off)
+}
+
+func (tf *TempFile) Write(buf []byte) (int, error) {
+	tf.guard.enter("TempFile use")
+	defer tf.guard.exit()
+	n, err := tf.WriteAt(buf, tf.off)
+	tf.off += int64(n)
+	return n, err
+}
+
+func (tf *TempFile) WriteAt(buf []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("extraio: negative offset")
+	}
+	end := off + int64(len(buf))
+	grow := end - tf.size
+	if grow <= 0 {
+		return tf.f.WriteAt(buf, off)
+	}
+	// Reserve first so concurrent stores cannot overshoot the quota,
+	// then give back whatever a failed write did not use.
+	if err := tf.store.reserve(grow); err != nil {
+		return 0, err
+	}
+	n, err := tf.f.WriteAt(buf, off)
+	if written := off + int64(n); written < end {
+		tf.store.release(end - max(written, tf.size))
+		end = max(written, tf.size)
+	}
+	tf.size = end
+	return n, err
+}
+
+func (tf *TempFile) Seek(offset int64, whence int) (int64, error) {
+	tf.guard.enter("TempFile use")
+	defer tf.guard.exit()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += tf.off
+	case io.SeekEnd:
+		offset += tf.size
+	default:
+		return tf.off, errors.New("extraio: invalid whence")
+	}
+	if offset < 0 {
+		return tf.off, errors.New("extraio: negative offset")
+	}
+	tf.off = offset
+	return offset, nil
+}
+
+// Close closes and removes the file, returning its space to the store.
+func (tf *TempFile) Close() error {
+	tf.guard.enter("TempFile use")
+	defer tf.guard.exit()
+	err := tf.f.Close()
+	if rerr := os.Remove(tf.f.Name()); err == nil {
+		err = rerr
+	}
+	tf.store.release(tf.size)
+	tf.size = 0
+	return err
+}
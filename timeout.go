@@ -0,0 +1,51 @@
+package extraio
+
+import (
+	"io"
+	"time"
+)
+
+// TimeoutReader fails any single Read taking longer than Timeout with
+// os.ErrDeadlineExceeded, for sources without deadline support such as
+// pipes and command stdio. The read continues on a background goroutine
+// and its data is returned by the next Read, so nothing is lost.
+type TimeoutReader struct {
+	R io.Reader
+	// <= 0 disables the timeout.
+	Timeout time.Duration
+
+	ar asyncReader
+	dl deadline
+}
+
+// NewTimeoutReader must be used to create a TimeoutReader.
+func NewTimeoutReader(r io.Reader, timeout time.Duration) *TimeoutReader {
+	return &TimeoutReader{R: r, Timeout: timeout, ar: asyncReader{r: r}}
+}
+
+func (tr *TimeoutReader) Read(buf []byte) (int, error) {
+	tr.dl.arm(tr.Timeout)
+	return tr.ar.read(buf, &tr.dl, nil)
+}
+
+// TimeoutWriter fails any single Write taking longer than Timeout with
+// os.ErrDeadlineExceeded. The write may still complete in the background,
+// the next Write waits for it first and returns its error, if any.
+type TimeoutWriter struct {
+	W io.Writer
+	// <= 0 disables the timeout.
+	Timeout time.Duration
+
+	aw asyncWriter
+	dl deadline
+}
+
+// NewTimeoutWriter must be used to create a TimeoutWriter.
+func NewTimeoutWriter(w io.Writer, timeout time.Duration) *TimeoutWriter {
+	return &TimeoutWriter{W: w, Timeout: timeout, aw: asyncWriter{w: w}}
+}
+
+func (tw *TimeoutWriter) Write(buf []byte) (int, error) {
+	tw.dl.arm(tw.Timeout)
+	return tw.aw.write(buf, &tw.dl, nil)
+}
@@ -0,0 +1,92 @@
+package extraio
+
+import (
+	"context"
+	"net"
+	"runtime/pprof"
+	"runtime/trace"
+	"time"
+)
+
+// TracedConn runs each blocking Read and Write inside a runtime/trace
+// region and with pprof labels naming the stream and its peer, so
+// execution traces and profiles attribute IO time per connection.
+//
+// pprof has no way to read a goroutine's labels back, so each operation
+// sets the labels of the context given with WithContext plus the stream's
+// own, and leaves the goroutine with the given context's labels after it.
+// Without WithContext the goroutine is left with no labels. Goroutines
+// labelled with pprof.Do should pass the context it gives them.
+type TracedConn struct {
+	Conn net.Conn
+	// parent's labels are restored after each operation, ctx adds the
+	// stream's, both built once so operations do not allocate.
+	parent context.Context
+	ctx    context.Context
+}
+
+// Accepts WithContext, only its labels are used.
+func NewTracedConn(c net.Conn, name string, opts ...Option) *TracedConn {
+	o := applyOptions(opts, optContext, "NewTracedConn")
+	parent := o.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	peer := ""
+	if addr := c.RemoteAddr(); addr != nil {
+		peer = addr.String()
+	}
+	labels := pprof.Labels("extraio.stream", name, "extraio.peer", peer)
+	return &TracedConn{
+		Conn:   c,
+		parent: parent,
+		ctx:    pprof.WithLabels(parent, labels),
+	}
+}
+
+func (tc *TracedConn) Read(buf []byte) (int, error) {
+	pprof.SetGoroutineLabels(tc.ctx)
+	r := trace.StartRegion(tc.ctx, "extraio.Read")
+	n, err := tc.Conn.Read(buf)
+	r.End()
+	pprof.SetGoroutineLabels(tc.parent)
+	return n, err
+}
+
+func (tc *TracedConn) Write(buf []byte) (int, error) {
+	pprof.SetGoroutineLabels(tc.ctx)
+	r := trace.StartRegion(tc.ctx, "extraio.Write")
+	n, err := tc.Conn.Write(buf)
+	r.End()
+	pprof.SetGoroutineLabels(tc.parent)
+	return n, err
+}
+
+func (tc *TracedConn) Close() error {
+	return tc.Conn.Close()
+}
+
+func (tc *TracedConn) LocalAddr() net.Addr {
+	return tc.Conn.LocalAddr()
+}
+
+func (tc *TracedConn) RemoteAddr() net.Addr {
+	return tc.Conn.RemoteAddr()
+}
+
+func (tc *TracedConn) SetDeadline(t time.Time) error {
+	return tc.Conn.SetDeadline(t)
+}
+
+func (tc *TracedConn) SetReadDeadline(t time.Time) error {
+	return tc.Conn.SetReadDeadline(t)
+}
+
+func (tc *TracedConn) SetWriteDeadline(t time.Time) error {
+	return tc.Conn.SetWriteDeadline(t)
+}
+
+// NetConn returns the wrapped conn.
+func (tc *TracedConn) NetConn() net.Conn {
+	return tc.Conn
+}
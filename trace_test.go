@@ -0,0 +1,74 @@
+package extraio
+
+import (
+	"context"
+	"net"
+	"runtime/pprof"
+	"testing"
+)
+
+// nopConn is a net.Conn whose reads and writes succeed immediately.
+type nopConn struct {
+	net.Conn
+}
+
+func (nopConn) Read(buf []byte) (int, error)  { return len(buf), nil }
+func (nopConn) Write(buf []byte) (int, error) { return len(buf), nil }
+func (nopConn) RemoteAddr() net.Addr          { return memAddr("peer") }
+
+func TestTracedConnKeepsCallerLabels(t *testing.T) {
+	pprof.Do(context.Background(), pprof.Labels("caller", "yes"), func(ctx context.Context) {
+		tc := NewTracedConn(nopConn{}, "test", WithContext(ctx))
+		if v, _ := pprof.Label(tc.ctx, "caller"); v != "yes" {
+			t.Fatalf("caller label %q during operations", v)
+		}
+		if v, _ := pprof.Label(tc.ctx, "extraio.stream"); v != "test" {
+			t.Fatalf("stream label %q", v)
+		}
+		if tc.parent != ctx {
+			t.Fatal("caller's context not restored after operations")
+		}
+		tc.Read(make([]byte, 1))
+		tc.Write(make([]byte, 1))
+	})
+}
+
+func BenchmarkTracedConnRead(b *testing.B) {
+	tc := NewTracedConn(nopConn{}, "bench")
+	buf := make([]byte, 32*1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	for b.Loop() {
+		tc.Read(buf)
+	}
+}
+
+func BenchmarkTracedConnWrite(b *testing.B) {
+	tc := NewTracedConn(nopConn{}, "bench")
+	buf := make([]byte, 32*1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	for b.Loop() {
+		tc.Write(buf)
+	}
+}
+
+func BenchmarkMeteredConnRead(b *testing.B) {
+	mc := NewMeteredConn(nopConn{})
+	buf := make([]byte, 32*1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	for b.Loop() {
+		mc.Read(buf)
+	}
+}
+
+func BenchmarkMeteredConnWrite(b *testing.B) {
+	mc := NewMeteredConn(nopConn{})
+	buf := make([]byte, 32*1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(buf)))
+	for b.Loop() {
+		mc.Write(buf)
+	}
+}
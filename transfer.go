@@ -0,0 +1,165 @@
+package extraio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Framing used by Send and Receive:
+//
+//	header: "XIOT" version(1) size(uint64, MaxUint64 if unknown)
+//	chunk:  length(uint32) data crc32c(data)
+//	end:    length 0, crc32c of all data
+//
+// All integers are big endian.
+
+var transferMagic = []byte("XIOT")
+
+const (
+	transferVersion   = 1
+	transferChunkSize = 64 * 1024
+	transferUnknown   = math.MaxUint64
+)
+
+var ErrBadTransfer = errors.New("extraio: malformed transfer stream")
+
+// ChecksumError reports a corrupt block, Offset is the stream
+// offset of the start of that block, or 0 if the whole stream
+// checksum failed.
+type ChecksumError struct {
+	Offset int64
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("extraio: checksum mismatch in block at offset %d", e.Offset)
+}
+
+// Send writes size bytes from r to w framed with a header, per chunk
+// checksums and a trailer, to be read by Receive. A negative size sends
+// until r reaches EOF. It accepts WithProgress.
+func Send(w io.Writer, r io.Reader, size int64, opts ...Option) (int64, error) {
+	o := applyOptions(opts, optProgress, "Send")
+	var hdr [13]byte
+	copy(hdr[:], transferMagic)
+	hdr[4] = transferVersion
+	if size < 0 {
+		binary.BigEndian.PutUint64(hdr[5:], transferUnknown)
+	} else {
+		binary.BigEndian.PutUint64(hdr[5:], uint64(size))
+		r = io.LimitReader(r, size)
+	}
+	if _, err := w.Write(hdr[:]); err != nil {
+		return 0, err
+	}
+
+	progress := newProgressReporter(o.progress, o.progressInterval, size)
+	buf := make([]byte, 4+transferChunkSize+4)
+	var sent int64
+	var sum uint32
+	for {
+		n, rerr := io.ReadFull(r, buf[4:4+transferChunkSize])
+		if n > 0 {
+			data := buf[4 : 4+n]
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			binary.BigEndian.PutUint32(buf[4+n:], crc32.Checksum(data, castagnoli))
+			if _, err := w.Write(buf[:4+n+4]); err != nil {
+				return sent, err
+			}
+			sum = crc32.Update(sum, castagnoli, data)
+			sent += int64(n)
+			progress.update(sent)
+		}
+		if rerr == io.EOF || rerr == io.ErrUnexpectedEOF {
+			break
+		}
+		if rerr != nil {
+			return sent, rerr
+		}
+	}
+	if size >= 0 && sent != size {
+		return sent, io.ErrUnexpectedEOF
+	}
+	var trailer [8]byte
+	binary.BigEndian.PutUint32(trailer[4:], sum)
+	if _, err := w.Write(trailer[:]); err != nil {
+		return sent, err
+	}
+	progress.finish(sent)
+	return sent, nil
+}
+
+// Receive reads a stream written by Send, verifying it as it goes,
+// and writes the payload to w. It accepts WithProgress.
+func Receive(r io.Reader, w io.Writer, opts ...Option) (int64, error) {
+	o := applyOptions(opts, optProgress, "Receive")
+	var hdr [13]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(hdr[:4], transferMagic) || hdr[4] != transferVersion {
+		return 0, ErrBadTransfer
+	}
+	size := int64(-1)
+	if s := binary.BigEndian.Uint64(hdr[5:]); s != transferUnknown {
+		if s > math.MaxInt64 {
+			return 0, ErrBadTransfer
+		}
+		size = int64(s)
+	}
+
+	progress := newProgressReporter(o.progress, o.progressInterval, size)
+	buf := make([]byte, transferChunkSize+4)
+	var received int64
+	var sum uint32
+	for {
+		var lenbuf [4]byte
+		if _, err := io.ReadFull(r, lenbuf[:]); err != nil {
+			return received, noEOF(err)
+		}
+		n := binary.BigEndian.Uint32(lenbuf[:])
+		if n > transferChunkSize {
+			return received, ErrBadTransfer
+		}
+		if _, err := io.ReadFull(r, buf[:n+4]); err != nil {
+			return received, noEOF(err)
+		}
+		if n == 0 {
+			if binary.BigEndian.Uint32(buf[:4]) != sum {
+				return received, &ChecksumError{Offset: 0}
+			}
+			break
+		}
+		data := buf[:n]
+		if crc32.Checksum(data, castagnoli) != binary.BigEndian.Uint32(buf[n:]) {
+			return received, &ChecksumError{Offset: received}
+		}
+		if size >= 0 && received+int64(n) > size {
+			return received, ErrBadTransfer
+		}
+		if _, err := w.Write(data); err != nil {
+			return received, err
+		}
+		sum = crc32.Update(sum, castagnoli, data)
+		received += int64(n)
+		progress.update(received)
+	}
+	if size >= 0 && received != size {
+		return received, io.ErrUnexpectedEOF
+	}
+	progress.finish(received)
+	return received, nil
+}
+
+// noEOF converts io.EOF to io.ErrUnexpectedEOF, for use where the
+// stream must not end.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,516 @@
+//go:build linux && iouring
+
+package extraio
+
+import (
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// io_uring support, built only with the iouring build tag.
+// Requires linux 5.6 or later for IORING_OP_READ/WRITE.
+
+const (
+	uringOpRead  = 22
+	uringOpWrite = 23
+
+	uringEnterGetEvents = 1
+	uringFeatSingleMmap = 1
+	uringSQELink        = 1 << 2
+
+	uringOffSQRing = 0
+	uringOffCQRing = 0x8000000
+	uringOffSQEs   = 0x10000000
+
+	// ReadFrom and WriteTo keep up to uringDepth chunks in flight.
+	uringChunkSize = 128 * 1024
+	uringDepth     = 8
+)
+
+type uringSQOffsets struct {
+	head, tail, ringMask, ringEntries, flags, dropped, array, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringCQOffsets struct {
+	head, tail, ringMask, ringEntries, overflow, cqes, flags, resv1 uint32
+	userAddr                                                        uint64
+}
+
+type uringParams struct {
+	sqEntries, cqEntries, flags, sqThreadCPU, sqThreadIdle, features, wqFd uint32
+	resv                                                                   [3]uint32
+	sqOff                                                                  uringSQOffsets
+	cqOff                                                                  uringCQOffsets
+}
+
+type uringSQE struct {
+	opcode      uint8
+	flags       uint8
+	ioprio      uint16
+	fd          int32
+	off         uint64
+	addr        uint64
+	len         uint32
+	rwFlags     uint32
+	userData    uint64
+	bufIndex    uint16
+	personality uint16
+	spliceFdIn  int32
+	addr3       uint64
+	pad         uint64
+}
+
+type uringCQE struct {
+	userData uint64
+	res      int32
+	flags    uint32
+}
+
+var ErrRingClosed = errors.New("extraio: io_uring closed")
+
+// RingOp is a single read or write submitted with Ring.Do.
+type RingOp struct {
+	Fd    int
+	Write bool
+	Buf   []byte
+	// File offset, or -1 to use and advance the current file position.
+	Offset int64
+	// If set the next op starts only once this one has transferred all
+	// of Buf, if it falls short or fails the rest of the chain fails with
+	// ECANCELED. Chains are how ops using Offset -1 keep their order.
+	Link bool
+
+	// Set when the op completes.
+	N   int
+	Err error
+}
+
+// Ring is an io_uring instance. Calls to Do are serialized, each submits
+// its whole batch with as few io_uring_enter calls as possible.
+type Ring struct {
+	mu     sync.Mutex
+	fd     int
+	closed bool
+
+	sqMem, cqMem, sqeMem []byte
+
+	sqTail  *uint32
+	sqMask  uint32
+	sqArray []uint32
+	sqes    []uringSQE
+	sqSize  uint32
+
+	cqHead *uint32
+	cqTail *uint32
+	cqMask uint32
+	cqes   []uringCQE
+}
+
+// NewRing creates an io_uring with at least entries submission slots.
+func NewRing(entries uint32) (*Ring, error) {
+	var p uringParams
+	fd, _, errno := unix.Syscall(unix.SYS_IO_URING_SETUP, uintptr(entries), uintptr(unsafe.Pointer(&p)), 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("io_uring_setup", errno)
+	}
+	r := &Ring{fd: int(fd)}
+
+	sqSize := int(p.sqOff.array + p.sqEntries*4)
+	cqSize := int(p.cqOff.cqes + p.cqEntries*uint32(unsafe.Sizeof(uringCQE{})))
+	if p.features&uringFeatSingleMmap != 0 && cqSize > sqSize {
+		sqSize = cqSize
+	}
+	var err error
+	r.sqMem, err = unix.Mmap(r.fd, uringOffSQRing, sqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		r.release()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+	r.cqMem = r.sqMem
+	if p.features&uringFeatSingleMmap == 0 {
+		r.cqMem, err = unix.Mmap(r.fd, uringOffCQRing, cqSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+		if err != nil {
+			r.release()
+			return nil, os.NewSyscallError("mmap", err)
+		}
+	}
+	sqeSize := int(p.sqEntries) * int(unsafe.Sizeof(uringSQE{}))
+	r.sqeMem, err = unix.Mmap(r.fd, uringOffSQEs, sqeSize, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED|unix.MAP_POPULATE)
+	if err != nil {
+		r.release()
+		return nil, os.NewSyscallError("mmap", err)
+	}
+
+	sq := unsafe.Pointer(&r.sqMem[0])
+	r.sqTail = (*uint32)(unsafe.Add(sq, p.sqOff.tail))
+	r.sqMask = *(*uint32)(unsafe.Add(sq, p.sqOff.ringMask))
+	r.sqArray = unsafe.Slice((*uint32)(unsafe.Add(sq, p.sqOff.array)), p.sqEntries)
+	r.sqes = unsafe.Slice((*uringSQE)(unsafe.Pointer(&r.sqeMem[0])), p.sqEntries)
+	r.sqSize = p.sqEntries
+
+	cq := unsafe.Pointer(&r.cqMem[0])
+	r.cqHead = (*uint32)(unsafe.Add(cq, p.cqOff.head))
+	r.cqTail = (*uint32)(unsafe.Add(cq, p.cqOff.tail))
+	r.cqMask = *(*uint32)(unsafe.Add(cq, p.cqOff.ringMask))
+	r.cqes = unsafe.Slice((*uringCQE)(unsafe.Add(cq, p.cqOff.cqes)), p.cqEntries)
+	return r, nil
+}
+
+func (r *Ring) release() {
+	if r.sqeMem != nil {
+		_ = unix.Munmap(r.sqeMem)
+	}
+	if r.cqMem != nil && &r.cqMem[0] != &r.sqMem[0] {
+		_ = unix.Munmap(r.cqMem)
+	}
+	if r.sqMem != nil {
+		_ = unix.Munmap(r.sqMem)
+	}
+	_ = unix.Close(r.fd)
+}
+
+// Close releases the ring, it waits for any Do in progress.
+func (r *Ring) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.release()
+	return nil
+}
+
+// Do submits ops as a batch and waits for all of them to complete,
+// each op's N and Err report its individual result.
+// Ops on the same file using Offset -1 may complete in any order.
+func (r *Ring) Do(ops []RingOp) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return ErrRingClosed
+	}
+	for len(ops) > 0 {
+		batch := ops
+		if uint32(len(batch)) > r.sqSize {
+			batch = batch[:r.sqSize]
+		}
+		if err := r.doBatch(batch); err != nil {
+			return err
+		}
+		ops = ops[len(batch):]
+	}
+	return nil
+}
+
+func (r *Ring) doBatch(ops []RingOp) error {
+	// The kernel holds the buffer addresses until each op completes,
+	// they must not move before then.
+	var pinner runtime.Pinner
+	defer pinner.Unpin()
+	tail := *r.sqTail
+	for i := range ops {
+		op := &ops[i]
+		idx := tail & r.sqMask
+		sqe := uringSQE{
+			opcode:   uringOpRead,
+			fd:       int32(op.Fd),
+			off:      uint64(op.Offset),
+			len:      uint32(len(op.Buf)),
+			userData: uint64(i),
+		}
+		if op.Write {
+			sqe.opcode = uringOpWrite
+		}
+		// A chain may not run on past the end of the batch.
+		if op.Link && i < len(ops)-1 {
+			sqe.flags = uringSQELink
+		}
+		if len(op.Buf) > 0 {
+			pinner.Pin(&op.Buf[0])
+			sqe.addr = uint64(uintptr(unsafe.Pointer(&op.Buf[0])))
+		}
+		r.sqes[idx] = sqe
+		r.sqArray[idx] = idx
+		tail++
+	}
+	atomic.StoreUint32(r.sqTail, tail)
+
+	toSubmit := len(ops)
+	completed := 0
+	for completed < len(ops) {
+		n, _, errno := unix.Syscall6(unix.SYS_IO_URING_ENTER, uintptr(r.fd), uintptr(toSubmit), 1, uringEnterGetEvents, 0, 0)
+		if errno == unix.EINTR || errno == unix.EAGAIN || errno == unix.EBUSY {
+			continue
+		}
+		if errno != 0 {
+			// The ring state is unknown if submission failed part way.
+			r.closed = true
+			r.release()
+			return os.NewSyscallError("io_uring_enter", errno)
+		}
+		toSubmit -= int(n)
+
+		head := *r.cqHead
+		cqTail := atomic.LoadUint32(r.cqTail)
+		for ; head != cqTail; head++ {
+			cqe := r.cqes[head&r.cqMask]
+			op := &ops[cqe.userData]
+			if cqe.res < 0 {
+				op.N = 0
+				op.Err = os.NewSyscallError(opName(op.Write), unix.Errno(-cqe.res))
+			} else {
+				op.N = int(cqe.res)
+				op.Err = nil
+			}
+			completed++
+		}
+		atomic.StoreUint32(r.cqHead, head)
+	}
+	return nil
+}
+
+func opName(write bool) string {
+	if write {
+		return "write"
+	}
+	return "read"
+}
+
+// UringFile performs reads and writes on f through a Ring. It implements
+// io.Reader, io.Writer, io.ReaderAt, io.WriterAt and io.Closer.
+//
+// Each Read and Write is a single op. io.Copy to or from a UringFile uses
+// ReadFrom and WriteTo instead, which submit up to 8 chunks of 128KiB
+// together as a chain, so a copy costs one io_uring_enter per megabyte
+// rather than a syscall per buffer. Files sharing a Ring wait for each
+// other's ops, so the two ends of a pipe need a Ring each.
+type UringFile struct {
+	ring *Ring
+	f    *os.File
+	fd   int
+	// Reading ahead only pays off, and never blocks needlessly, on
+	// regular files.
+	regular bool
+}
+
+// NewUringFile returns f driven by ring, f is switched to blocking mode.
+func NewUringFile(ring *Ring, f *os.File) *UringFile {
+	u := &UringFile{
+		ring: ring,
+		f:    f,
+		fd:   int(f.Fd()),
+	}
+	if fi, err := f.Stat(); err == nil {
+		u.regular = fi.Mode().IsRegular()
+	}
+	return u
+}
+
+func (u *UringFile) do(write bool, p []byte, off int64) (int, error) {
+	ops := [1]RingOp{{Fd: u.fd, Write: write, Buf: p, Offset: off}}
+	err := u.ring.Do(ops[:])
+	runtime.KeepAlive(u.f)
+	if err != nil {
+		return 0, err
+	}
+	return ops[0].N, ops[0].Err
+}
+
+func (u *UringFile) Read(p []byte) (int, error) {
+	n, err := u.do(false, p, -1)
+	if err == nil && n == 0 && len(p) > 0 {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (u *UringFile) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := u.do(true, p[written:], -1)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+func (u *UringFile) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		n, err := u.do(false, p[read:], off+int64(read))
+		read += n
+		if err != nil {
+			return read, err
+		}
+		if n == 0 {
+			return read, io.EOF
+		}
+	}
+	return read, nil
+}
+
+func (u *UringFile) WriteAt(p []byte, off int64) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := u.do(true, p[written:], off+int64(written))
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+// depth returns how many chunks to submit together, no more than fit in
+// one submission as Do does not carry a chain across submissions.
+func (u *UringFile) depth() int {
+	return minInt(uringDepth, int(u.ring.sqSize))
+}
+
+// chain submits ops as one linked chain and returns the bytes moved
+// before the first op that fell short or failed, with its error.
+func (u *UringFile) chain(ops []RingOp) (int64, bool, error) {
+	for i := range ops {
+		ops[i].Link = true
+	}
+	err := u.ring.Do(ops)
+	runtime.KeepAlive(u.f)
+	if err != nil {
+		return 0, false, err
+	}
+	var n int64
+	for i := range ops {
+		n += int64(ops[i].N)
+		if ops[i].Err != nil {
+			return n, false, ops[i].Err
+		}
+		if ops[i].N < len(ops[i].Buf) {
+			return n, false, nil
+		}
+	}
+	return n, true, nil
+}
+
+// ReadFrom copies r to the file, writing up to 8 chunks per submission.
+// Filling a batch stops at the first read from r that does not fill its
+// chunk, so a slow r is not waited on while data is ready to write.
+func (u *UringFile) ReadFrom(r io.Reader) (int64, error) {
+	var bufs [uringDepth]*[]byte
+	for i := range bufs {
+		bufs[i] = getSizedBuf(uringChunkSize)
+		defer putSizedBuf(bufs[i])
+	}
+	var ops [uringDepth]RingOp
+	depth := u.depth()
+	var written int64
+	for {
+		nops := 0
+		var rerr error
+		for nops < depth {
+			buf := *bufs[nops]
+			n, err := r.Read(buf)
+			if n > 0 {
+				ops[nops] = RingOp{Fd: u.fd, Write: true, Buf: buf[:n], Offset: -1}
+				nops++
+			}
+			if err != nil {
+				rerr = err
+				break
+			}
+			if n < len(buf) {
+				break
+			}
+		}
+		if nops > 0 {
+			n, full, err := u.chain(ops[:nops])
+			written += n
+			if err != nil {
+				return written, err
+			}
+			// Sockets and pipes may take part of a write, finish the
+			// rest of the batch one op at a time.
+			for i := 0; !full && i < nops; i++ {
+				buf := ops[i].Buf
+				if n >= int64(len(buf)) {
+					n -= int64(len(buf))
+					continue
+				}
+				m, err := u.Write(buf[n:])
+				written += int64(m)
+				if err != nil {
+					return written, err
+				}
+				n = 0
+			}
+		}
+		if rerr == io.EOF {
+			return written, nil
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+}
+
+// WriteTo copies the file to w. Regular files are read ahead up to 8
+// chunks per submission, others a chunk at a time.
+func (u *UringFile) WriteTo(w io.Writer) (int64, error) {
+	depth := 1
+	if u.regular {
+		depth = u.depth()
+	}
+	var bufs [uringDepth]*[]byte
+	for i := range bufs[:depth] {
+		bufs[i] = getSizedBuf(uringChunkSize)
+		defer putSizedBuf(bufs[i])
+	}
+	var ops [uringDepth]RingOp
+	var written int64
+	for {
+		for i := range ops[:depth] {
+			ops[i] = RingOp{Fd: u.fd, Buf: *bufs[i], Offset: -1}
+		}
+		read, full, rerr := u.chain(ops[:depth])
+		for i := 0; read > 0; i++ {
+			chunk := ops[i].Buf[:minInt(int(read), ops[i].N)]
+			read -= int64(len(chunk))
+			n, err := w.Write(chunk)
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			if n < len(chunk) {
+				return written, io.ErrShortWrite
+			}
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+		// Only the end of the file cuts a read short.
+		if !full && (u.regular || ops[0].N == 0) {
+			return written, nil
+		}
+	}
+}
+
+// Close closes the file, not the ring.
+func (u *UringFile) Close() error {
+	return u.f.Close()
+}
@@ -0,0 +1,83 @@
+//go:build linux && iouring
+
+package extraio
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testRing(t *testing.T) *Ring {
+	t.Helper()
+	// Fewer entries than uringDepth, so chains are cut to fit.
+	ring, err := NewRing(4)
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { ring.Close() })
+	return ring
+}
+
+func uringTestData() []byte {
+	data := make([]byte, 3<<20+123)
+	rng := rand.New(rand.NewPCG(1, 1))
+	for i := range data {
+		data[i] = byte(rng.Uint32())
+	}
+	return data
+}
+
+func TestUringFileCopyRegular(t *testing.T) {
+	ring := testRing(t)
+	data := uringTestData()
+	f, err := os.Create(filepath.Join(t.TempDir(), "f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	uf := NewUringFile(ring, f)
+	if n, err := io.Copy(uf, bytes.NewReader(data)); err != nil || n != int64(len(data)) {
+		t.Fatalf("ReadFrom %d, %v", n, err)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, uf); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("data mismatch")
+	}
+}
+
+func TestUringFileCopyPipe(t *testing.T) {
+	data := uringTestData()
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	// Each end has its own ring, as Do calls on one ring are serialized.
+	w := NewUringFile(testRing(t), pw)
+	errc := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(w, bytes.NewReader(data))
+		pw.Close()
+		errc <- err
+	}()
+	var out bytes.Buffer
+	if _, err := io.Copy(&out, NewUringFile(testRing(t), pr)); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Fatal("data mismatch")
+	}
+}
@@ -0,0 +1,56 @@
+package extraio
+
+import (
+	"context"
+	"io"
+)
+
+// maxZeroWrites bounds how many times WriteAll tolerates
+// a writer making no progress without an error.
+const maxZeroWrites = 100
+
+// WriteAll writes all of p to w, continuing after short writes
+// from writers that do not honour the io.Writer contract.
+func WriteAll(w io.Writer, p []byte) (int, error) {
+	return WriteAllContext(context.Background(), w, p)
+}
+
+// WriteAllContext is like WriteAll but stops between writes once ctx is done,
+// and, given WithBackoff, retries writes failing with an IsTemporary error.
+// A write already blocked in w is not interrupted.
+func WriteAllContext(ctx context.Context, w io.Writer, p []byte, opts ...Option) (int, error) {
+	o := applyOptions(opts, optBackoff, "WriteAllContext")
+	written := 0
+	zeroWrites := 0
+	retries := 0
+	for written < len(p) {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+		n, err := w.Write(p[written:])
+		if n < 0 || n > len(p)-written {
+			return written, io.ErrShortWrite
+		}
+		written += n
+		if err != nil {
+			if o.backoff == nil || !IsTemporary(err) || o.backoff.Exhausted(retries) {
+				return written, err
+			}
+			if err := sleepContext(ctx, o.backoff.Delay(retries)); err != nil {
+				return written, err
+			}
+			retries++
+			continue
+		}
+		if n == 0 {
+			zeroWrites++
+			if zeroWrites >= maxZeroWrites {
+				return written, io.ErrNoProgress
+			}
+			continue
+		}
+		zeroWrites = 0
+		retries = 0
+	}
+	return written, nil
+}